@@ -0,0 +1,54 @@
+// Command apigen generates the frontend's TypeScript API types from the Go
+// API types. With -check it instead verifies that the generated file is up to
+// date and that the server's routes match the OpenAPI spec, exiting non-zero
+// otherwise.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/server"
+)
+
+func main() {
+	tsPath := flag.String("ts", "../frontend/src/api/types.ts", "Path of the generated TypeScript file")
+	check := flag.Bool("check", false, "Verify generated files and routes instead of writing")
+	flag.Parse()
+
+	generated := []byte(api.TypeScript())
+
+	if !*check {
+		if err := os.WriteFile(*tsPath, generated, 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write %s: %v\n", *tsPath, err)
+			os.Exit(1)
+		}
+		fmt.Printf("wrote %s\n", *tsPath)
+		return
+	}
+
+	failed := false
+
+	// Routes are registered without touching the database, so no manager is needed
+	srv := server.NewServer(slog.New(slog.NewTextHandler(io.Discard, nil)), server.Config{}, nil)
+	if err := srv.CheckOpenAPI(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		failed = true
+	}
+
+	existing, err := os.ReadFile(*tsPath)
+	if err != nil || !bytes.Equal(existing, generated) {
+		fmt.Fprintf(os.Stderr, "%s is out of date - run `just generate-api-types`\n", *tsPath)
+		failed = true
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+	fmt.Println("API spec, routes and TypeScript types are in sync")
+}
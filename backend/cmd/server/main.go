@@ -1,60 +1,150 @@
+// Command aptora-extensions runs the Aptora Extensions web server and the
+// commands used to administer it.
 package main
 
 import (
 	"context"
-	"flag"
+	"database/sql"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/kwila-cloud/aptora-extensions/backend/internal/config"
 	"github.com/kwila-cloud/aptora-extensions/backend/internal/database"
-	"github.com/kwila-cloud/aptora-extensions/backend/internal/server"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/logging"
 )
 
+const usage = `Usage: aptora-extensions [command] [flags] [arguments]
+
+Commands:
+  serve [-dev]                 Run the web server (the default)
+  migrate                      Create any missing Extensions database tables
+  config check                 Validate the configuration and both database connections
+  user add [-admin] <username> Create a user; the password is read from stdin
+  user passwd <username>       Set a user's password, read from stdin
+  user disable <username>      Prevent a user from signing in
+  export invoices              Write invoices as CSV or a PDF sales report
+
+Run "aptora-extensions <command> -h" for a command's flags.
+`
+
+// commands maps each command, including its subcommand, to its
+// implementation. Each returns the process exit code.
+var commands = map[string]func(args []string) int{
+	"serve":           runServe,
+	"migrate":         runMigrate,
+	"config check":    runConfigCheck,
+	"user add":        runUserAdd,
+	"user passwd":     runUserPasswd,
+	"user disable":    runUserDisable,
+	"export invoices": runExportInvoices,
+}
+
 func main() {
-	handler := slog.NewTextHandler(os.Stdout, nil)
-	logger := slog.New(handler)
+	os.Exit(run(os.Args[1:]))
+}
 
-	devMode := flag.Bool("dev", false, "Enable development mode (proxy to Vite dev server)")
-	flag.Parse()
+func run(args []string) int {
+	// Without a command the server runs, so "aptora-extensions -dev" keeps
+	// working
+	isHelp := len(args) > 0 && (args[0] == "help" || args[0] == "-h" || args[0] == "-help" || args[0] == "--help")
+	if len(args) == 0 || (!isHelp && strings.HasPrefix(args[0], "-")) {
+		return runServe(args)
+	}
+
+	name, rest := args[0], args[1:]
+	if _, ok := commands[name]; !ok && len(rest) > 0 {
+		name, rest = name+" "+rest[0], rest[1:]
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		if isHelp {
+			fmt.Print(usage)
+			return 0
+		}
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	return cmd(rest)
+}
+
+// app holds what every command shares: the configuration and the logger.
+type app struct {
+	cfg      config.Settings
+	logger   *slog.Logger
+	logLevel *slog.LevelVar
+}
 
-	// Load configuration
+// newApp loads the configuration and creates the logger. The server logs to
+// stdout (the journal); other commands log to stderr so their own output
+// stays clean. A configuration error is logged and returned.
+func newApp(w io.Writer) (*app, error) {
 	cfg, err := config.Load()
 	if err != nil {
-		logger.Error("failed to load config", slog.Any("error", err))
-		os.Exit(1)
-	}
-
-	// Create database manager
-	dbCfg := database.Config{
-		Host:                 cfg.DBHost,
-		Port:                 cfg.DBPort,
-		Encrypt:              cfg.DBEncrypt,
-		AptoraDBName:         cfg.AptoraDBName,
-		AptoraDBUser:         cfg.AptoraDBUser,
-		AptoraDBPassword:     cfg.AptoraDBPassword,
-		ExtensionsDBName:     cfg.ExtensionsDBName,
-		ExtensionsDBUser:     cfg.ExtensionsDBUser,
-		ExtensionsDBPassword: cfg.ExtensionsDBPassword,
-	}
-	db := database.NewManager(logger, dbCfg)
-	defer db.Close()
+		// Logging settings aren't known yet, so fall back to the default format
+		slog.New(slog.NewTextHandler(w, nil)).Error("failed to load config", slog.Any("error", err))
+		return nil, err
+	}
 
-	srv := server.NewServer(logger, *devMode, db)
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(cfg.LogLevel)
+	return &app{
+		cfg:      cfg,
+		logger:   logging.New(w, cfg.LogFormat, logLevel),
+		logLevel: logLevel,
+	}, nil
+}
 
-	// Create context that can be cancelled on SIGINT/SIGTERM
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+// commandContext returns a context cancelled by SIGINT or SIGTERM.
+func commandContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+}
+
+// withExtensionsDB connects to the Extensions database alone, bringing its
+// schema up to date, and runs fn. It returns the exit code, printing any
+// error.
+func (a *app) withExtensionsDB(fn func(ctx context.Context, db *sql.DB) error) int {
+	ctx, stop := commandContext()
 	defer stop()
 
-	addr := "0.0.0.0:80"
-	if *devMode {
-		addr = "localhost:8080"
+	db, err := database.NewManager(a.logger, dbConfig(a.cfg)).ConnectExtensions(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
 	}
+	defer db.Close()
+
+	if err := fn(ctx, db); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// dbConfig returns the database manager's settings.
+func dbConfig(cfg config.Settings) database.Config {
+	return database.Config{
+		Aptora:     connConfig(cfg.AptoraDB),
+		Extensions: connConfig(cfg.ExtensionsDB),
+	}
+}
 
-	if err := srv.Run(ctx, addr); err != nil {
-		logger.Error("server failed", slog.Any("error", err))
-		os.Exit(1)
+// connConfig converts one database's settings to its connection parameters.
+func connConfig(db config.DBSettings) database.ConnConfig {
+	return database.ConnConfig{
+		Host:                   db.Host,
+		Port:                   db.Port,
+		Instance:               db.Instance,
+		Database:               db.Name,
+		User:                   db.User,
+		Password:               db.Password,
+		Encrypt:                db.Encrypt,
+		TrustServerCertificate: db.TrustServerCertificate,
+		CAFile:                 db.CAFile,
+		WindowsAuth:            db.Auth == "ntlm",
 	}
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runMigrate implements "migrate": it creates any missing Extensions
+// database tables. The server does the same on every connect, so this is
+// only needed to prepare a database before the first start.
+func runMigrate(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "migrate takes no arguments")
+		return 2
+	}
+
+	a, err := newApp(os.Stderr)
+	if err != nil {
+		return 1
+	}
+	return a.withExtensionsDB(func(context.Context, *sql.DB) error {
+		fmt.Println("Extensions database schema is up to date")
+		return nil
+	})
+}
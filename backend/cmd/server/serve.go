@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/config"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/database"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/logging"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/scheduler"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/server"
+)
+
+// runServe implements "serve": it runs the web server until SIGINT or
+// SIGTERM.
+func runServe(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	devMode := flags.Bool("dev", false, "Enable development mode (proxy to Vite dev server)")
+	flags.Parse(args)
+
+	a, err := newApp(os.Stdout)
+	if err != nil {
+		return 1
+	}
+	logger := a.logger
+
+	// SIGUSR1 toggles debug logging without a restart
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	go func() {
+		for range usr1 {
+			level := logging.ToggleDebug(a.logLevel, a.cfg.LogLevel)
+			logger.Warn("log level changed by SIGUSR1", slog.String("level", level.String()))
+		}
+	}()
+
+	// Create database manager
+	db := database.NewManager(logger, dbConfig(a.cfg))
+
+	// SIGHUP re-reads the configuration and reconnects to the databases, so
+	// credentials can be rotated without a restart. Other settings still need
+	// a restart.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reloaded, err := config.Load()
+			if err != nil {
+				logger.Error("failed to reload config after SIGHUP - keeping current settings", slog.Any("error", err))
+				continue
+			}
+			logger.Warn("reloading database settings after SIGHUP")
+			db.Reload(dbConfig(reloaded))
+		}
+	}()
+
+	srv := server.NewServer(logger, a.serverConfig(*devMode), db)
+
+	// Create context that can be cancelled on SIGINT/SIGTERM
+	ctx, stop := commandContext()
+	defer stop()
+
+	addr := "0.0.0.0:80"
+	if *devMode {
+		addr = "localhost:8080"
+	}
+
+	if err := srv.Run(ctx, addr); err != nil {
+		logger.Error("server failed", slog.Any("error", err))
+		return 1
+	}
+	return 0
+}
+
+// serverConfig returns the web server's settings.
+func (a *app) serverConfig(devMode bool) server.Config {
+	cfg := a.cfg
+	return server.Config{
+		DevMode:                 devMode,
+		AdminToken:              cfg.AdminToken,
+		LogLevel:                a.logLevel,
+		QueryCacheTTL:           cfg.QueryCacheTTL,
+		QueryCacheHistoricalTTL: cfg.QueryCacheHistoricalTTL,
+		QueryCacheMaxEntries:    cfg.QueryCacheMaxEntries,
+
+		RateLimits: cfg.RateLimits,
+
+		QueryTimeouts: cfg.QueryTimeouts,
+
+		AptoraSources: server.AptoraSources{
+			InvoiceLinesView:        cfg.AptoraInvoiceLinesView,
+			LineInvoiceColumn:       cfg.AptoraInvoiceLinesInvoiceColumn,
+			LineItemColumn:          cfg.AptoraInvoiceLinesItemColumn,
+			LinePriceColumn:         cfg.AptoraInvoiceLinesPriceColumn,
+			CreditMemoType:          cfg.AptoraCreditMemoType,
+			CreditMemoInvoiceColumn: cfg.AptoraCreditMemoInvoiceColumn,
+			InvoiceCostColumn:       cfg.AptoraInvoiceCostColumn,
+		},
+
+		AptoraMaxConcurrentQueries: cfg.AptoraMaxConcurrentQueries,
+		AptoraQueryQueueSize:       cfg.AptoraQueryQueueSize,
+		AptoraQueryQueueTimeout:    cfg.AptoraQueryQueueTimeout,
+
+		SlowQueryThreshold:   cfg.SlowQueryThreshold,
+		SlowQueryCapturePlan: cfg.SlowQueryCapturePlan,
+
+		SMTP: scheduler.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+			Security: cfg.SMTPSecurity,
+		},
+
+		ChangeScanInterval:   cfg.ChangeScanInterval,
+		ChangeScanWindowDays: cfg.ChangeScanWindowDays,
+
+		MaxEventStreams: cfg.MaxEventStreams,
+
+		ShutdownTimeout: cfg.ShutdownTimeout,
+	}
+}
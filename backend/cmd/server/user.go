@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/auth"
+)
+
+// runUserAdd implements "user add": it creates a user, typically the first
+// admin before anyone can sign in to the web UI.
+func runUserAdd(args []string) int {
+	flags := flag.NewFlagSet("user add", flag.ExitOnError)
+	admin := flags.Bool("admin", false, "Grant the user admin rights")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: aptora-extensions user add [-admin] <username>")
+		flags.PrintDefaults()
+	}
+	username, ok := parseUsername(flags, args)
+	if !ok {
+		return 2
+	}
+
+	a, err := newApp(os.Stderr)
+	if err != nil {
+		return 1
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return a.withExtensionsDB(func(ctx context.Context, db *sql.DB) error {
+		user, err := auth.CreateUser(ctx, db, username, password, *admin)
+		if errors.Is(err, auth.ErrUserExists) {
+			return fmt.Errorf("user %q already exists - use \"user passwd\" to change the password", username)
+		}
+		if err != nil {
+			return err
+		}
+		role := "user"
+		if user.IsAdmin {
+			role = "admin"
+		}
+		fmt.Printf("Created %s %q\n", role, user.Username)
+		return nil
+	})
+}
+
+// runUserPasswd implements "user passwd": it sets a user's password.
+func runUserPasswd(args []string) int {
+	flags := flag.NewFlagSet("user passwd", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: aptora-extensions user passwd <username>")
+	}
+	username, ok := parseUsername(flags, args)
+	if !ok {
+		return 2
+	}
+
+	a, err := newApp(os.Stderr)
+	if err != nil {
+		return 1
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return a.withExtensionsDB(func(ctx context.Context, db *sql.DB) error {
+		if err := auth.SetPassword(ctx, db, username, password); err != nil {
+			return userError(username, err)
+		}
+		fmt.Printf("Changed the password of %q\n", username)
+		return nil
+	})
+}
+
+// runUserDisable implements "user disable": it prevents a user from signing
+// in.
+func runUserDisable(args []string) int {
+	flags := flag.NewFlagSet("user disable", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: aptora-extensions user disable <username>")
+	}
+	username, ok := parseUsername(flags, args)
+	if !ok {
+		return 2
+	}
+
+	a, err := newApp(os.Stderr)
+	if err != nil {
+		return 1
+	}
+	return a.withExtensionsDB(func(ctx context.Context, db *sql.DB) error {
+		if err := auth.DisableUser(ctx, db, username); err != nil {
+			return userError(username, err)
+		}
+		fmt.Printf("Disabled %q\n", username)
+		return nil
+	})
+}
+
+// parseUsername parses flags and the single username argument of the user
+// commands.
+func parseUsername(flags *flag.FlagSet, args []string) (string, bool) {
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return "", false
+	}
+	username := flags.Arg(0)
+	if err := auth.ValidateUsername(username); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return "", false
+	}
+	return username, true
+}
+
+func userError(username string, err error) error {
+	if errors.Is(err, auth.ErrUserNotFound) {
+		return fmt.Errorf("user %q does not exist", username)
+	}
+	return err
+}
+
+// readPassword reads a new password from stdin. On a terminal it prompts
+// twice with echo turned off; otherwise it reads the first line, so scripts
+// can pipe the password in.
+func readPassword() (string, error) {
+	in := bufio.NewReader(os.Stdin)
+
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		password, err := readLine(in)
+		if err != nil {
+			return "", err
+		}
+		return password, auth.ValidatePassword(password)
+	}
+
+	// Turn off echo for the duration of the prompts
+	if err := stty("-echo"); err != nil {
+		return "", fmt.Errorf("failed to turn off terminal echo: %w", err)
+	}
+	defer stty("echo")
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := readLine(in)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if err := auth.ValidatePassword(password); err != nil {
+		return "", err
+	}
+
+	fmt.Fprint(os.Stderr, "Repeat password: ")
+	repeated, err := readLine(in)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if repeated != password {
+		return "", errors.New("passwords do not match")
+	}
+
+	return password, nil
+}
+
+func readLine(in *bufio.Reader) (string, error) {
+	line, err := in.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func stty(arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
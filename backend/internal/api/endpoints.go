@@ -0,0 +1,404 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/auth"
+)
+
+// Param describes a path or query parameter.
+type Param struct {
+	Name        string
+	In          string // "query", "path" or "header"
+	Description string
+	Required    bool
+	Type        string // "string", "integer" or "boolean"
+	Format      string
+}
+
+// Endpoint describes one HTTP route for the OpenAPI document.
+type Endpoint struct {
+	Method      string
+	Path        string
+	OperationID string
+	Summary     string
+	Tag         string
+	Params      []Param
+	Request     any    // zero value of the JSON request body type, if any
+	Response    any    // zero value of the success response body type (or stream message type); nil for no body
+	Status      int    // success status; defaults to 200
+	ContentType string // non-JSON success body, e.g. "application/pdf"
+	Scope       string
+	// Authenticated endpoints reject requests without credentials; other
+	// scoped endpoints also serve anonymous browser requests
+	Authenticated bool
+	Admin         bool
+}
+
+var dateRangeParams = []Param{
+	{Name: "start_date", In: "query", Required: true, Type: "string", Format: "date", Description: "First invoice date to include (YYYY-MM-DD)"},
+	{Name: "end_date", In: "query", Required: true, Type: "string", Format: "date", Description: "Last invoice date to include (YYYY-MM-DD)"},
+	{Name: "employee", In: "query", Type: "string", Description: "Only include invoices for this sales rep name"},
+}
+
+// Endpoints lists every API route. The server verifies at generation time
+// (cmd/apigen -check) that its router matches this list exactly.
+var Endpoints = []Endpoint{
+	{
+		Method:      http.MethodGet,
+		Path:        "/health",
+		OperationID: "getHealth",
+		Summary:     "Report database connection health",
+		Tag:         "system",
+		Response:    HealthResponse{},
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/openapi.json",
+		OperationID: "getOpenAPI",
+		Summary:     "This OpenAPI document",
+		Tag:         "system",
+		Response:    map[string]any{},
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/employees",
+		OperationID: "listEmployees",
+		Summary:     "List active employees",
+		Tag:         "aptora",
+		Response:    EmployeesResponse{},
+		Scope:       auth.ScopeEmployees,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/invoices",
+		OperationID: "listInvoices",
+		Summary:     "List invoices in a date range (at most 500)",
+		Tag:         "aptora",
+		Params: append(slices.Clip(dateRangeParams),
+			Param{Name: "is_write_off", In: "query", Type: "boolean", Description: "Only include write-offs (true) or only other invoices (false)"},
+		),
+		Response: InvoicesResponse{},
+		Scope:    auth.ScopeInvoices,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/invoices/compare",
+		OperationID: "compareInvoices",
+		Summary:     "Compare invoice counts and subtotals per sales rep between two date ranges",
+		Tag:         "aptora",
+		Params: append(slices.Clip(dateRangeParams),
+			Param{Name: "compare_start_date", In: "query", Type: "string", Format: "date", Description: "First day of the range to compare against (YYYY-MM-DD); requires compare_end_date"},
+			Param{Name: "compare_end_date", In: "query", Type: "string", Format: "date", Description: "Last day of the range to compare against (YYYY-MM-DD)"},
+			Param{Name: "vs", In: "query", Type: "string", Description: "prior_period or prior_year, when no comparison range is given (default prior_period)"},
+		),
+		Response: InvoiceComparisonResponse{},
+		Scope:    auth.ScopeInvoices,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/invoices/{number}/review",
+		OperationID: "getInvoiceReview",
+		Summary:     "Get the review status of an invoice",
+		Tag:         "reviews",
+		Params: []Param{
+			{Name: "number", In: "path", Required: true, Type: "integer", Description: "Invoice number"},
+		},
+		Response: InvoiceReview{},
+		Scope:    auth.ScopeInvoices,
+	},
+	{
+		Method:      http.MethodPut,
+		Path:        "/api/invoices/{number}/review",
+		OperationID: "setInvoiceReview",
+		Summary:     "Set the review status of an invoice; marking it disputed fires invoice.disputed webhooks",
+		Tag:         "reviews",
+		Params: []Param{
+			{Name: "number", In: "path", Required: true, Type: "integer", Description: "Invoice number"},
+		},
+		Request:       SetInvoiceReviewRequest{},
+		Response:      InvoiceReview{},
+		Scope:         auth.ScopeReviews,
+		Authenticated: true,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/leaderboard",
+		OperationID: "getLeaderboard",
+		Summary:     "Rank active employees by revenue for the period so far, with goal progress and the change from the prior period",
+		Tag:         "aptora",
+		Params: []Param{
+			{Name: "period", In: "query", Type: "string", Description: "month, quarter or year, to date (default month)"},
+		},
+		Response: LeaderboardResponse{},
+		Scope:    auth.ScopeInvoices,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/reports/sales.pdf",
+		OperationID: "getSalesReportPDF",
+		Summary:     "Sales report PDF with per-rep subtotals",
+		Tag:         "reports",
+		Params:      dateRangeParams,
+		ContentType: "application/pdf",
+		Scope:       auth.ScopeInvoices,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/write-offs",
+		OperationID: "getWriteOffs",
+		Summary:     "Summarize the write-offs in a date range by sales rep and reason",
+		Tag:         "reports",
+		Params:      dateRangeParams,
+		Response:    WriteOffsResponse{},
+		Scope:       auth.ScopeInvoices,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/events",
+		OperationID: "streamEvents",
+		Summary:     "Server-sent stream of invoice, review and health changes",
+		Tag:         "events",
+		Params: []Param{
+			{Name: "Last-Event-ID", In: "header", Type: "string", Description: "Resume after this event ID; sent automatically by EventSource when reconnecting"},
+		},
+		Response:      StreamEvent{},
+		ContentType:   "text/event-stream",
+		Scope:         auth.ScopeInvoices,
+		Authenticated: true,
+	},
+	{
+		Method:      http.MethodDelete,
+		Path:        "/api/admin/cache",
+		OperationID: "purgeCache",
+		Summary:     "Purge the query cache",
+		Tag:         "admin",
+		Response:    PurgeCacheResponse{},
+		Admin:       true,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/admin/log-level",
+		OperationID: "getLogLevel",
+		Summary:     "Get the current log level",
+		Tag:         "admin",
+		Response:    LogLevel{},
+		Admin:       true,
+	},
+	{
+		Method:      http.MethodPut,
+		Path:        "/api/admin/log-level",
+		OperationID: "setLogLevel",
+		Summary:     "Change the log level",
+		Tag:         "admin",
+		Request:     LogLevel{},
+		Response:    LogLevel{},
+		Admin:       true,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/admin/api-keys",
+		OperationID: "listAPIKeys",
+		Summary:     "List API keys",
+		Tag:         "admin",
+		Response:    APIKeysResponse{},
+		Admin:       true,
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/admin/api-keys",
+		OperationID: "createAPIKey",
+		Summary:     "Create an API key; the secret is only returned once",
+		Tag:         "admin",
+		Request:     CreateAPIKeyRequest{},
+		Response:    CreatedAPIKey{},
+		Status:      http.StatusCreated,
+		Admin:       true,
+	},
+	{
+		Method:      http.MethodDelete,
+		Path:        "/api/admin/api-keys/{id}",
+		OperationID: "revokeAPIKey",
+		Summary:     "Revoke an API key",
+		Tag:         "admin",
+		Params:      []Param{{Name: "id", In: "path", Required: true, Type: "integer"}},
+		Status:      http.StatusNoContent,
+		Admin:       true,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/admin/report-subscriptions",
+		OperationID: "listReportSubscriptions",
+		Summary:     "List scheduled report subscriptions",
+		Tag:         "admin",
+		Response:    ReportSubscriptionsResponse{},
+		Admin:       true,
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/admin/report-subscriptions",
+		OperationID: "createReportSubscription",
+		Summary:     "Subscribe recipients to a report on a cron schedule",
+		Tag:         "admin",
+		Request:     CreateReportSubscriptionRequest{},
+		Response:    ReportSubscription{},
+		Status:      http.StatusCreated,
+		Admin:       true,
+	},
+	{
+		Method:      http.MethodDelete,
+		Path:        "/api/admin/report-subscriptions/{id}",
+		OperationID: "deleteReportSubscription",
+		Summary:     "Delete a report subscription and its run history",
+		Tag:         "admin",
+		Params:      []Param{{Name: "id", In: "path", Required: true, Type: "integer"}},
+		Status:      http.StatusNoContent,
+		Admin:       true,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/admin/report-subscriptions/{id}/runs",
+		OperationID: "listReportRuns",
+		Summary:     "List the 50 most recent runs of a report subscription",
+		Tag:         "admin",
+		Params:      []Param{{Name: "id", In: "path", Required: true, Type: "integer"}},
+		Response:    ReportRunsResponse{},
+		Admin:       true,
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/admin/report-subscriptions/{id}/run",
+		OperationID: "runReportSubscription",
+		Summary:     "Send a subscription's report now",
+		Tag:         "admin",
+		Params:      []Param{{Name: "id", In: "path", Required: true, Type: "integer"}},
+		Response:    ReportRun{},
+		Admin:       true,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/admin/webhooks",
+		OperationID: "listWebhooks",
+		Summary:     "List webhooks",
+		Tag:         "admin",
+		Response:    WebhooksResponse{},
+		Admin:       true,
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/admin/webhooks",
+		OperationID: "createWebhook",
+		Summary:     "Create a webhook; the signing secret is only returned once",
+		Tag:         "admin",
+		Request:     CreateWebhookRequest{},
+		Response:    CreatedWebhook{},
+		Status:      http.StatusCreated,
+		Admin:       true,
+	},
+	{
+		Method:      http.MethodDelete,
+		Path:        "/api/admin/webhooks/{id}",
+		OperationID: "deleteWebhook",
+		Summary:     "Delete a webhook and its delivery log",
+		Tag:         "admin",
+		Params:      []Param{{Name: "id", In: "path", Required: true, Type: "integer"}},
+		Status:      http.StatusNoContent,
+		Admin:       true,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/admin/webhooks/{id}/deliveries",
+		OperationID: "listWebhookDeliveries",
+		Summary:     "List the 100 most recent deliveries of a webhook",
+		Tag:         "admin",
+		Params:      []Param{{Name: "id", In: "path", Required: true, Type: "integer"}},
+		Response:    WebhookDeliveriesResponse{},
+		Admin:       true,
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/admin/webhooks/{id}/test",
+		OperationID: "testWebhook",
+		Summary:     "Send a webhook.test event now",
+		Tag:         "admin",
+		Params:      []Param{{Name: "id", In: "path", Required: true, Type: "integer"}},
+		Response:    WebhookDelivery{},
+		Admin:       true,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/admin/slow-queries",
+		OperationID: "listSlowQueries",
+		Summary:     "List the Aptora queries that spent the most time over the slow query threshold",
+		Tag:         "admin",
+		Params: []Param{
+			{Name: "days", In: "query", Type: "integer", Description: "How many days back to look, 1-30 (default 7)"},
+			{Name: "limit", In: "query", Type: "integer", Description: "How many queries to return, 1-100 (default 20)"},
+		},
+		Response: SlowQueriesResponse{},
+		Admin:    true,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/admin/slow-queries/{id}/plan",
+		OperationID: "getSlowQueryPlan",
+		Summary:     "Download the captured showplan XML of a slow query run",
+		Tag:         "admin",
+		Params:      []Param{{Name: "id", In: "path", Required: true, Type: "integer"}},
+		ContentType: "application/xml",
+		Admin:       true,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/admin/sales-goals",
+		OperationID: "listSalesGoals",
+		Summary:     "List the employees' sales goals for a month",
+		Tag:         "admin",
+		Params: []Param{
+			{Name: "month", In: "query", Type: "string", Description: "Month as YYYY-MM (default the current month)"},
+		},
+		Response: SalesGoalsResponse{},
+		Admin:    true,
+	},
+	{
+		Method:      http.MethodPut,
+		Path:        "/api/admin/sales-goals",
+		OperationID: "setSalesGoal",
+		Summary:     "Set an employee's sales goals for a month",
+		Tag:         "admin",
+		Request:     SetSalesGoalRequest{},
+		Status:      http.StatusNoContent,
+		Admin:       true,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/admin/write-off-item-codes",
+		OperationID: "listWriteOffItemCodes",
+		Summary:     "List the item codes that mark invoices as write-offs",
+		Tag:         "admin",
+		Response:    WriteOffItemCodesResponse{},
+		Admin:       true,
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/admin/write-off-item-codes",
+		OperationID: "createWriteOffItemCode",
+		Summary:     "Add an item code that marks invoices as write-offs",
+		Tag:         "admin",
+		Request:     CreateWriteOffItemCodeRequest{},
+		Response:    WriteOffItemCode{},
+		Status:      http.StatusCreated,
+		Admin:       true,
+	},
+	{
+		Method:      http.MethodDelete,
+		Path:        "/api/admin/write-off-item-codes/{id}",
+		OperationID: "deleteWriteOffItemCode",
+		Summary:     "Remove a write-off item code",
+		Tag:         "admin",
+		Params:      []Param{{Name: "id", In: "path", Required: true, Type: "integer"}},
+		Status:      http.StatusNoContent,
+		Admin:       true,
+	},
+}
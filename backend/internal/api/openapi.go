@@ -0,0 +1,259 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// enumValues lists the allowed values of named string types.
+var enumValues = map[reflect.Type][]string{
+	reflect.TypeOf(ErrorCode("")):             enumStrings(ErrorCodes),
+	reflect.TypeOf(ReportKind("")):            enumStrings(ReportKinds),
+	reflect.TypeOf(ReportFormat("")):          enumStrings(ReportFormats),
+	reflect.TypeOf(ReportPeriod("")):          enumStrings(ReportPeriods),
+	reflect.TypeOf(ReportRunStatus("")):       enumStrings(ReportRunStatuses),
+	reflect.TypeOf(ReviewStatus("")):          enumStrings(ReviewStatuses),
+	reflect.TypeOf(WebhookEvent("")):          enumStrings(WebhookEvents),
+	reflect.TypeOf(WebhookDeliveryStatus("")): enumStrings(WebhookDeliveryStatuses),
+	reflect.TypeOf(StreamEventType("")):       enumStrings(StreamEventTypes),
+	reflect.TypeOf(LeaderboardPeriod("")):     enumStrings(LeaderboardPeriods),
+	reflect.TypeOf(CompareBasis("")):          enumStrings(CompareBases),
+	reflect.TypeOf(WriteOffReason("")):        enumStrings(WriteOffReasons),
+}
+
+func enumStrings[T ~string](values []T) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = string(v)
+	}
+	return out
+}
+
+// OpenAPI returns the OpenAPI 3 document describing Endpoints. Schemas are
+// derived from the Go types by reflection, so they can't drift from what the
+// handlers encode.
+func OpenAPI() map[string]any {
+	g := &schemaGen{schemas: map[string]any{}}
+	errorSchema := g.schema(reflect.TypeOf(ErrorResponse{}))
+	g.schema(reflect.TypeOf(ProblemResponse{}))
+
+	paths := map[string]any{}
+	for _, ep := range Endpoints {
+		op := map[string]any{
+			"operationId": ep.OperationID,
+			"summary":     ep.Summary,
+			"tags":        []string{ep.Tag},
+		}
+
+		if len(ep.Params) > 0 {
+			params := []any{}
+			for _, p := range ep.Params {
+				schema := map[string]any{"type": p.Type}
+				if p.Format != "" {
+					schema["format"] = p.Format
+				}
+				param := map[string]any{
+					"name":     p.Name,
+					"in":       p.In,
+					"required": p.Required,
+					"schema":   schema,
+				}
+				if p.Description != "" {
+					param["description"] = p.Description
+				}
+				params = append(params, param)
+			}
+			op["parameters"] = params
+		}
+
+		if ep.Request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": g.schema(reflect.TypeOf(ep.Request))},
+				},
+			}
+		}
+
+		status := ep.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]any{"description": http.StatusText(status)}
+		if ep.ContentType != "" {
+			// Response, if set, describes each message of a stream
+			schema := map[string]any{"type": "string", "format": "binary"}
+			if ep.Response != nil {
+				schema = g.schema(reflect.TypeOf(ep.Response))
+			}
+			success["content"] = map[string]any{
+				ep.ContentType: map[string]any{"schema": schema},
+			}
+		} else if ep.Response != nil {
+			success["content"] = map[string]any{
+				"application/json": map[string]any{"schema": g.schema(reflect.TypeOf(ep.Response))},
+			}
+		}
+		op["responses"] = map[string]any{
+			strconv.Itoa(status): success,
+			"default": map[string]any{
+				"description": "Error",
+				"content": map[string]any{
+					"application/json":         map[string]any{"schema": errorSchema},
+					"application/problem+json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/ProblemResponse"}},
+				},
+			},
+		}
+
+		if ep.Admin {
+			op["security"] = []any{map[string]any{"adminToken": []string{}}}
+		} else if ep.Authenticated {
+			op["description"] = "Requires the admin token or an API key with the `" + ep.Scope + "` scope."
+			op["security"] = []any{map[string]any{"apiKey": []string{ep.Scope}}, map[string]any{"adminToken": []string{}}}
+		} else if ep.Scope != "" {
+			op["description"] = "API keys need the `" + ep.Scope + "` scope."
+			op["security"] = []any{map[string]any{}, map[string]any{"apiKey": []string{ep.Scope}}}
+		}
+
+		item, _ := paths[ep.Path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[ep.Path] = item
+		}
+		item[strings.ToLower(ep.Method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Aptora Extensions API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]any{
+				"apiKey":     map[string]any{"type": "http", "scheme": "bearer", "description": "API key (apx_...)"},
+				"adminToken": map[string]any{"type": "http", "scheme": "bearer", "description": "ADMIN_TOKEN"},
+			},
+		},
+	}
+}
+
+// schemaGen builds JSON schemas, collecting named struct types into
+// components/schemas.
+type schemaGen struct {
+	schemas map[string]any
+}
+
+func (g *schemaGen) schema(t reflect.Type) map[string]any {
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		inner := g.schema(t.Elem())
+		if _, isRef := inner["$ref"]; isRef {
+			return map[string]any{"allOf": []any{inner}, "nullable": true}
+		}
+		inner["nullable"] = true
+		return inner
+	case reflect.String:
+		if values, ok := enumValues[t]; ok {
+			return map[string]any{"type": "string", "enum": values}
+		}
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			g.schemas[t.Name()] = map[string]any{} // placeholder for recursive types
+			g.schemas[t.Name()] = g.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+
+	// interface{} and anything else accepts any value
+	return map[string]any{}
+}
+
+func (g *schemaGen) structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+
+	for _, f := range jsonFields(t) {
+		prop := g.schema(f.typ)
+		if f.format != "" {
+			prop["format"] = f.format
+		}
+		properties[f.name] = prop
+		if !f.optional {
+			required = append(required, f.name)
+		}
+	}
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// jsonField is a struct field as encoding/json sees it.
+type jsonField struct {
+	name     string
+	typ      reflect.Type
+	optional bool
+	format   string
+}
+
+// jsonFields returns the fields encoding/json would encode for t, flattening
+// embedded structs.
+func jsonFields(t reflect.Type) []jsonField {
+	fields := []jsonField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, jsonFields(f.Type)...)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		fields = append(fields, jsonField{
+			name:     name,
+			typ:      f.Type,
+			optional: strings.Contains(opts, "omitempty"),
+			format:   f.Tag.Get("format"),
+		})
+	}
+	return fields
+}
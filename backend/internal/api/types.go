@@ -0,0 +1,583 @@
+// Package api defines the JSON types exchanged over the HTTP API. The OpenAPI
+// document and the frontend's TypeScript types are generated from these types,
+// so handlers must use them rather than ad-hoc maps or structs.
+package api
+
+import (
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/auth"
+)
+
+type Employee struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type EmployeesResponse struct {
+	Employees []Employee `json:"employees"`
+}
+
+type Invoice struct {
+	Number       int     `json:"number"`
+	Date         string  `json:"date" format:"date"`
+	EmployeeName string  `json:"employee_name"`
+	Subtotal     float64 `json:"subtotal"`
+	// TODO: add total_cost
+	// TODO: add gross_profit (subtotal - total_cost)
+	// TODO: add gross_profit_percentage gross_profit / subtotal
+	// IsWriteOff is set for invoices detected as write-offs, with the reason
+	// in WriteOffReason.
+	IsWriteOff     bool           `json:"is_write_off"`
+	WriteOffReason WriteOffReason `json:"write_off_reason,omitempty"`
+}
+
+type InvoicesResponse struct {
+	Invoices []Invoice `json:"invoices"`
+}
+
+type HealthResponse struct {
+	Status string    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	Code   ErrorCode `json:"code,omitempty"`
+}
+
+// ErrorCode is a machine-readable identifier included in every API error
+// response, so clients don't have to match on messages.
+type ErrorCode string
+
+const (
+	CodeInvalidParam  ErrorCode = "invalid_param"
+	CodeTooManyRows   ErrorCode = "too_many_rows"
+	CodeDBUnavailable ErrorCode = "db_unavailable"
+	CodeNotFound      ErrorCode = "not_found"
+	CodeUnauthorized  ErrorCode = "unauthorized"
+	CodeForbidden     ErrorCode = "forbidden"
+	CodeRateLimited   ErrorCode = "rate_limited"
+	CodeOverloaded    ErrorCode = "overloaded"
+	CodeQueryTimeout  ErrorCode = "query_timeout"
+	CodeNotConfigured ErrorCode = "not_configured"
+	CodeInternal      ErrorCode = "internal_error"
+)
+
+// ErrorCodes lists every ErrorCode, for the generated enum.
+var ErrorCodes = []ErrorCode{
+	CodeInvalidParam,
+	CodeTooManyRows,
+	CodeDBUnavailable,
+	CodeNotFound,
+	CodeUnauthorized,
+	CodeForbidden,
+	CodeRateLimited,
+	CodeOverloaded,
+	CodeQueryTimeout,
+	CodeNotConfigured,
+	CodeInternal,
+}
+
+// ErrorResponse is the default JSON error body.
+type ErrorResponse struct {
+	Error     string    `json:"error"`
+	Code      ErrorCode `json:"code"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// ProblemResponse is an RFC 7807 problem details body, sent to clients that
+// ask for application/problem+json.
+type ProblemResponse struct {
+	Type      string    `json:"type"`
+	Title     string    `json:"title"`
+	Status    int       `json:"status"`
+	Detail    string    `json:"detail"`
+	Instance  string    `json:"instance,omitempty"`
+	Code      ErrorCode `json:"code"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+type PurgeCacheResponse struct {
+	Purged int `json:"purged"`
+}
+
+type LogLevel struct {
+	Level string `json:"level"`
+}
+
+type APIKeysResponse struct {
+	APIKeys []auth.APIKey `json:"api_keys"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreatedAPIKey is returned once when a key is created; Key is the secret.
+type CreatedAPIKey struct {
+	auth.APIKey
+	Key string `json:"key"`
+}
+
+// ReportKind identifies a saved report that can be scheduled.
+type ReportKind string
+
+const (
+	ReportInvoiceSummary ReportKind = "invoice_summary" // every invoice, grouped by sales rep
+	ReportCommissions    ReportKind = "commissions"     // invoice totals per sales rep
+)
+
+// ReportKinds lists every ReportKind, for validation and the generated enum.
+var ReportKinds = []ReportKind{ReportInvoiceSummary, ReportCommissions}
+
+// ReportFormat is the file format a scheduled report is delivered in.
+type ReportFormat string
+
+const (
+	ReportFormatCSV ReportFormat = "csv"
+	ReportFormatPDF ReportFormat = "pdf"
+)
+
+// ReportFormats lists every ReportFormat.
+var ReportFormats = []ReportFormat{ReportFormatCSV, ReportFormatPDF}
+
+// ReportPeriod is the date range a scheduled report covers, relative to
+// when it runs.
+type ReportPeriod string
+
+const (
+	PeriodPreviousDay   ReportPeriod = "previous_day"
+	PeriodPreviousWeek  ReportPeriod = "previous_week" // Monday through Sunday
+	PeriodPreviousMonth ReportPeriod = "previous_month"
+	PeriodMonthToDate   ReportPeriod = "month_to_date"
+)
+
+// ReportPeriods lists every ReportPeriod.
+var ReportPeriods = []ReportPeriod{PeriodPreviousDay, PeriodPreviousWeek, PeriodPreviousMonth, PeriodMonthToDate}
+
+// ReportSubscription emails a report to its recipients on a cron schedule.
+type ReportSubscription struct {
+	ID         int          `json:"id"`
+	Name       string       `json:"name"`
+	Report     ReportKind   `json:"report"`
+	Format     ReportFormat `json:"format"`
+	Period     ReportPeriod `json:"period"`
+	Employee   string       `json:"employee,omitempty"` // only include this sales rep
+	Schedule   string       `json:"schedule"`           // cron expression, in server local time
+	Recipients []string     `json:"recipients"`
+	Enabled    bool         `json:"enabled"`
+	NextRunAt  *time.Time   `json:"next_run_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+type ReportSubscriptionsResponse struct {
+	Subscriptions []ReportSubscription `json:"subscriptions"`
+}
+
+type CreateReportSubscriptionRequest struct {
+	Name       string       `json:"name"`
+	Report     ReportKind   `json:"report"`
+	Format     ReportFormat `json:"format"`
+	Period     ReportPeriod `json:"period"`
+	Employee   string       `json:"employee,omitempty"`
+	Schedule   string       `json:"schedule"`
+	Recipients []string     `json:"recipients"`
+}
+
+// ReportRunStatus is the outcome of a scheduled report run.
+type ReportRunStatus string
+
+const (
+	RunRunning   ReportRunStatus = "running"
+	RunSucceeded ReportRunStatus = "succeeded"
+	RunFailed    ReportRunStatus = "failed"
+)
+
+// ReportRunStatuses lists every ReportRunStatus.
+var ReportRunStatuses = []ReportRunStatus{RunRunning, RunSucceeded, RunFailed}
+
+// ReportRun records one attempt to generate and send a subscription's report.
+type ReportRun struct {
+	ID             int             `json:"id"`
+	SubscriptionID int             `json:"subscription_id"`
+	Manual         bool            `json:"manual"` // triggered through the API rather than the schedule
+	StartedAt      time.Time       `json:"started_at"`
+	FinishedAt     *time.Time      `json:"finished_at"`
+	Status         ReportRunStatus `json:"status"`
+	Error          string          `json:"error,omitempty"`
+	Invoices       int             `json:"invoices"`
+	StartDate      string          `json:"start_date" format:"date"`
+	EndDate        string          `json:"end_date" format:"date"`
+}
+
+type ReportRunsResponse struct {
+	Runs []ReportRun `json:"runs"`
+}
+
+// ReviewStatus is where an invoice stands in review. Aptora has no review
+// workflow, so statuses are kept in the Extensions database.
+type ReviewStatus string
+
+const (
+	ReviewApproved ReviewStatus = "approved"
+	ReviewDisputed ReviewStatus = "disputed"
+	ReviewResolved ReviewStatus = "resolved" // a dispute was settled
+)
+
+// ReviewStatuses lists every ReviewStatus.
+var ReviewStatuses = []ReviewStatus{ReviewApproved, ReviewDisputed, ReviewResolved}
+
+// InvoiceReview is the latest review of an invoice.
+type InvoiceReview struct {
+	InvoiceNumber int          `json:"invoice_number"`
+	Status        ReviewStatus `json:"status"`
+	Note          string       `json:"note,omitempty"`
+	ReviewedBy    string       `json:"reviewed_by"` // API key name, or "admin"
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
+
+type SetInvoiceReviewRequest struct {
+	Status ReviewStatus `json:"status"`
+	Note   string       `json:"note,omitempty"`
+}
+
+// WebhookEvent names an event that webhooks can subscribe to.
+type WebhookEvent string
+
+const (
+	EventInvoiceCreated  WebhookEvent = "invoice.created"
+	EventInvoiceDisputed WebhookEvent = "invoice.disputed" // an invoice's review status changed to disputed
+	EventWebhookTest     WebhookEvent = "webhook.test"     // only sent by the test endpoint
+)
+
+// WebhookEvents lists every WebhookEvent.
+var WebhookEvents = []WebhookEvent{EventInvoiceCreated, EventInvoiceDisputed, EventWebhookTest}
+
+// Webhook posts signed JSON payloads to URL when subscribed events occur.
+type Webhook struct {
+	ID     int            `json:"id"`
+	Name   string         `json:"name"`
+	URL    string         `json:"url"`
+	Events []WebhookEvent `json:"events"`
+	// MinSubtotal limits invoice.created events to invoices with at least
+	// this subtotal
+	MinSubtotal *float64  `json:"min_subtotal"`
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type WebhooksResponse struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+type CreateWebhookRequest struct {
+	Name        string         `json:"name"`
+	URL         string         `json:"url"`
+	Events      []WebhookEvent `json:"events"`
+	MinSubtotal *float64       `json:"min_subtotal,omitempty"`
+}
+
+// CreatedWebhook is returned once when a webhook is created; Secret is the
+// HMAC-SHA256 signing key.
+type CreatedWebhook struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// WebhookPayload is the JSON body posted to webhook URLs.
+type WebhookPayload struct {
+	Event     WebhookEvent `json:"event"`
+	CreatedAt time.Time    `json:"created_at"`
+	Invoice   *Invoice     `json:"invoice,omitempty"`
+	// Review is set for invoice.disputed events
+	Review *InvoiceReview `json:"review,omitempty"`
+}
+
+// WebhookDeliveryStatus is the state of a webhook delivery.
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending   WebhookDeliveryStatus = "pending" // waiting for its first attempt or a retry
+	DeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	DeliveryFailed    WebhookDeliveryStatus = "failed" // gave up after the last retry
+)
+
+// WebhookDeliveryStatuses lists every WebhookDeliveryStatus.
+var WebhookDeliveryStatuses = []WebhookDeliveryStatus{DeliveryPending, DeliverySucceeded, DeliveryFailed}
+
+// WebhookDelivery is one entry in a webhook's delivery log.
+type WebhookDelivery struct {
+	ID             int                   `json:"id"`
+	WebhookID      int                   `json:"webhook_id"`
+	Event          WebhookEvent          `json:"event"`
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int                   `json:"attempts"`
+	ResponseStatus *int                  `json:"response_status"` // HTTP status of the last attempt
+	Error          string                `json:"error,omitempty"`
+	CreatedAt      time.Time             `json:"created_at"`
+	NextAttemptAt  *time.Time            `json:"next_attempt_at"`
+	DeliveredAt    *time.Time            `json:"delivered_at"`
+}
+
+type WebhookDeliveriesResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
+
+// StreamEventType is the SSE event name of an event sent on /api/events.
+type StreamEventType string
+
+const (
+	StreamInvoiceInserted StreamEventType = "invoice.inserted"
+	StreamInvoiceUpdated  StreamEventType = "invoice.updated"
+	StreamInvoiceRemoved  StreamEventType = "invoice.removed"
+	StreamHealthChanged   StreamEventType = "health.changed"
+	StreamReviewChanged   StreamEventType = "review.changed"
+	// StreamReset means events were missed, e.g. after a long disconnect or a
+	// server restart, so clients should reload their data.
+	StreamReset StreamEventType = "stream.reset"
+)
+
+// StreamEventTypes lists every StreamEventType.
+var StreamEventTypes = []StreamEventType{
+	StreamInvoiceInserted, StreamInvoiceUpdated, StreamInvoiceRemoved, StreamHealthChanged, StreamReviewChanged, StreamReset,
+}
+
+// StreamEvent is the data of every event sent on /api/events.
+type StreamEvent struct {
+	Type StreamEventType `json:"type"`
+	Time time.Time       `json:"time"`
+	// Invoice is set for invoice and review events; for removals it's the
+	// last known version. Previous is set for updates.
+	Invoice  *Invoice        `json:"invoice,omitempty"`
+	Previous *Invoice        `json:"previous,omitempty"`
+	Health   *HealthResponse `json:"health,omitempty"`
+	// Review is set for review.changed, with the status it replaced in
+	// PreviousStatus unless the invoice had not been reviewed
+	Review         *InvoiceReview `json:"review,omitempty"`
+	PreviousStatus *ReviewStatus  `json:"previous_status,omitempty"`
+}
+
+// SlowQuery summarizes the recorded runs of one Aptora query, with the
+// details of its slowest run.
+type SlowQuery struct {
+	QueryHash  string       `json:"query_hash"` // SHA-256 of the query text
+	Query      string       `json:"query"`
+	Runs       int          `json:"runs"`
+	TotalMS    int64        `json:"total_ms"`
+	MaxMS      int          `json:"max_ms"`
+	AvgMS      int          `json:"avg_ms"`
+	LastSeenAt time.Time    `json:"last_seen_at"`
+	Slowest    SlowQueryRun `json:"slowest"`
+}
+
+// SlowQueryRun is one recorded run of a slow Aptora query.
+type SlowQueryRun struct {
+	ID         int       `json:"id"`
+	Params     []string  `json:"params"`
+	DurationMS int       `json:"duration_ms"`
+	Rows       int       `json:"rows"`
+	Error      string    `json:"error,omitempty"`
+	Endpoint   string    `json:"endpoint,omitempty"` // route pattern; empty for background work
+	User       string    `json:"user,omitempty"`     // API key name, or "admin"; empty for browser requests
+	RequestID  string    `json:"request_id,omitempty"`
+	HasPlan    bool      `json:"has_plan"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+type SlowQueriesResponse struct {
+	Queries []SlowQuery `json:"queries"`
+}
+
+// LeaderboardPeriod is the current period a leaderboard covers, to date.
+type LeaderboardPeriod string
+
+const (
+	LeaderboardMonth   LeaderboardPeriod = "month"
+	LeaderboardQuarter LeaderboardPeriod = "quarter"
+	LeaderboardYear    LeaderboardPeriod = "year"
+)
+
+// LeaderboardPeriods lists every LeaderboardPeriod.
+var LeaderboardPeriods = []LeaderboardPeriod{LeaderboardMonth, LeaderboardQuarter, LeaderboardYear}
+
+// LeaderboardResponse ranks the active employees by revenue for the period
+// so far. The prior period is compared over the same number of days, so a
+// month on the 18th is compared with the 1st to the 18th of the month before.
+type LeaderboardResponse struct {
+	Period         LeaderboardPeriod  `json:"period"`
+	StartDate      string             `json:"start_date" format:"date"`
+	EndDate        string             `json:"end_date" format:"date"` // last day of the period
+	AsOf           string             `json:"as_of" format:"date"`
+	PriorStartDate string             `json:"prior_start_date" format:"date"`
+	PriorEndDate   string             `json:"prior_end_date" format:"date"`
+	Entries        []LeaderboardEntry `json:"entries"`
+}
+
+// LeaderboardEntry is one employee's standing. Goals are the sum of the
+// employee's monthly goals in the period, and are null, with no progress,
+// unless every month has one; the missing months fields count the months
+// without one. Gross profit is null unless the invoice cost column is
+// configured.
+type LeaderboardEntry struct {
+	Rank                         int      `json:"rank"`
+	EmployeeID                   int      `json:"employee_id"`
+	EmployeeName                 string   `json:"employee_name"`
+	InvoiceCount                 int      `json:"invoice_count"`
+	Revenue                      float64  `json:"revenue"`
+	RevenueGoal                  *float64 `json:"revenue_goal"`
+	RevenueGoalMissingMonths     int      `json:"revenue_goal_missing_months"`
+	GoalProgress                 *float64 `json:"goal_progress"` // revenue as a percentage of the goal
+	ProjectedRevenue             float64  `json:"projected_revenue"`
+	ProjectedProgress            *float64 `json:"projected_goal_progress"` // projected revenue as a percentage of the goal
+	GrossProfit                  *float64 `json:"gross_profit"`
+	GrossProfitGoal              *float64 `json:"gross_profit_goal"`
+	GrossProfitGoalMissingMonths int      `json:"gross_profit_goal_missing_months"`
+	GrossProfitProgress          *float64 `json:"gross_profit_goal_progress"` // gross profit as a percentage of the goal
+	ProjectedGrossProfit         *float64 `json:"projected_gross_profit"`
+	ProjectedGrossProfitProgress *float64 `json:"projected_gross_profit_goal_progress"` // projected gross profit as a percentage of the goal
+	PriorRevenue                 float64  `json:"prior_revenue"`
+	Change                       float64  `json:"change"`
+	ChangePercent                *float64 `json:"change_percent"` // null when there was no prior revenue
+}
+
+// SalesGoal is an employee's revenue and gross profit goals for a month.
+type SalesGoal struct {
+	EmployeeID      int       `json:"employee_id"`
+	Month           string    `json:"month"` // YYYY-MM
+	RevenueGoal     *float64  `json:"revenue_goal"`
+	GrossProfitGoal *float64  `json:"gross_profit_goal"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+type SalesGoalsResponse struct {
+	Goals []SalesGoal `json:"goals"`
+}
+
+// SetSalesGoalRequest sets an employee's goals for a month, replacing any
+// already set. Leaving both goals out removes them.
+type SetSalesGoalRequest struct {
+	EmployeeID      int      `json:"employee_id"`
+	Month           string   `json:"month"` // YYYY-MM
+	RevenueGoal     *float64 `json:"revenue_goal,omitempty"`
+	GrossProfitGoal *float64 `json:"gross_profit_goal,omitempty"`
+}
+
+// CompareBasis picks the period /api/invoices/compare compares against when
+// no comparison range is given.
+type CompareBasis string
+
+const (
+	// ComparePriorPeriod is the same number of days just before the range,
+	// or the same number of months when the range is whole months.
+	ComparePriorPeriod CompareBasis = "prior_period"
+	ComparePriorYear   CompareBasis = "prior_year"
+)
+
+// CompareBases lists every CompareBasis.
+var CompareBases = []CompareBasis{ComparePriorPeriod, ComparePriorYear}
+
+// DateRange is an inclusive range of days.
+type DateRange struct {
+	StartDate string `json:"start_date" format:"date"`
+	EndDate   string `json:"end_date" format:"date"`
+}
+
+// MetricChange compares a value between two periods.
+type MetricChange struct {
+	Current       float64  `json:"current"`
+	Previous      float64  `json:"previous"`
+	Change        float64  `json:"change"`
+	ChangePercent *float64 `json:"change_percent"` // null when the previous value is 0
+}
+
+// InvoiceMetrics compares invoice totals between two periods. Cost, gross
+// profit (subtotal less cost) and gross margin (gross profit as a percentage
+// of subtotal, 0 without a subtotal) are null unless the invoice cost column
+// is configured.
+type InvoiceMetrics struct {
+	Count              MetricChange  `json:"count"`
+	Subtotal           MetricChange  `json:"subtotal"`
+	Cost               *MetricChange `json:"cost"`
+	GrossProfit        *MetricChange `json:"gross_profit"`
+	GrossMarginPercent *MetricChange `json:"gross_margin_percent"` // change is in percentage points
+}
+
+// RepComparison is one sales rep's invoice totals in both periods.
+type RepComparison struct {
+	EmployeeName string `json:"employee_name"`
+	InvoiceMetrics
+}
+
+// InvoiceComparisonResponse compares invoices per sales rep between two
+// periods. Reps with invoices in either period are included.
+type InvoiceComparisonResponse struct {
+	Current  DateRange       `json:"current"`
+	Previous DateRange       `json:"previous"`
+	Reps     []RepComparison `json:"reps"`
+	Total    InvoiceMetrics  `json:"total"`
+}
+
+// WriteOffReason is why an invoice was detected as a write-off.
+type WriteOffReason string
+
+const (
+	WriteOffZeroSubtotal     WriteOffReason = "zero_subtotal"     // invoiced at no charge
+	WriteOffNegativeSubtotal WriteOffReason = "negative_subtotal" // credited back more than it charged
+	WriteOffCreditMemo       WriteOffReason = "credit_memo"       // credited in full by linked credit memos
+	WriteOffItem             WriteOffReason = "write_off_item"    // has a line with a write-off item code
+	WriteOffZeroPriceLine    WriteOffReason = "zero_price_line"   // has a line priced at zero
+)
+
+// WriteOffReasons lists every WriteOffReason, in order of precedence.
+var WriteOffReasons = []WriteOffReason{
+	WriteOffZeroSubtotal, WriteOffNegativeSubtotal, WriteOffCreditMemo, WriteOffItem, WriteOffZeroPriceLine,
+}
+
+// WriteOffTotal sums the write-offs with one reason.
+type WriteOffTotal struct {
+	Reason   WriteOffReason `json:"reason"`
+	Count    int            `json:"count"`
+	Subtotal float64        `json:"subtotal"`
+}
+
+// WriteOffRep is one sales rep's write-offs, in total and by reason.
+type WriteOffRep struct {
+	EmployeeName string          `json:"employee_name"`
+	Count        int             `json:"count"`
+	Subtotal     float64         `json:"subtotal"`
+	Reasons      []WriteOffTotal `json:"reasons"`
+}
+
+// WriteOffsResponse summarizes the write-offs in a date range by sales rep
+// and reason.
+type WriteOffsResponse struct {
+	StartDate string          `json:"start_date" format:"date"`
+	EndDate   string          `json:"end_date" format:"date"`
+	Count     int             `json:"count"`
+	Subtotal  float64         `json:"subtotal"`
+	Reasons   []WriteOffTotal `json:"reasons"`
+	Reps      []WriteOffRep   `json:"reps"`
+	// Rules lists the reasons being detected; the line and credit memo
+	// rules need their Aptora sources configured
+	Rules []WriteOffReason `json:"rules"`
+}
+
+// WriteOffItemCode is an Aptora item code that marks invoices with a line
+// for it as write-offs.
+type WriteOffItemCode struct {
+	ID          int       `json:"id"`
+	ItemCode    string    `json:"item_code"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type WriteOffItemCodesResponse struct {
+	ItemCodes []WriteOffItemCode `json:"item_codes"`
+	// Active is false while no invoice lines source is configured, so the
+	// item codes have no effect
+	Active bool `json:"active"`
+}
+
+type CreateWriteOffItemCodeRequest struct {
+	ItemCode    string `json:"item_code"`
+	Description string `json:"description,omitempty"`
+}
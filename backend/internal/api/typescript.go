@@ -0,0 +1,106 @@
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// TypeScript returns TypeScript declarations for every named type used by
+// Endpoints. The output is written to frontend/src/api/types.ts by cmd/apigen.
+func TypeScript() string {
+	g := &tsGen{decls: map[string]string{}}
+	g.typeRef(reflect.TypeOf(ErrorResponse{}))
+	g.typeRef(reflect.TypeOf(ProblemResponse{}))
+	for _, ep := range Endpoints {
+		if ep.Request != nil {
+			g.typeRef(reflect.TypeOf(ep.Request))
+		}
+		if ep.Response != nil {
+			g.typeRef(reflect.TypeOf(ep.Response))
+		}
+	}
+
+	names := make([]string, 0, len(g.decls))
+	for name := range g.decls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("// Code generated by cmd/apigen from backend/internal/api. DO NOT EDIT.\n")
+	b.WriteString("// Run `just generate-api-types` after changing the API types.\n")
+	for _, name := range names {
+		b.WriteString("\n")
+		b.WriteString(g.decls[name])
+	}
+	return b.String()
+}
+
+type tsGen struct {
+	decls map[string]string
+}
+
+// typeRef returns the TypeScript type for t, declaring named types as needed.
+func (g *tsGen) typeRef(t reflect.Type) string {
+	if t == timeType {
+		return "string"
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.typeRef(t.Elem()) + " | null"
+	case reflect.String:
+		if values, ok := enumValues[t]; ok {
+			if _, declared := g.decls[t.Name()]; !declared {
+				quoted := make([]string, len(values))
+				for i, v := range values {
+					quoted[i] = fmt.Sprintf("%q", v)
+				}
+				g.decls[t.Name()] = fmt.Sprintf("export type %s =\n  | %s;\n", t.Name(), strings.Join(quoted, "\n  | "))
+			}
+			return t.Name()
+		}
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		elem := g.typeRef(t.Elem())
+		if strings.Contains(elem, " ") {
+			elem = "(" + elem + ")"
+		}
+		return elem + "[]"
+	case reflect.Map:
+		return "Record<string, " + g.typeRef(t.Elem()) + ">"
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structBody(t, "")
+		}
+		if _, declared := g.decls[t.Name()]; !declared {
+			g.decls[t.Name()] = "" // placeholder for recursive types
+			g.decls[t.Name()] = "export interface " + t.Name() + " " + g.structBody(t, "") + "\n"
+		}
+		return t.Name()
+	}
+
+	return "unknown"
+}
+
+func (g *tsGen) structBody(t reflect.Type, indent string) string {
+	var b strings.Builder
+	b.WriteString("{\n")
+	for _, f := range jsonFields(t) {
+		optional := ""
+		if f.optional {
+			optional = "?"
+		}
+		fmt.Fprintf(&b, "%s  %s%s: %s;\n", indent, f.name, optional, g.typeRef(f.typ))
+	}
+	b.WriteString(indent + "}")
+	return b.String()
+}
@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scopes that can be granted to API keys. Each scope unlocks one group of routes.
+const (
+	ScopeEmployees = "employees:read"
+	ScopeInvoices  = "invoices:read"
+	ScopeReviews   = "invoices:review"
+)
+
+// Scopes lists every scope that can be granted to an API key.
+var Scopes = []string{ScopeEmployees, ScopeInvoices, ScopeReviews}
+
+// keyPrefix marks secrets as API keys, which makes them easy to recognize in
+// scripts and secret scanners.
+const keyPrefix = "apx_"
+
+var (
+	// ErrInvalidKey is returned when a key is unknown, revoked or expired.
+	ErrInvalidKey = errors.New("invalid API key")
+
+	// ErrNotFound is returned when an API key ID does not exist.
+	ErrNotFound = errors.New("API key not found")
+)
+
+// APIKey describes an API key. The secret itself is never stored; only its
+// SHA-256 hash is kept in the Extensions database.
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// HasScope reports whether the key was granted scope.
+func (k APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// IsAPIKey reports whether token looks like an API key secret.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, keyPrefix)
+}
+
+// ValidateScopes returns an error if any scope is unknown or none are given.
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return fmt.Errorf("unknown scope %q (valid scopes: %s)", scope, strings.Join(Scopes, ", "))
+		}
+	}
+	return nil
+}
+
+// CreateAPIKey generates a new API key and stores its hash. The returned
+// secret is only available at creation time.
+func CreateAPIKey(ctx context.Context, db *sql.DB, name string, scopes []string, expiresAt *time.Time) (APIKey, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return APIKey{}, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	secret := keyPrefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	key := APIKey{
+		Name:      name,
+		Prefix:    secret[:len(keyPrefix)+8],
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+	}
+
+	expires := sql.NullTime{}
+	if expiresAt != nil {
+		expires = sql.NullTime{Time: expiresAt.UTC(), Valid: true}
+	}
+
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO api_keys (name, key_prefix, key_hash, scopes, created_at, expires_at)
+		OUTPUT INSERTED.id
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6)`,
+		key.Name, key.Prefix, hashSecret(secret), strings.Join(scopes, ","), key.CreatedAt, expires,
+	).Scan(&key.ID)
+	if err != nil {
+		return APIKey{}, "", fmt.Errorf("failed to insert API key: %w", err)
+	}
+
+	return key, secret, nil
+}
+
+// ListAPIKeys returns all API keys, including revoked and expired ones.
+func ListAPIKeys(ctx context.Context, db *sql.DB) ([]APIKey, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, name, key_prefix, scopes, created_at, expires_at, last_used_at, revoked_at
+		FROM api_keys
+		ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read API keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey revokes a key. Revocation takes effect on the next request
+// since keys are checked against the database on every use.
+func RevokeAPIKey(ctx context.Context, db *sql.DB, id int) error {
+	res, err := db.ExecContext(ctx, `
+		UPDATE api_keys SET revoked_at = SYSUTCDATETIME()
+		WHERE id = @p1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	if n == 0 {
+		var exists int
+		err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM api_keys WHERE id = @p1`, id).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to look up API key: %w", err)
+		}
+		if exists == 0 {
+			return ErrNotFound
+		}
+	}
+
+	return nil
+}
+
+// AuthenticateAPIKey looks up an active key by its secret and records its use.
+func AuthenticateAPIKey(ctx context.Context, db *sql.DB, secret string) (APIKey, error) {
+	row := db.QueryRowContext(ctx, `
+		SELECT id, name, key_prefix, scopes, created_at, expires_at, last_used_at, revoked_at
+		FROM api_keys
+		WHERE key_hash = @p1`, hashSecret(secret))
+
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, ErrInvalidKey
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && !time.Now().Before(*key.ExpiresAt)) {
+		return APIKey{}, ErrInvalidKey
+	}
+
+	if _, err := db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = SYSUTCDATETIME() WHERE id = @p1`, key.ID); err != nil {
+		return APIKey{}, fmt.Errorf("failed to record API key use: %w", err)
+	}
+
+	return key, nil
+}
+
+// hashSecret returns the hex-encoded SHA-256 hash of an API key secret. A fast
+// hash is sufficient because secrets are 256-bit random values.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAPIKey(row scanner) (APIKey, error) {
+	var key APIKey
+	var scopes string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	if err := row.Scan(&key.ID, &key.Name, &key.Prefix, &scopes, &key.CreatedAt, &expiresAt, &lastUsedAt, &revokedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return APIKey{}, err
+		}
+		return APIKey{}, fmt.Errorf("failed to scan API key: %w", err)
+	}
+
+	key.Scopes = strings.Split(scopes, ",")
+	key.ExpiresAt = nullTimePtr(expiresAt)
+	key.LastUsedAt = nullTimePtr(lastUsedAt)
+	key.RevokedAt = nullTimePtr(revokedAt)
+	return key, nil
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password length limits. bcrypt only uses the first 72 bytes, so longer
+// passwords are refused rather than silently truncated.
+const (
+	MinPasswordLength = 12
+	maxPasswordBytes  = 72
+)
+
+var (
+	// ErrUserExists is returned when creating a user whose username is taken.
+	ErrUserExists = errors.New("user already exists")
+
+	// ErrUserNotFound is returned when a username does not exist.
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// User is a person who can sign in to the web UI. Passwords are stored as
+// bcrypt hashes in the Extensions database.
+type User struct {
+	ID                int
+	Username          string
+	IsAdmin           bool
+	CreatedAt         time.Time
+	PasswordChangedAt time.Time
+	DisabledAt        *time.Time
+}
+
+// ValidateUsername returns an error if username can't be used.
+func ValidateUsername(username string) error {
+	switch {
+	case username == "":
+		return errors.New("username is required")
+	case utf8.RuneCountInString(username) > 100:
+		return errors.New("username must be at most 100 characters")
+	case strings.TrimSpace(username) != username || strings.ContainsFunc(username, func(r rune) bool { return r < ' ' }):
+		return errors.New("username must not contain surrounding spaces or control characters")
+	}
+	return nil
+}
+
+// ValidatePassword returns an error if password is too short or too long.
+func ValidatePassword(password string) error {
+	switch {
+	case utf8.RuneCountInString(password) < MinPasswordLength:
+		return fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	case len(password) > maxPasswordBytes:
+		return fmt.Errorf("password must be at most %d bytes", maxPasswordBytes)
+	}
+	return nil
+}
+
+// CreateUser stores a new user with a bcrypt hash of password.
+func CreateUser(ctx context.Context, db *sql.DB, username, password string, admin bool) (User, error) {
+	if err := ValidateUsername(username); err != nil {
+		return User{}, err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+
+	var exists int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE username = @p1`, username).Scan(&exists); err != nil {
+		return User{}, fmt.Errorf("failed to look up user: %w", err)
+	}
+	if exists > 0 {
+		return User{}, ErrUserExists
+	}
+
+	now := time.Now().UTC()
+	user := User{Username: username, IsAdmin: admin, CreatedAt: now, PasswordChangedAt: now}
+	err = db.QueryRowContext(ctx, `
+		INSERT INTO users (username, password_hash, is_admin, created_at, password_changed_at)
+		OUTPUT INSERTED.id
+		VALUES (@p1, @p2, @p3, @p4, @p4)`,
+		username, hash, admin, now,
+	).Scan(&user.ID)
+	if err != nil {
+		return User{}, fmt.Errorf("failed to insert user: %w", err)
+	}
+
+	return user, nil
+}
+
+// SetPassword replaces a user's password.
+func SetPassword(ctx context.Context, db *sql.DB, username, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE users SET password_hash = @p2, password_changed_at = SYSUTCDATETIME()
+		WHERE username = @p1`, username, hash)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	return requireUser(res)
+}
+
+// DisableUser prevents a user from signing in. Disabling an already disabled
+// user keeps the original time.
+func DisableUser(ctx context.Context, db *sql.DB, username string) error {
+	res, err := db.ExecContext(ctx, `
+		UPDATE users SET disabled_at = COALESCE(disabled_at, SYSUTCDATETIME())
+		WHERE username = @p1`, username)
+	if err != nil {
+		return fmt.Errorf("failed to disable user: %w", err)
+	}
+	return requireUser(res)
+}
+
+// requireUser returns ErrUserNotFound if an update matched no user.
+func requireUser(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func hashPassword(password string) (string, error) {
+	if err := ValidatePassword(password); err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
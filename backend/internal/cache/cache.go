@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache is an in-process, size-bounded read-through cache with per-entry TTLs.
+// Concurrent loads for the same key are de-duplicated so that only one caller
+// hits the underlying data source while the others wait for its result.
+type Cache[V any] struct {
+	maxEntries int
+	now        func() time.Time
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	order    *list.List // front = most recently used
+	inflight map[string]*call[V]
+	gen      uint64 // incremented on Purge so in-flight loads don't repopulate stale data
+}
+
+type entry[V any] struct {
+	key       string
+	value     V
+	expiresAt time.Time
+}
+
+// call represents an in-flight load shared by concurrent callers.
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// LoadFunc loads the value for a cache miss and returns how long it may be cached.
+type LoadFunc[V any] func(ctx context.Context) (V, time.Duration, error)
+
+// New creates a cache holding at most maxEntries values. When the limit is
+// reached, the least recently used entry is evicted.
+func New[V any](maxEntries int) *Cache[V] {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+	return &Cache[V]{
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		inflight:   make(map[string]*call[V]),
+	}
+}
+
+// GetOrLoad returns the cached value for key, or calls load to populate it.
+// The returned bool reports whether the value was served from the cache.
+// Errors are returned to every waiting caller but are never cached.
+func (c *Cache[V]) GetOrLoad(ctx context.Context, key string, load LoadFunc[V]) (V, bool, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*entry[V])
+		if c.now().Before(e.expiresAt) {
+			c.order.MoveToFront(el)
+			c.mu.Unlock()
+			return e.value, true, nil
+		}
+		c.removeElement(el)
+	}
+
+	if cl, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		select {
+		case <-cl.done:
+			return cl.value, false, cl.err
+		case <-ctx.Done():
+			var zero V
+			return zero, false, ctx.Err()
+		}
+	}
+
+	cl := &call[V]{done: make(chan struct{})}
+	c.inflight[key] = cl
+	gen := c.gen
+	c.mu.Unlock()
+
+	// The load is shared between callers, so it must not be cancelled just
+	// because the first caller went away.
+	value, ttl, err := load(context.WithoutCancel(ctx))
+	cl.value, cl.err = value, err
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	if err == nil && ttl > 0 && gen == c.gen {
+		c.store(key, value, ttl)
+	}
+	c.mu.Unlock()
+	close(cl.done)
+
+	return value, false, err
+}
+
+// Purge removes every cached entry and returns how many were removed.
+func (c *Cache[V]) Purge() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.entries)
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+	c.gen++
+	return n
+}
+
+// Len returns the number of cached entries, including expired ones that
+// have not been evicted yet.
+func (c *Cache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// store inserts or replaces key. The caller must hold c.mu.
+func (c *Cache[V]) store(key string, value V, ttl time.Duration) {
+	if el, ok := c.entries[key]; ok {
+		c.removeElement(el)
+	}
+
+	el := c.order.PushFront(&entry[V]{
+		key:       key,
+		value:     value,
+		expiresAt: c.now().Add(ttl),
+	})
+	c.entries[key] = el
+
+	for c.order.Len() > c.maxEntries {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// removeElement drops an entry. The caller must hold c.mu.
+func (c *Cache[V]) removeElement(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*entry[V]).key)
+}
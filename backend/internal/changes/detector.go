@@ -0,0 +1,265 @@
+package changes
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/database"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/events"
+)
+
+// baselineState is the poller_state key holding when the first scan
+// completed. That scan records a baseline instead of reporting every invoice
+// as new; changes are only published once it is set. Aptora has no
+// modification times to scan from, so every scan reads the whole window.
+const baselineState = "changes.baseline"
+
+// snapshotBatch is how many snapshots one statement inserts or deletes,
+// keeping each statement under SQL Server's 2100 parameter limit.
+const snapshotBatch = 300
+
+// ScanFunc returns every invoice dated on or after since.
+type ScanFunc func(ctx context.Context, since time.Time) ([]api.Invoice, error)
+
+// Detector periodically scans recent invoices in Aptora and publishes what
+// was inserted, updated or removed since the previous scan. Aptora is
+// read-only, so instead of triggers it compares a content hash of each row
+// against the snapshot stored in the Extensions database.
+type Detector struct {
+	logger   *slog.Logger
+	db       *database.Manager
+	bus      *events.Bus
+	scan     ScanFunc
+	interval time.Duration
+	window   int // days of invoices to scan
+}
+
+// New returns a Detector that scans the last window days every interval. An
+// interval of zero disables it.
+func New(logger *slog.Logger, db *database.Manager, bus *events.Bus, scan ScanFunc, interval time.Duration, window int) *Detector {
+	return &Detector{
+		logger:   logger.With(slog.String("component", "change_detector")),
+		db:       db,
+		bus:      bus,
+		scan:     scan,
+		interval: interval,
+		window:   window,
+	}
+}
+
+// Run scans every interval until ctx is cancelled.
+func (d *Detector) Run(ctx context.Context) {
+	if d.interval <= 0 {
+		d.logger.Info("change detection disabled")
+		return
+	}
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		if d.db.ExtensionsDB() != nil && d.db.AptoraDB() != nil {
+			if err := d.scanOnce(ctx); err != nil && ctx.Err() == nil {
+				d.logger.Error("change scan failed", slog.Any("error", err))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// snapshot is the stored state of one invoice.
+type snapshot struct {
+	invoice api.Invoice
+	hash    string
+}
+
+func (d *Detector) scanOnce(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, d.interval)
+	defer cancel()
+	defer d.db.Hold()()
+	db := d.db.ExtensionsDB()
+
+	now := time.Now()
+	since := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, -d.window)
+
+	_, recorded, err := database.LoadState(ctx, db, baselineState)
+	if err != nil {
+		return err
+	}
+
+	current, err := d.scan(ctx, since)
+	if err != nil {
+		return err
+	}
+	stored, err := loadSnapshots(ctx, db, since)
+	if err != nil {
+		return err
+	}
+
+	var inserted, updated, removed []events.InvoiceChange
+	seen := make(map[int]bool, len(current))
+	for _, inv := range current {
+		seen[inv.Number] = true
+		prev, ok := stored[inv.Number]
+		switch {
+		case !ok:
+			inserted = append(inserted, events.InvoiceChange{Invoice: inv})
+		case prev.hash != contentHash(inv):
+			previous := prev.invoice
+			updated = append(updated, events.InvoiceChange{Invoice: inv, Previous: &previous})
+		}
+	}
+	for number, prev := range stored {
+		if !seen[number] {
+			removed = append(removed, events.InvoiceChange{Invoice: prev.invoice})
+		}
+	}
+
+	if err := saveSnapshots(ctx, db, inserted, updated, removed, since, now, !recorded); err != nil {
+		return err
+	}
+
+	if !recorded {
+		d.logger.Info("recorded change detection baseline", slog.Int("invoices", len(current)), slog.Int("window_days", d.window))
+		return nil
+	}
+
+	for _, c := range inserted {
+		d.bus.Publish(events.InvoiceInserted, c)
+	}
+	for _, c := range updated {
+		d.bus.Publish(events.InvoiceUpdated, c)
+	}
+	for _, c := range removed {
+		d.bus.Publish(events.InvoiceRemoved, c)
+	}
+
+	level := slog.LevelDebug
+	if len(inserted)+len(updated)+len(removed) > 0 {
+		level = slog.LevelInfo
+	}
+	d.logger.Log(ctx, level, "change scan complete",
+		slog.Int("scanned", len(current)),
+		slog.Int("inserted", len(inserted)),
+		slog.Int("updated", len(updated)),
+		slog.Int("removed", len(removed)),
+	)
+	return nil
+}
+
+// contentHash returns a hash of every column the detector tracks, so any
+// edit to a tracked column changes it.
+func contentHash(inv api.Invoice) string {
+	sum := sha256.Sum256([]byte(strconv.Itoa(inv.Number) + "\x1f" + inv.Date + "\x1f" + inv.EmployeeName + "\x1f" +
+		strconv.FormatFloat(inv.Subtotal, 'f', 4, 64)))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadSnapshots returns the stored invoices dated on or after since.
+func loadSnapshots(ctx context.Context, db *sql.DB, since time.Time) (map[int]snapshot, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT tran_no, tran_date, sales_rep, subtotal, content_hash
+		FROM invoice_snapshots
+		WHERE tran_date >= @p1`, since.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invoice snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	snapshots := map[int]snapshot{}
+	for rows.Next() {
+		var s snapshot
+		var date time.Time
+		if err := rows.Scan(&s.invoice.Number, &date, &s.invoice.EmployeeName, &s.invoice.Subtotal, &s.hash); err != nil {
+			return nil, fmt.Errorf("failed to scan invoice snapshot: %w", err)
+		}
+		s.invoice.Date = date.Format("2006-01-02")
+		snapshots[s.invoice.Number] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read invoice snapshots: %w", err)
+	}
+
+	return snapshots, nil
+}
+
+// saveSnapshots applies a scan's changes and drops snapshots that have aged
+// out of the window in one transaction, so a failed save is simply retried by
+// the next scan. recordBaseline also records that a baseline exists.
+func saveSnapshots(ctx context.Context, db *sql.DB, inserted, updated, removed []events.InvoiceChange, since, now time.Time, recordBaseline bool) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start snapshot transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for batch := range slices.Chunk(inserted, snapshotBatch) {
+		var values strings.Builder
+		args := make([]any, 0, len(batch)*6)
+		for i, c := range batch {
+			if i > 0 {
+				values.WriteString(", ")
+			}
+			n := len(args)
+			fmt.Fprintf(&values, "(@p%d, @p%d, @p%d, @p%d, @p%d, @p%d)", n+1, n+2, n+3, n+4, n+5, n+6)
+			args = append(args, c.Invoice.Number, c.Invoice.Date, c.Invoice.EmployeeName, c.Invoice.Subtotal, contentHash(c.Invoice), now.UTC())
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO invoice_snapshots (tran_no, tran_date, sales_rep, subtotal, content_hash, seen_at)
+			VALUES `+values.String(), args...)
+		if err != nil {
+			return fmt.Errorf("failed to insert invoice snapshots: %w", err)
+		}
+	}
+	for _, c := range updated {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE invoice_snapshots
+			SET tran_date = @p2, sales_rep = @p3, subtotal = @p4, content_hash = @p5, seen_at = @p6
+			WHERE tran_no = @p1`,
+			c.Invoice.Number, c.Invoice.Date, c.Invoice.EmployeeName, c.Invoice.Subtotal, contentHash(c.Invoice), now.UTC())
+		if err != nil {
+			return fmt.Errorf("failed to update invoice snapshot: %w", err)
+		}
+	}
+	for batch := range slices.Chunk(removed, snapshotBatch) {
+		params := make([]string, len(batch))
+		args := make([]any, len(batch))
+		for i, c := range batch {
+			params[i] = fmt.Sprintf("@p%d", i+1)
+			args[i] = c.Invoice.Number
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM invoice_snapshots WHERE tran_no IN (`+strings.Join(params, ", ")+`)`, args...)
+		if err != nil {
+			return fmt.Errorf("failed to delete invoice snapshots: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM invoice_snapshots WHERE tran_date < @p1`, since.Format("2006-01-02")); err != nil {
+		return fmt.Errorf("failed to prune invoice snapshots: %w", err)
+	}
+
+	if recordBaseline {
+		if err := database.SaveState(ctx, tx, baselineState, now.UTC().Format(time.RFC3339)); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit invoice snapshots: %w", err)
+	}
+	return nil
+}
@@ -1,42 +1,218 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/logging"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/ratelimit"
 )
 
+// rateLimitedRoutes lists the routes with a per-client rate limit, each
+// configurable through RATE_LIMIT_<ROUTE> (for example RATE_LIMIT_INVOICES=60:20).
+var rateLimitedRoutes = []string{"employees", "invoices", "leaderboard", "reports"}
+
+// defaultRateLimit allows 60 requests per minute with bursts of 20.
+var defaultRateLimit = ratelimit.Rate{PerMinute: 60, Burst: 20}
+
+// defaultQueryTimeouts is the time budget for each route's Aptora queries,
+// configurable through QUERY_TIMEOUT_<ROUTE> (for example
+// QUERY_TIMEOUT_REPORTS=1m).
+var defaultQueryTimeouts = map[string]time.Duration{
+	"employees":   10 * time.Second,
+	"invoices":    10 * time.Second,
+	"leaderboard": 10 * time.Second,
+	"reports":     30 * time.Second,
+}
+
+// DBSettings contains the connection settings for one database. Each
+// connection setting is read from <PREFIX>_DB_<SETTING> (for example
+// APTORA_DB_HOST) and falls back to the shared DB_<SETTING>.
+type DBSettings struct {
+	Host                   string
+	Port                   string // empty for a named instance found through SQL Server Browser
+	Instance               string // named instance; empty for the default instance
+	Encrypt                string // "disable", "false", "true" or "strict" - controls TLS encryption
+	TrustServerCertificate bool
+	CAFile                 string // PEM file of the CA that signed the server certificate
+	Auth                   string // "sql" or "ntlm" (Windows authentication)
+	Name                   string
+	User                   string
+	Password               string
+}
+
 // Settings contains all required configuration values for the backend server.
 type Settings struct {
-	DBHost               string
-	DBPort               string
-	DBEncrypt            string // "disable", "true", or "false" - controls TLS encryption for SQL Server
-	AptoraDBName         string
-	AptoraDBUser         string
-	AptoraDBPassword     string
-	ExtensionsDBName     string
-	ExtensionsDBUser     string
-	ExtensionsDBPassword string
+	AptoraDB     DBSettings // read-only connection
+	ExtensionsDB DBSettings // read-write connection
+
+	LogFormat string     // "text" or "json"
+	LogLevel  slog.Level // initial level; can be changed at runtime
+
+	// AdminToken is the bearer token required by /api/admin endpoints.
+	// When empty, the admin API is disabled.
+	AdminToken string
+
+	// Query cache settings for expensive Aptora queries
+	QueryCacheTTL           time.Duration // TTL for ranges that include the current month
+	QueryCacheHistoricalTTL time.Duration // TTL for ranges that end before the current month
+	QueryCacheMaxEntries    int
+
+	// RateLimits holds the per-client rate limit for each route name
+	RateLimits map[string]ratelimit.Rate
+
+	// QueryTimeouts holds the time budget for each route's Aptora queries
+	QueryTimeouts map[string]time.Duration
+
+	// Aptora views and columns beyond the invoice view, which differ between
+	// Aptora versions; each feature that reads one is disabled while unset.
+	// Invoice lines feed the zero-price and item code write-off rules, and
+	// linked credit memos the credit memo rule.
+	AptoraInvoiceLinesView          string
+	AptoraInvoiceLinesInvoiceColumn string
+	AptoraInvoiceLinesItemColumn    string
+	AptoraInvoiceLinesPriceColumn   string
+	AptoraCreditMemoType            string
+	AptoraCreditMemoInvoiceColumn   string
+	AptoraInvoiceCostColumn         string
+
+	// Global cap on concurrent Aptora queries, protecting the ERP's own performance
+	AptoraMaxConcurrentQueries int
+	AptoraQueryQueueSize       int           // queries allowed to wait for a free slot
+	AptoraQueryQueueTimeout    time.Duration // how long a query waits before being shed
+
+	// Aptora queries taking at least SlowQueryThreshold are recorded in the
+	// Extensions database; 0 disables the slow query log
+	SlowQueryThreshold   time.Duration
+	SlowQueryCapturePlan bool // also store each slow query's cached showplan XML
+
+	// Outgoing mail for scheduled reports. Scheduling is disabled when
+	// SMTPHost is empty.
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	SMTPSecurity string // "starttls", "tls" or "none"
+
+	// Change detection: how often to scan Aptora for inserted, updated and
+	// removed invoices (0 disables), and how many days back each scan covers
+	ChangeScanInterval   time.Duration
+	ChangeScanWindowDays int
+
+	// Cap on concurrent /api/events streams; each holds a connection and a
+	// bus subscription for as long as the client stays
+	MaxEventStreams int
+
+	// Overall deadline for a graceful shutdown
+	ShutdownTimeout time.Duration
 }
 
-// Load loads environment variables from the runtime environment. When a local
-// .env file is present (development mode), it is loaded automatically.
+// startupDotenv holds the .env file as first read by this process. The
+// systemd unit loads .env into the environment with EnvironmentFile=, which
+// only happens at start, so an environment value equal to the .env value at
+// startup is taken to come from .env and follows later edits to it.
+var startupDotenv struct {
+	sync.Once
+	values map[string]string
+}
+
+// Load loads settings from the runtime environment. When a local .env file is
+// present (development mode), it is read too, with the environment taking
+// precedence. Any variable may instead be given as <NAME>_FILE, the path of a
+// file holding the value, for use with systemd credentials. Load can be
+// called again to pick up changed files, including edits to .env when the
+// environment was loaded from it.
 func Load() (Settings, error) {
-	// Try to load .env file - check current directory first, then parent directory
-	// (for when running from backend/ subdirectory). If both fail, continue without
-	// .env (production may use actual environment variables).
-	if err := godotenv.Load(".env"); err != nil {
-		if err := godotenv.Load("../.env"); err != nil {
+	settings, _, err := LoadWithSources()
+	return settings, err
+}
+
+// Source describes the effective value of one variable and where it came
+// from.
+type Source struct {
+	Name   string
+	Value  string // redacted when the variable holds a secret
+	Origin string // "env", ".env", "file", "default" or "unset"
+}
+
+// LoadWithSources loads settings like Load and also reports the source of
+// each variable it read, in the order read. Sources are returned even when
+// the settings are invalid.
+func LoadWithSources() (Settings, []Source, error) {
+	// Try to read the .env file - check current directory first, then parent
+	// directory (for when running from backend/ subdirectory). If both fail,
+	// continue without .env (production may use actual environment variables).
+	// It is not loaded into the process environment, so a later Load sees
+	// edits to it.
+	dotenv, err := godotenv.Read(".env")
+	if err != nil {
+		if dotenv, err = godotenv.Read("../.env"); err != nil {
 			// Neither file exists - that's OK, we may be using actual environment variables
+			dotenv = map[string]string{}
 		}
 	}
+	startupDotenv.Do(func() { startupDotenv.values = dotenv })
+
+	invalid := []string{}
+
+	// resolve returns the value of k and its origin, reading the file named
+	// by k_FILE when k isn't set
+	resolve := func(k string) (string, string) {
+		env := func(k string) (string, string) {
+			if v := strings.TrimSpace(os.Getenv(k)); v != "" && v != strings.TrimSpace(startupDotenv.values[k]) {
+				return v, "env"
+			}
+			return strings.TrimSpace(dotenv[k]), ".env"
+		}
+		if v, origin := env(k); v != "" {
+			return v, origin
+		}
+		path, _ := env(k + "_FILE")
+		if path == "" {
+			return "", "unset"
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			invalid = append(invalid, k+"_FILE")
+			return "", "unset"
+		}
+		return strings.TrimSpace(string(b)), "file"
+	}
+
+	// Each variable is recorded once, when first read
+	sources := []Source{}
+	recorded := map[string]bool{}
+	record := func(k, v, origin string) {
+		if recorded[k] {
+			return
+		}
+		recorded[k] = true
+		sources = append(sources, Source{Name: k, Value: logging.RedactValue(k, v), Origin: origin})
+	}
+
+	lookup := func(k string) string {
+		v, origin := resolve(k)
+		if v != "" {
+			record(k, v, origin)
+		}
+		return v
+	}
 
 	missing := []string{}
 	get := func(k string) string {
-		v := strings.TrimSpace(os.Getenv(k))
+		v := lookup(k)
 		if v == "" {
+			record(k, "", "unset")
 			missing = append(missing, k)
 		}
 		return v
@@ -44,28 +220,268 @@ func Load() (Settings, error) {
 
 	// Optional getter with default value
 	getWithDefault := func(k, defaultVal string) string {
-		v := strings.TrimSpace(os.Getenv(k))
+		v := lookup(k)
 		if v == "" {
+			if defaultVal == "" {
+				record(k, "", "unset")
+			} else {
+				record(k, defaultVal, "default")
+			}
 			return defaultVal
 		}
 		return v
 	}
 
+	// Optional duration getter with default value
+	getDuration := func(k string, defaultVal time.Duration) time.Duration {
+		v := lookup(k)
+		if v == "" {
+			record(k, defaultVal.String(), "default")
+			return defaultVal
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			invalid = append(invalid, k)
+			return defaultVal
+		}
+		return d
+	}
+
+	// Optional integer getter with default value
+	getInt := func(k string, defaultVal int) int {
+		v := lookup(k)
+		if v == "" {
+			record(k, strconv.Itoa(defaultVal), "default")
+			return defaultVal
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			invalid = append(invalid, k)
+			return defaultVal
+		}
+		return n
+	}
+
+	// Optional boolean getter with default value
+	getBool := func(k string, defaultVal bool) bool {
+		v := lookup(k)
+		if v == "" {
+			record(k, strconv.FormatBool(defaultVal), "default")
+			return defaultVal
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			invalid = append(invalid, k)
+			return defaultVal
+		}
+		return b
+	}
+
+	// Connection setting for one database, falling back to the shared value
+	getShared := func(prefix, setting, defaultVal string) (string, string) {
+		k := prefix + "_DB_" + setting
+		if v, origin := resolve(k); v != "" {
+			record(k, v, origin)
+			return v, k
+		}
+		k = "DB_" + setting
+		return getWithDefault(k, defaultVal), k
+	}
+
+	getDB := func(prefix string) DBSettings {
+		db := DBSettings{
+			Name:     get(prefix + "_DB_NAME"),
+			User:     get(prefix + "_DB_USER"),
+			Password: get(prefix + "_DB_PASSWORD"),
+		}
+
+		var k string
+		if db.Host, k = getShared(prefix, "HOST", ""); db.Host == "" {
+			missing = append(missing, prefix+"_DB_HOST or DB_HOST")
+		}
+		db.Instance, _ = getShared(prefix, "INSTANCE", "")
+		// A named instance's port is looked up through SQL Server Browser
+		// unless one is given
+		defaultPort := "1433"
+		if db.Instance != "" {
+			defaultPort = ""
+		}
+		if db.Port, k = getShared(prefix, "PORT", defaultPort); db.Port != "" {
+			if n, err := strconv.Atoi(db.Port); err != nil || n < 1 || n > 65535 {
+				invalid = append(invalid, k)
+			}
+		}
+
+		if db.Encrypt, k = getShared(prefix, "ENCRYPT", "true"); !slices.Contains([]string{"disable", "false", "true", "strict"}, db.Encrypt) {
+			invalid = append(invalid, k)
+		}
+		trust, k := getShared(prefix, "TRUST_SERVER_CERTIFICATE", "false")
+		if b, err := strconv.ParseBool(trust); err != nil {
+			invalid = append(invalid, k)
+		} else {
+			db.TrustServerCertificate = b
+		}
+		if db.CAFile, k = getShared(prefix, "CA_FILE", ""); db.CAFile != "" {
+			if _, err := os.Stat(db.CAFile); err != nil {
+				invalid = append(invalid, k)
+			}
+		}
+
+		db.Auth, k = getShared(prefix, "AUTH", "sql")
+		switch db.Auth {
+		case "sql":
+		case "ntlm":
+			// NTLM needs the domain, as DOMAIN\user
+			if !strings.Contains(db.User, `\`) && db.User != "" {
+				invalid = append(invalid, prefix+"_DB_USER")
+			}
+		default:
+			invalid = append(invalid, k)
+		}
+
+		return db
+	}
+
 	settings := Settings{
-		DBHost:               get("DB_HOST"),
-		DBPort:               get("DB_PORT"),
-		DBEncrypt:            getWithDefault("DB_ENCRYPT", "true"),
-		AptoraDBName:         get("APTORA_DB_NAME"),
-		AptoraDBUser:         get("APTORA_DB_USER"),
-		AptoraDBPassword:     get("APTORA_DB_PASSWORD"),
-		ExtensionsDBName:     get("EXTENSIONS_DB_NAME"),
-		ExtensionsDBUser:     get("EXTENSIONS_DB_USER"),
-		ExtensionsDBPassword: get("EXTENSIONS_DB_PASSWORD"),
+		AptoraDB:     getDB("APTORA"),
+		ExtensionsDB: getDB("EXTENSIONS"),
+
+		AdminToken: getWithDefault("ADMIN_TOKEN", ""),
+
+		QueryCacheTTL:           getDuration("QUERY_CACHE_TTL", time.Minute),
+		QueryCacheHistoricalTTL: getDuration("QUERY_CACHE_HISTORICAL_TTL", time.Hour),
+		QueryCacheMaxEntries:    getInt("QUERY_CACHE_MAX_ENTRIES", 256),
+
+		RateLimits:    map[string]ratelimit.Rate{},
+		QueryTimeouts: map[string]time.Duration{},
+
+		AptoraInvoiceLinesView:          getWithDefault("APTORA_INVOICE_LINES_VIEW", ""),
+		AptoraInvoiceLinesInvoiceColumn: getWithDefault("APTORA_INVOICE_LINES_INVOICE_COLUMN", ""),
+		AptoraInvoiceLinesItemColumn:    getWithDefault("APTORA_INVOICE_LINES_ITEM_COLUMN", ""),
+		AptoraInvoiceLinesPriceColumn:   getWithDefault("APTORA_INVOICE_LINES_PRICE_COLUMN", ""),
+		AptoraCreditMemoType:            getWithDefault("APTORA_CREDIT_MEMO_TYPE", ""),
+		AptoraCreditMemoInvoiceColumn:   getWithDefault("APTORA_CREDIT_MEMO_INVOICE_COLUMN", ""),
+		AptoraInvoiceCostColumn:         getWithDefault("APTORA_INVOICE_COST_COLUMN", ""),
+
+		AptoraMaxConcurrentQueries: getInt("APTORA_MAX_CONCURRENT_QUERIES", 6),
+		AptoraQueryQueueSize:       getInt("APTORA_QUERY_QUEUE_SIZE", 20),
+		AptoraQueryQueueTimeout:    getDuration("APTORA_QUERY_QUEUE_TIMEOUT", 5*time.Second),
+
+		SlowQueryThreshold:   getDuration("SLOW_QUERY_THRESHOLD", 2*time.Second),
+		SlowQueryCapturePlan: getBool("SLOW_QUERY_CAPTURE_PLAN", false),
+
+		SMTPHost:     getWithDefault("SMTP_HOST", ""),
+		SMTPPort:     getInt("SMTP_PORT", 587),
+		SMTPUsername: getWithDefault("SMTP_USERNAME", ""),
+		SMTPPassword: getWithDefault("SMTP_PASSWORD", ""),
+		SMTPFrom:     getWithDefault("SMTP_FROM", ""),
+		SMTPSecurity: getWithDefault("SMTP_SECURITY", "starttls"),
+
+		ChangeScanInterval:   getDuration("CHANGE_SCAN_INTERVAL", 5*time.Minute),
+		ChangeScanWindowDays: getInt("CHANGE_SCAN_WINDOW_DAYS", 31),
+
+		MaxEventStreams: getInt("MAX_EVENT_STREAMS", 100),
+
+		ShutdownTimeout: getDuration("SHUTDOWN_TIMEOUT", 20*time.Second),
+	}
+
+	aptoraNames := []struct {
+		key, value string
+		required   bool
+	}{
+		{"APTORA_INVOICE_LINES_VIEW", settings.AptoraInvoiceLinesView, false},
+		{"APTORA_INVOICE_LINES_INVOICE_COLUMN", settings.AptoraInvoiceLinesInvoiceColumn, settings.AptoraInvoiceLinesView != ""},
+		{"APTORA_INVOICE_LINES_ITEM_COLUMN", settings.AptoraInvoiceLinesItemColumn, settings.AptoraInvoiceLinesView != ""},
+		{"APTORA_INVOICE_LINES_PRICE_COLUMN", settings.AptoraInvoiceLinesPriceColumn, settings.AptoraInvoiceLinesView != ""},
+		{"APTORA_CREDIT_MEMO_INVOICE_COLUMN", settings.AptoraCreditMemoInvoiceColumn, settings.AptoraCreditMemoType != ""},
+		{"APTORA_INVOICE_COST_COLUMN", settings.AptoraInvoiceCostColumn, false},
+	}
+	for _, n := range aptoraNames {
+		switch {
+		case n.value == "" && n.required:
+			missing = append(missing, n.key)
+		case n.value != "" && !validName(n.value):
+			invalid = append(invalid, n.key)
+		}
+	}
+
+	if settings.ChangeScanWindowDays < 1 {
+		invalid = append(invalid, "CHANGE_SCAN_WINDOW_DAYS")
+	}
+	if settings.MaxEventStreams < 1 {
+		invalid = append(invalid, "MAX_EVENT_STREAMS")
+	}
+	if settings.ShutdownTimeout <= 0 {
+		invalid = append(invalid, "SHUTDOWN_TIMEOUT")
+	}
+
+	if settings.SMTPHost != "" && settings.SMTPFrom == "" {
+		missing = append(missing, "SMTP_FROM")
+	}
+	switch settings.SMTPSecurity {
+	case "starttls", "tls", "none":
+	default:
+		invalid = append(invalid, "SMTP_SECURITY")
+	}
+
+	if format, err := logging.ParseFormat(getWithDefault("LOG_FORMAT", logging.FormatText)); err != nil {
+		invalid = append(invalid, "LOG_FORMAT")
+	} else {
+		settings.LogFormat = format
 	}
 
+	if level, err := logging.ParseLevel(getWithDefault("LOG_LEVEL", "info")); err != nil {
+		invalid = append(invalid, "LOG_LEVEL")
+	} else {
+		settings.LogLevel = level
+	}
+
+	for _, route := range rateLimitedRoutes {
+		k := "RATE_LIMIT_" + strings.ToUpper(route)
+		rate := defaultRateLimit
+		if v := lookup(k); v != "" {
+			parsed, err := ratelimit.ParseRate(v)
+			if err != nil {
+				invalid = append(invalid, k)
+			}
+			rate = parsed
+		} else {
+			record(k, fmt.Sprintf("%d:%d", rate.PerMinute, rate.Burst), "default")
+		}
+		settings.RateLimits[route] = rate
+	}
+
+	for _, route := range slices.Sorted(maps.Keys(defaultQueryTimeouts)) {
+		k := "QUERY_TIMEOUT_" + strings.ToUpper(route)
+		timeout := getDuration(k, defaultQueryTimeouts[route])
+		if timeout <= 0 {
+			invalid = append(invalid, k)
+		}
+		settings.QueryTimeouts[route] = timeout
+	}
+
+	// Only names are reported, never values, as they may be secrets
+	var errs []error
 	if len(missing) > 0 {
-		return Settings{}, fmt.Errorf("missing required env vars: %s", strings.Join(missing, ", "))
+		errs = append(errs, fmt.Errorf("missing required env vars: %s", strings.Join(missing, ", ")))
+	}
+	if len(invalid) > 0 {
+		errs = append(errs, fmt.Errorf("invalid env vars: %s", strings.Join(invalid, ", ")))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return Settings{}, sources, err
 	}
 
-	return settings, nil
+	return settings, sources, nil
+}
+
+// validName reports whether name can be used as an Aptora view or column
+// name: one or more dot-separated parts, none of them empty or padded.
+func validName(name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		if part == "" || strings.TrimSpace(part) != part || strings.ContainsAny(part, "\"[]\x00") {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+const testDotenv = `DB_HOST=sql.example.com
+APTORA_DB_NAME=Aptora
+APTORA_DB_USER=reader
+EXTENSIONS_DB_NAME=AptoraExtensions
+EXTENSIONS_DB_USER=writer
+EXTENSIONS_DB_PASSWORD=writer-password
+`
+
+// TestReloadFollowsDotenvEdits loads the settings the way the systemd unit
+// runs the server, with .env also loaded into the environment, and checks
+// that a reload after editing .env sees the edit.
+func TestReloadFollowsDotenvEdits(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	startupDotenv.Once, startupDotenv.values = sync.Once{}, nil
+
+	writeDotenv := func(extra string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, ".env"), []byte(testDotenv+extra), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeDotenv("APTORA_DB_PASSWORD=old-password\n")
+	t.Setenv("APTORA_DB_PASSWORD", "old-password")
+	t.Setenv("DB_PORT", "1444") // set outside .env
+
+	settings, err := Load()
+	if err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if settings.AptoraDB.Password != "old-password" {
+		t.Fatalf("password at startup = %q", settings.AptoraDB.Password)
+	}
+
+	writeDotenv("APTORA_DB_PASSWORD=new-password\nDB_PORT=1433\n")
+	settings, err = Load()
+	if err != nil {
+		t.Fatalf("reload = %v", err)
+	}
+	if settings.AptoraDB.Password != "new-password" {
+		t.Errorf("password after editing .env = %q, want new-password", settings.AptoraDB.Password)
+	}
+	if settings.AptoraDB.Port != "1444" {
+		t.Errorf("port = %q, want the environment's 1444", settings.AptoraDB.Port)
+	}
+
+	// Moving the password to a file takes it out of .env
+	secret := filepath.Join(dir, "password")
+	if err := os.WriteFile(secret, []byte("file-password\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	writeDotenv("APTORA_DB_PASSWORD_FILE=" + secret + "\n")
+	_, sources, err := LoadWithSources()
+	if err != nil {
+		t.Fatalf("reload = %v", err)
+	}
+	for _, src := range sources {
+		if src.Name == "APTORA_DB_PASSWORD" && src.Origin != "file" {
+			t.Errorf("password comes from %s, want file", src.Origin)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ConnCheck is the outcome of checking one database connection.
+type ConnCheck struct {
+	Database string // "Aptora" or "Extensions"
+	Err      error  // nil if the connection works; never contains secrets
+}
+
+// Check connects to each database once with the manager's settings, without
+// starting the manager or changing either database. Besides connecting, it
+// verifies that each connection lands on the configured database and that
+// the Aptora login is read-only.
+func (m *Manager) Check(ctx context.Context) []ConnCheck {
+	cfg := m.config()
+
+	check := func(name string, c ConnConfig, readOnly bool) ConnCheck {
+		err := m.checkConn(ctx, c, readOnly)
+		if err != nil {
+			err = errors.New(cfg.redact(err.Error()))
+		}
+		return ConnCheck{Database: name, Err: err}
+	}
+
+	return []ConnCheck{
+		check("Aptora", cfg.Aptora, true),
+		check("Extensions", cfg.Extensions, false),
+	}
+}
+
+func (m *Manager) checkConn(ctx context.Context, c ConnConfig, readOnly bool) error {
+	db, err := sql.Open("sqlserver", c.connString(readOnly))
+	if err != nil {
+		return fmt.Errorf("failed to open: %w", err)
+	}
+	defer db.Close()
+
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	return m.checkDB(ctx, db, c.Database, readOnly)
+}
+
+// checkDB verifies that db is the expected database, and with readOnly that
+// it refuses writes.
+func (m *Manager) checkDB(ctx context.Context, db *sql.DB, expectedDBName string, readOnly bool) error {
+	var name string
+	if err := db.QueryRowContext(ctx, "SELECT DB_NAME()").Scan(&name); err != nil {
+		return fmt.Errorf("failed to verify database name: %w", err)
+	}
+	if err := checkDatabaseName(name, expectedDBName); err != nil {
+		return err
+	}
+
+	if readOnly {
+		if err := m.verifyReadOnly(ctx, db); err != nil {
+			return fmt.Errorf("failed to verify read-only mode: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// checkDatabaseName returns an error unless actual names the expected
+// database. SQL Server compares database names case-insensitively, so this
+// does too; config check and startup both use it, so they always agree.
+func checkDatabaseName(actual, expected string) error {
+	if !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("connected to database %q but expected %q", actual, expected)
+	}
+	return nil
+}
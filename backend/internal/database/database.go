@@ -3,158 +3,437 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/lifecycle"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/logging"
 	_ "github.com/microsoft/go-mssqldb"
 )
 
 // Manager handles connections to both the Aptora database (read-only)
 // and the Extensions database (read-write).
 type Manager struct {
-	logger *slog.Logger
+	logger  *slog.Logger
+	cfg     Config
+	workers *lifecycle.Group
 
 	aptoraDB     *sql.DB
+	aptoraGuard  *ReadOnlyDB
 	extensionsDB *sql.DB
+	users        *poolUsers // holders of the current pools
+
+	reload chan struct{} // signals connectLoop to reconnect with new settings
+
+	observer QueryObserver
 
 	mu      sync.RWMutex
 	healthy bool
 	errMsg  string
+	stopped bool
+}
+
+// poolRetireDelay is the longest pools replaced by Reload stay open while
+// someone still holds them.
+const poolRetireDelay = time.Minute
+
+// poolUsers counts the holders of one generation of pools, so that replaced
+// pools can be closed as soon as the last of them is done. It is guarded by
+// Manager.mu.
+type poolUsers struct {
+	n       int
+	retired bool
+	idle    chan struct{} // closed once retired with no holders left
+}
+
+func newPoolUsers() *poolUsers {
+	return &poolUsers{idle: make(chan struct{})}
 }
 
-// Config contains the database connection parameters.
+// Config contains the database connection parameters. The two databases
+// may live on different SQL Server instances.
 type Config struct {
-	Host                 string
-	Port                 string
-	Encrypt              string // "disable", "true", or "false" - controls TLS encryption
-	AptoraDBName         string
-	AptoraDBUser         string
-	AptoraDBPassword     string
-	ExtensionsDBName     string
-	ExtensionsDBUser     string
-	ExtensionsDBPassword string
+	Aptora     ConnConfig
+	Extensions ConnConfig
 }
 
-// NewManager creates a new database manager and starts attempting connections.
+// ConnConfig contains the connection parameters for one database.
+type ConnConfig struct {
+	Host     string
+	Port     string // empty to look up a named instance's port through SQL Server Browser
+	Instance string // named instance, e.g. "SQLEXPRESS"; empty for the default instance
+	Database string
+	User     string // DOMAIN\user for Windows authentication
+	Password string
+
+	Encrypt                string // "disable", "false", "true" or "strict" - controls TLS encryption
+	TrustServerCertificate bool   // skip verifying the server certificate
+	CAFile                 string // PEM file of the CA that signed the server certificate
+	WindowsAuth            bool   // log in with NTLM instead of a SQL Server login
+}
+
+// connString returns the go-mssqldb URL for c. A URL is used rather than the
+// key=value format so passwords may contain any character.
+func (c ConnConfig) connString(readOnly bool) string {
+	host := c.Host
+	if c.Port != "" {
+		host = net.JoinHostPort(c.Host, c.Port)
+	}
+
+	query := url.Values{}
+	query.Set("database", c.Database)
+	query.Set("encrypt", c.Encrypt)
+	query.Set("app name", "aptora-extensions")
+	if readOnly {
+		query.Set("ApplicationIntent", "ReadOnly")
+	}
+	if c.TrustServerCertificate {
+		query.Set("TrustServerCertificate", "true")
+	}
+	if c.CAFile != "" {
+		query.Set("certificate", c.CAFile)
+	}
+	if c.WindowsAuth {
+		query.Set("authenticator", "ntlm")
+	}
+
+	u := &url.URL{
+		Scheme:   "sqlserver",
+		User:     url.UserPassword(c.User, c.Password),
+		Host:     host,
+		Path:     c.Instance,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// NewManager creates a new database manager. Call Start to connect.
 func NewManager(logger *slog.Logger, cfg Config) *Manager {
-	m := &Manager{
+	return &Manager{
 		logger:  logger,
+		cfg:     cfg,
+		reload:  make(chan struct{}, 1),
+		users:   newPoolUsers(),
 		healthy: false,
 	}
+}
 
-	// Start connection attempts in background
-	go m.connectLoop(cfg)
+// Hold marks the current pools as in use until the returned function is
+// called. Pools replaced by Reload are closed once nobody holds them, or
+// after poolRetireDelay at the latest. Call Hold before fetching the pools
+// with AptoraDB or ExtensionsDB, and release them once done with them.
+// Releasing more than once has no effect.
+func (m *Manager) Hold() (release func()) {
+	m.mu.Lock()
+	users := m.users
+	users.n++
+	m.mu.Unlock()
 
-	return m
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if users.n--; users.n == 0 && users.retired {
+				close(users.idle)
+			}
+		})
+	}
+}
+
+// SetQueryObserver registers fn to be called after every Aptora query. It
+// must be called before Start or Connect.
+func (m *Manager) SetQueryObserver(fn QueryObserver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observer = fn
+}
+
+// Reload replaces the connection settings, for example after a password
+// change, and rebuilds both pools with them in the background. Until the new
+// pools connect, the old ones keep serving; if they fail to connect, the old
+// ones are kept and the failure is logged.
+func (m *Manager) Reload(cfg Config) {
+	m.mu.Lock()
+	m.cfg = cfg
+	m.mu.Unlock()
+
+	select {
+	case m.reload <- struct{}{}:
+	default:
+		// A reload is already pending and will use the new settings
+	}
+}
+
+func (m *Manager) config() Config {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cfg
+}
+
+// Start begins connecting to both databases in the background, retrying until
+// it succeeds. Connection attempts stop when ctx is cancelled or Stop is
+// called.
+func (m *Manager) Start(ctx context.Context) {
+	m.workers = lifecycle.NewGroup(ctx, m.logger)
+	m.workers.Go("database_connect", m.connectLoop)
+}
+
+// Connect connects to both databases once, for command-line tools that
+// don't call Start. Call Stop to close the connections.
+func (m *Manager) Connect(ctx context.Context) error {
+	if errMsg := m.connect(ctx, m.config()); errMsg != "" {
+		return errors.New(errMsg)
+	}
+	return nil
+}
+
+// ConnectExtensions opens a pool for the Extensions database alone and
+// brings its schema up to date. It does not touch Aptora and is independent
+// of the manager's own pools; the caller must close the returned pool.
+func (m *Manager) ConnectExtensions(ctx context.Context) (*sql.DB, error) {
+	cfg := m.config()
+
+	db, err := sql.Open("sqlserver", cfg.Extensions.connString(false))
+	if err != nil {
+		return nil, errors.New(cfg.redact(fmt.Sprintf("failed to open Extensions database: %v", err)))
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, errors.New(cfg.redact(fmt.Sprintf("failed to ping Extensions database: %v", err)))
+	}
+	if err := m.initializeExtensionsSchema(ctx, db, cfg.Extensions.Database); err != nil {
+		db.Close()
+		return nil, errors.New(cfg.redact(fmt.Sprintf("failed to initialize Extensions schema: %v", err)))
+	}
+	return db, nil
+}
+
+// Stop cancels any connection attempt in progress, waits for it to finish
+// and then closes the Aptora pool followed by the Extensions pool. If ctx
+// expires first, the pools are closed anyway.
+func (m *Manager) Stop(ctx context.Context) error {
+	var errs []error
+	if m.workers != nil {
+		if err := m.workers.Stop(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stopped = true
+	m.healthy = false
+	m.errMsg = "shutting down"
+
+	if m.aptoraDB != nil {
+		if err := m.aptoraDB.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close Aptora database: %w", err))
+		}
+		m.aptoraDB = nil
+		m.aptoraGuard = nil
+	}
+	if m.extensionsDB != nil {
+		if err := m.extensionsDB.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close Extensions database: %w", err))
+		}
+		m.extensionsDB = nil
+	}
+
+	m.logger.Info("closed database connections")
+	return errors.Join(errs...)
 }
 
 // connectLoop attempts to connect to both databases, retrying every 30 seconds on failure.
-func (m *Manager) connectLoop(cfg Config) {
+func (m *Manager) connectLoop(ctx context.Context) {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
 	// Try immediately on startup
-	m.tryConnect(cfg)
+	m.tryConnect(ctx)
 
 	// Retry every 30 seconds if unhealthy
-	for range ticker.C {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-m.reload:
+			m.reconnect(ctx)
+			continue
+		}
+
 		m.mu.RLock()
 		healthy := m.healthy
 		m.mu.RUnlock()
 
 		if !healthy {
-			m.tryConnect(cfg)
+			m.tryConnect(ctx)
 		}
 	}
 }
 
-// tryConnect attempts to establish connections to both databases.
-func (m *Manager) tryConnect(cfg Config) {
+// tryConnect attempts to establish connections to both databases, marking the
+// manager unhealthy if it fails.
+func (m *Manager) tryConnect(ctx context.Context) {
 	m.logger.Info("attempting to connect to databases")
 
-	aptoraConnStr := fmt.Sprintf(
-		"server=%s;port=%s;database=%s;user id=%s;password=%s;encrypt=%s;ApplicationIntent=ReadOnly",
-		cfg.Host, cfg.Port, cfg.AptoraDBName, cfg.AptoraDBUser, cfg.AptoraDBPassword, cfg.Encrypt,
-	)
-	extensionsConnStr := fmt.Sprintf(
-		"server=%s;port=%s;database=%s;user id=%s;password=%s;encrypt=%s",
-		cfg.Host, cfg.Port, cfg.ExtensionsDBName, cfg.ExtensionsDBUser, cfg.ExtensionsDBPassword, cfg.Encrypt,
-	)
+	if errMsg := m.connect(ctx, m.config()); errMsg != "" {
+		m.setUnhealthy(errMsg)
+	}
+}
+
+// reconnect rebuilds both pools with the current settings. If that fails
+// while the existing pools are healthy, they are kept.
+func (m *Manager) reconnect(ctx context.Context) {
+	m.logger.Info("reconnecting to databases with reloaded settings")
+
+	errMsg := m.connect(ctx, m.config())
+	if errMsg == "" {
+		return
+	}
+
+	m.mu.RLock()
+	healthy := m.healthy
+	m.mu.RUnlock()
+	if !healthy {
+		m.setUnhealthy(errMsg)
+		return
+	}
+	m.logger.Error("failed to reconnect with reloaded settings - keeping existing connections",
+		slog.String("error", errMsg))
+}
+
+// connect opens, checks and installs new pools for both databases. On
+// failure it returns a description of the problem with any secrets removed.
+func (m *Manager) connect(ctx context.Context, cfg Config) string {
+	aptoraDB, extensionsDB, errMsg := m.open(ctx, cfg)
+	if errMsg != "" {
+		return cfg.redact(errMsg)
+	}
+
+	if m.install(aptoraDB, extensionsDB) {
+		m.logger.Info("successfully connected to databases")
+	}
+	return ""
+}
+
+// install makes new pools current, retiring the ones they replace. It
+// returns false, closing the new pools, if the manager has been stopped.
+func (m *Manager) install(aptoraDB, extensionsDB *sql.DB) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stopped {
+		// Stop gave up waiting for this attempt and has already closed the
+		// pools
+		aptoraDB.Close()
+		extensionsDB.Close()
+		return false
+	}
+	if m.aptoraDB != nil {
+		m.retire(m.users, m.aptoraDB, m.extensionsDB)
+	}
+
+	m.aptoraDB = aptoraDB
+	m.aptoraGuard = newReadOnlyDB(aptoraDB, m.logger, m.observer)
+	m.extensionsDB = extensionsDB
+	m.users = newPoolUsers()
+	m.healthy = true
+	m.errMsg = ""
+	return true
+}
+
+// retire closes replaced pools once their last holder releases them, after
+// poolRetireDelay at the latest, or when the manager stops. The caller must
+// hold m.mu.
+func (m *Manager) retire(users *poolUsers, pools ...*sql.DB) {
+	users.retired = true
+	if users.n == 0 {
+		close(users.idle)
+	}
+
+	m.workers.Go("database_retire", func(ctx context.Context) {
+		timer := time.NewTimer(poolRetireDelay)
+		defer timer.Stop()
+
+		select {
+		case <-users.idle:
+		case <-timer.C:
+			m.logger.Warn("closing replaced database connections that are still in use",
+				slog.Duration("delay", poolRetireDelay))
+		case <-ctx.Done():
+		}
+		for _, db := range pools {
+			db.Close()
+		}
+	})
+}
+
+// open opens and checks a pool for each database. The pools are returned
+// only if both are usable.
+func (m *Manager) open(ctx context.Context, cfg Config) (*sql.DB, *sql.DB, string) {
+	aptoraConnStr := cfg.Aptora.connString(true)
+	extensionsConnStr := cfg.Extensions.connString(false)
 
 	aptoraDB, err := sql.Open("sqlserver", aptoraConnStr)
 	if err != nil {
-		m.setUnhealthy(fmt.Sprintf("failed to open Aptora database: %v", err))
-		return
+		return nil, nil, fmt.Sprintf("failed to open Aptora database: %v", err)
 	}
 
 	aptoraDB.SetMaxOpenConns(10)
 	aptoraDB.SetMaxIdleConns(5)
 	aptoraDB.SetConnMaxLifetime(5 * time.Minute)
 
-	if err := aptoraDB.Ping(); err != nil {
+	if err := aptoraDB.PingContext(ctx); err != nil {
 		aptoraDB.Close()
-		m.setUnhealthy(fmt.Sprintf("failed to ping Aptora database: %v", err))
-		return
+		return nil, nil, fmt.Sprintf("failed to ping Aptora database: %v", err)
 	}
 
 	// Additional safety: verify read-only mode on Aptora connection
-	if err := m.verifyReadOnly(aptoraDB); err != nil {
+	if err := m.verifyReadOnly(ctx, aptoraDB); err != nil {
 		aptoraDB.Close()
-		m.setUnhealthy(fmt.Sprintf("failed to verify read-only mode for Aptora database: %v", err))
-		return
+		return nil, nil, fmt.Sprintf("failed to verify read-only mode for Aptora database: %v", err)
 	}
 
 	extensionsDB, err := sql.Open("sqlserver", extensionsConnStr)
 	if err != nil {
 		aptoraDB.Close()
-		m.setUnhealthy(fmt.Sprintf("failed to open Extensions database: %v", err))
-		return
+		return nil, nil, fmt.Sprintf("failed to open Extensions database: %v", err)
 	}
 
 	extensionsDB.SetMaxOpenConns(10)
 	extensionsDB.SetMaxIdleConns(5)
 	extensionsDB.SetConnMaxLifetime(5 * time.Minute)
 
-	if err := extensionsDB.Ping(); err != nil {
+	if err := extensionsDB.PingContext(ctx); err != nil {
 		aptoraDB.Close()
 		extensionsDB.Close()
-		m.setUnhealthy(fmt.Sprintf("failed to ping Extensions database: %v", err))
-		return
+		return nil, nil, fmt.Sprintf("failed to ping Extensions database: %v", err)
 	}
 
 	// Initialize Extensions database schema and health check
-	if err := m.initializeExtensionsSchema(extensionsDB, cfg.ExtensionsDBName); err != nil {
+	if err := m.initializeExtensionsSchema(ctx, extensionsDB, cfg.Extensions.Database); err != nil {
 		aptoraDB.Close()
 		extensionsDB.Close()
-		m.setUnhealthy(fmt.Sprintf("failed to initialize Extensions schema: %v", err))
-		return
+		return nil, nil, fmt.Sprintf("failed to initialize Extensions schema: %v", err)
 	}
 
-	// Close old connections if they exist
-	m.mu.Lock()
-	if m.aptoraDB != nil {
-		m.aptoraDB.Close()
-	}
-	if m.extensionsDB != nil {
-		m.extensionsDB.Close()
-	}
-
-	m.aptoraDB = aptoraDB
-	m.extensionsDB = extensionsDB
-	m.healthy = true
-	m.errMsg = ""
-	m.mu.Unlock()
-
-	m.logger.Info("successfully connected to databases")
+	return aptoraDB, extensionsDB, ""
 }
 
-// initializeExtensionsSchema creates the health_check table if it doesn't exist
-// and inserts a test row. It verifies the database name to ensure we only
+// initializeExtensionsSchema creates any missing tables and inserts a test row
+// into health_check. It verifies the database name to ensure we only
 // run schema initialization on the Extensions database (never on Aptora).
-func (m *Manager) initializeExtensionsSchema(db *sql.DB, expectedDBName string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (m *Manager) initializeExtensionsSchema(ctx context.Context, db *sql.DB, expectedDBName string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	// Verify we're connected to the Extensions database
@@ -163,20 +442,15 @@ func (m *Manager) initializeExtensionsSchema(db *sql.DB, expectedDBName string)
 		return fmt.Errorf("failed to verify database name: %w", err)
 	}
 
-	if actualDBName != expectedDBName {
-		return fmt.Errorf("safety check failed: expected Extensions database %q but connected to %q - refusing to initialize schema", expectedDBName, actualDBName)
+	if err := checkDatabaseName(actualDBName, expectedDBName); err != nil {
+		return fmt.Errorf("safety check failed: %w - refusing to initialize schema", err)
 	}
 
-	// Create health_check table if not exists
-	createTableSQL := `
-	IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='health_check' AND xtype='U')
-	CREATE TABLE health_check (
-		id INT IDENTITY(1,1) PRIMARY KEY,
-		timestamp DATETIME2 NOT NULL
-	)`
-
-	if _, err := db.ExecContext(ctx, createTableSQL); err != nil {
-		return fmt.Errorf("failed to create health_check table: %w", err)
+	// Create tables that don't exist yet
+	for _, stmt := range schemaStatements {
+		if _, err := db.ExecContext(ctx, stmt.sql); err != nil {
+			return fmt.Errorf("failed to create %s table: %w", stmt.table, err)
+		}
 	}
 
 	// Insert test row
@@ -192,8 +466,8 @@ func (m *Manager) initializeExtensionsSchema(db *sql.DB, expectedDBName string)
 
 // verifyReadOnly attempts to perform a write operation to verify the connection
 // is truly read-only. This provides defense-in-depth protection.
-func (m *Manager) verifyReadOnly(db *sql.DB) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (m *Manager) verifyReadOnly(ctx context.Context, db *sql.DB) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	// Try to create a permanent table - this should fail on read-only connection.
@@ -203,6 +477,10 @@ func (m *Manager) verifyReadOnly(db *sql.DB) error {
 	_, err := db.ExecContext(ctx, testSQL)
 
 	if err != nil {
+		// A cancelled or timed-out attempt proves nothing
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		// Good! Write operation failed, connection is read-only
 		m.logger.Info("verified read-only access to Aptora database")
 		return nil
@@ -213,9 +491,27 @@ func (m *Manager) verifyReadOnly(db *sql.DB) error {
 	return fmt.Errorf("connection is NOT read-only - write operations are allowed")
 }
 
+// redact removes the passwords in c, and anything else that looks like a
+// secret, from msg. Driver errors can quote parts of the connection string.
+func (c Config) redact(msg string) string {
+	for _, password := range []string{c.Aptora.Password, c.Extensions.Password} {
+		if password == "" {
+			continue
+		}
+		for _, form := range []string{password, url.QueryEscape(password), url.PathEscape(password)} {
+			msg = strings.ReplaceAll(msg, form, "[REDACTED]")
+		}
+	}
+	return logging.RedactString(msg)
+}
+
 // setUnhealthy marks the manager as unhealthy with an error message.
 func (m *Manager) setUnhealthy(errMsg string) {
 	m.mu.Lock()
+	if m.stopped {
+		m.mu.Unlock()
+		return
+	}
 	m.healthy = false
 	m.errMsg = errMsg
 	m.mu.Unlock()
@@ -230,12 +526,12 @@ func (m *Manager) IsHealthy() (bool, string) {
 	return m.healthy, m.errMsg
 }
 
-// AptoraDB returns the Aptora database connection (read-only).
-// Returns nil if not connected.
-func (m *Manager) AptoraDB() *sql.DB {
+// AptoraDB returns the Aptora database connection, which only accepts
+// read-only queries. Returns nil if not connected.
+func (m *Manager) AptoraDB() *ReadOnlyDB {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return m.aptoraDB
+	return m.aptoraGuard
 }
 
 // ExtensionsDB returns the Extensions database connection (read-write).
@@ -245,29 +541,3 @@ func (m *Manager) ExtensionsDB() *sql.DB {
 	defer m.mu.RUnlock()
 	return m.extensionsDB
 }
-
-// Close closes both database connections.
-func (m *Manager) Close() error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	var errs []error
-
-	if m.aptoraDB != nil {
-		if err := m.aptoraDB.Close(); err != nil {
-			errs = append(errs, err)
-		}
-	}
-
-	if m.extensionsDB != nil {
-		if err := m.extensionsDB.Close(); err != nil {
-			errs = append(errs, err)
-		}
-	}
-
-	if len(errs) > 0 {
-		return fmt.Errorf("errors closing databases: %v", errs)
-	}
-
-	return nil
-}
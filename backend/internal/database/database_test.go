@@ -0,0 +1,207 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/lifecycle"
+)
+
+// fakeConnector opens connections that support nothing but being pinged and
+// closed, which is all the pool tests need.
+type fakeConnector struct{}
+
+func (fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn{}, nil }
+func (fakeConnector) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+// isClosed reports whether db has been closed.
+func isClosed(db *sql.DB) bool {
+	return db.PingContext(context.Background()) != nil
+}
+
+func newTestManager() *Manager {
+	m := NewManager(slog.New(slog.NewTextHandler(io.Discard, nil)), Config{})
+	m.workers = lifecycle.NewGroup(context.Background(), m.logger)
+	m.aptoraDB = sql.OpenDB(fakeConnector{})
+	m.aptoraGuard = newReadOnlyDB(m.aptoraDB, m.logger, nil)
+	m.extensionsDB = sql.OpenDB(fakeConnector{})
+	m.healthy = true
+	return m
+}
+
+func TestManagerStopClosesPoolsAfterWorkersDrain(t *testing.T) {
+	m := newTestManager()
+	aptora, extensions := m.aptoraDB, m.extensionsDB
+
+	// A worker still using the pools while it winds down must see them open
+	openWhileDraining := make(chan bool, 1)
+	m.workers.Go("draining", func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+		openWhileDraining <- !isClosed(aptora) && !isClosed(extensions)
+	})
+
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop() = %v, want nil", err)
+	}
+	if !<-openWhileDraining {
+		t.Fatal("pools were closed before the worker returned")
+	}
+	if !isClosed(aptora) || !isClosed(extensions) {
+		t.Fatal("Stop left a pool open")
+	}
+	if m.AptoraDB() != nil || m.ExtensionsDB() != nil {
+		t.Fatal("Stop left a pool installed")
+	}
+	if healthy, _ := m.IsHealthy(); healthy {
+		t.Fatal("manager still reports healthy after Stop")
+	}
+}
+
+func TestManagerStopClosesPoolsWhenWorkersHang(t *testing.T) {
+	m := newTestManager()
+	aptora, extensions := m.aptoraDB, m.extensionsDB
+
+	release := make(chan struct{})
+	defer close(release)
+	m.workers.Go("stubborn", func(ctx context.Context) {
+		<-release
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := m.Stop(ctx); err == nil {
+		t.Fatal("Stop() = nil, want an error naming the stuck worker")
+	}
+	if !isClosed(aptora) || !isClosed(extensions) {
+		t.Fatal("Stop left a pool open")
+	}
+}
+
+// waitClosed waits up to a second for db to be closed.
+func waitClosed(db *sql.DB) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if isClosed(db) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReplacedPoolsCloseOnceReleased(t *testing.T) {
+	m := newTestManager()
+	defer m.Stop(context.Background())
+	aptora, extensions := m.aptoraDB, m.extensionsDB
+
+	release := m.Hold()
+	if !m.install(sql.OpenDB(fakeConnector{}), sql.OpenDB(fakeConnector{})) {
+		t.Fatal("install() = false, want true")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if isClosed(aptora) || isClosed(extensions) {
+		t.Fatal("replaced pools were closed while still held")
+	}
+
+	// Holding the new pools doesn't keep the old ones open
+	defer m.Hold()()
+	release()
+	release()
+	if !waitClosed(aptora) || !waitClosed(extensions) {
+		t.Fatal("replaced pools were not closed once released")
+	}
+	if isClosed(m.aptoraDB) || isClosed(m.extensionsDB) {
+		t.Fatal("current pools were closed")
+	}
+}
+
+func TestReplacedPoolsCloseImmediatelyWhenUnused(t *testing.T) {
+	m := newTestManager()
+	defer m.Stop(context.Background())
+	aptora, extensions := m.aptoraDB, m.extensionsDB
+
+	m.Hold()()
+	m.install(sql.OpenDB(fakeConnector{}), sql.OpenDB(fakeConnector{}))
+	if !waitClosed(aptora) || !waitClosed(extensions) {
+		t.Fatal("unused replaced pools were not closed")
+	}
+}
+
+// namedConnector opens connections to a database called name: they answer
+// every query with the name and accept every statement.
+type namedConnector struct{ name string }
+
+func (c namedConnector) Connect(context.Context) (driver.Conn, error) { return namedConn(c), nil }
+func (namedConnector) Driver() driver.Driver                          { return fakeDriver{} }
+
+type namedConn struct{ name string }
+
+func (c namedConn) Prepare(string) (driver.Stmt, error) { return namedStmt(c), nil }
+func (namedConn) Close() error                          { return nil }
+func (namedConn) Begin() (driver.Tx, error)             { return nil, errors.New("not supported") }
+
+type namedStmt struct{ name string }
+
+func (namedStmt) Close() error                               { return nil }
+func (namedStmt) NumInput() int                              { return -1 }
+func (namedStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), nil }
+func (s namedStmt) Query([]driver.Value) (driver.Rows, error) {
+	return &namedRows{name: s.name}, nil
+}
+
+type namedRows struct {
+	name string
+	done bool
+}
+
+func (*namedRows) Columns() []string { return []string{""} }
+func (*namedRows) Close() error      { return nil }
+func (r *namedRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.name
+	return nil
+}
+
+func TestDatabaseNameChecksAgree(t *testing.T) {
+	tests := []struct {
+		name, actual, expected string
+		ok                     bool
+	}{
+		{"same name", "AptoraExtensions", "AptoraExtensions", true},
+		{"different case", "APTORAEXTENSIONS", "aptoraextensions", true},
+		{"different name", "Aptora", "AptoraExtensions", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(slog.New(slog.NewTextHandler(io.Discard, nil)), Config{})
+			db := sql.OpenDB(namedConnector{name: tt.actual})
+			defer db.Close()
+
+			// config check and startup must accept and refuse the same names
+			checkErr := m.checkDB(context.Background(), db, tt.expected, false)
+			initErr := m.initializeExtensionsSchema(context.Background(), db, tt.expected)
+			if (checkErr == nil) != tt.ok || (initErr == nil) != tt.ok {
+				t.Errorf("config check = %v, startup = %v; want ok = %v", checkErr, initErr, tt.ok)
+			}
+		})
+	}
+}
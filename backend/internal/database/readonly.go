@@ -0,0 +1,243 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/requestid"
+)
+
+// Querier is the read-only query interface of the Aptora database, shared by
+// ReadOnlyDB and ReadOnlyConn.
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *Row
+}
+
+// QueryStats describes one finished Aptora query.
+type QueryStats struct {
+	Query    string
+	Args     []any
+	Duration time.Duration // from sending the query until its rows were read
+	Rows     int
+	Err      error
+}
+
+// QueryObserver is called with the stats of every Aptora query, once its
+// rows have been read or closed. ctx is the query's context.
+type QueryObserver func(ctx context.Context, stats QueryStats)
+
+// ReadOnlyDB wraps the Aptora connection pool so that only queries passing
+// CheckReadOnlyQuery reach it. It has no Exec method, and refused queries
+// are logged as errors, since they mean a code path is trying to write to
+// Aptora.
+type ReadOnlyDB struct {
+	db      *sql.DB
+	logger  *slog.Logger
+	observe QueryObserver // nil if no one is watching
+}
+
+func newReadOnlyDB(db *sql.DB, logger *slog.Logger, observe QueryObserver) *ReadOnlyDB {
+	return &ReadOnlyDB{db: db, logger: logger, observe: observe}
+}
+
+// QueryContext runs a checked query on the pool.
+func (d *ReadOnlyDB) QueryContext(ctx context.Context, query string, args ...any) (*Rows, error) {
+	if err := d.check(ctx, query); err != nil {
+		return nil, err
+	}
+	done := d.track(ctx, query, args)
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	return newRows(rows, err, done)
+}
+
+// QueryRowContext runs a checked query expected to return at most one row.
+func (d *ReadOnlyDB) QueryRowContext(ctx context.Context, query string, args ...any) *Row {
+	if err := d.check(ctx, query); err != nil {
+		return &Row{err: err}
+	}
+	done := d.track(ctx, query, args)
+	return &Row{row: d.db.QueryRowContext(ctx, query, args...), done: done}
+}
+
+// planQuery finds the most recently used cached plan of a statement.
+// go-mssqldb sends parameterized queries through sp_executesql, whose cached
+// text is the statement after its parameter declarations, so the text is
+// matched with CHARINDEX rather than equality. CHARINDEX only searches for
+// up to 4000 Unicode characters.
+const planQuery = `
+	SELECT TOP 1 CAST(qp.query_plan AS NVARCHAR(MAX))
+	FROM sys.dm_exec_query_stats qs
+	CROSS APPLY sys.dm_exec_sql_text(qs.sql_handle) st
+	CROSS APPLY sys.dm_exec_query_plan(qs.plan_handle) qp
+	WHERE CHARINDEX(@p1, st.text) > 0 AND qp.query_plan IS NOT NULL
+	ORDER BY qs.last_execution_time DESC`
+
+// CachedPlan returns the showplan XML SQL Server cached for query, the same
+// estimated plan SET SHOWPLAN_XML would show, or sql.ErrNoRows if the plan
+// is no longer cached. Reading the plan cache requires the VIEW SERVER STATE
+// permission. The lookup itself isn't reported to the observer.
+func (d *ReadOnlyDB) CachedPlan(ctx context.Context, query string) (string, error) {
+	if err := d.check(ctx, planQuery); err != nil {
+		return "", err
+	}
+	search := []rune(query)
+	if len(search) > 4000 {
+		search = search[:4000]
+	}
+	var plan string
+	err := d.db.QueryRowContext(ctx, planQuery, string(search)).Scan(&plan)
+	return plan, err
+}
+
+// Conn reserves a single connection from the pool. The caller must close it.
+func (d *ReadOnlyDB) Conn(ctx context.Context) (*ReadOnlyConn, error) {
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &ReadOnlyConn{conn: conn, guard: d}, nil
+}
+
+// track starts timing a query, returning the function that reports it to the
+// observer, or nil if there is none.
+func (d *ReadOnlyDB) track(ctx context.Context, query string, args []any) func(rows int, err error) {
+	if d.observe == nil {
+		return nil
+	}
+	start := time.Now()
+	return func(rows int, err error) {
+		d.observe(ctx, QueryStats{Query: query, Args: args, Duration: time.Since(start), Rows: rows, Err: err})
+	}
+}
+
+func (d *ReadOnlyDB) check(ctx context.Context, query string) error {
+	err := CheckReadOnlyQuery(query)
+	if err == nil {
+		return nil
+	}
+
+	logged := query
+	if len(logged) > 1000 {
+		logged = logged[:1000] + "..."
+	}
+	d.logger.Error("REFUSED non-read-only query against the Aptora database",
+		slog.String("request_id", requestid.From(ctx)),
+		slog.Any("error", err),
+		slog.String("query", logged),
+	)
+	return err
+}
+
+// ReadOnlyConn is a single reserved Aptora connection with the same checks
+// as ReadOnlyDB.
+type ReadOnlyConn struct {
+	conn  *sql.Conn
+	guard *ReadOnlyDB
+}
+
+// QueryContext runs a checked query on the connection.
+func (c *ReadOnlyConn) QueryContext(ctx context.Context, query string, args ...any) (*Rows, error) {
+	if err := c.guard.check(ctx, query); err != nil {
+		return nil, err
+	}
+	done := c.guard.track(ctx, query, args)
+	rows, err := c.conn.QueryContext(ctx, query, args...)
+	return newRows(rows, err, done)
+}
+
+// QueryRowContext runs a checked query expected to return at most one row.
+func (c *ReadOnlyConn) QueryRowContext(ctx context.Context, query string, args ...any) *Row {
+	if err := c.guard.check(ctx, query); err != nil {
+		return &Row{err: err}
+	}
+	done := c.guard.track(ctx, query, args)
+	return &Row{row: c.conn.QueryRowContext(ctx, query, args...), done: done}
+}
+
+// Close returns the connection to the pool.
+func (c *ReadOnlyConn) Close() error {
+	return c.conn.Close()
+}
+
+// Rows is the result of QueryContext: *sql.Rows that reports the query to
+// the observer once the rows are exhausted or closed.
+type Rows struct {
+	*sql.Rows
+	done  func(rows int, err error)
+	count int
+}
+
+func newRows(rows *sql.Rows, err error, done func(rows int, err error)) (*Rows, error) {
+	if err != nil {
+		if done != nil {
+			done(0, err)
+		}
+		return nil, err
+	}
+	return &Rows{Rows: rows, done: done}, nil
+}
+
+// Next prepares the next row for Scan, returning false after the last one.
+func (r *Rows) Next() bool {
+	if r.Rows.Next() {
+		r.count++
+		return true
+	}
+	r.finish()
+	return false
+}
+
+// Close closes the rows, reporting the query if it wasn't read to the end.
+func (r *Rows) Close() error {
+	err := r.Rows.Close()
+	r.finish()
+	return err
+}
+
+func (r *Rows) finish() {
+	if r.done != nil {
+		r.done(r.count, r.Rows.Err())
+		r.done = nil
+	}
+}
+
+// Row is the result of QueryRowContext. Like *sql.Row, any error is deferred
+// until Scan.
+type Row struct {
+	row  *sql.Row
+	err  error
+	done func(rows int, err error)
+}
+
+// Scan copies the row's columns into dest. It returns sql.ErrNoRows if the
+// query returned no rows.
+func (r *Row) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	err := r.row.Scan(dest...)
+	if r.done != nil {
+		switch {
+		case err == nil:
+			r.done(1, nil)
+		case errors.Is(err, sql.ErrNoRows):
+			r.done(0, nil)
+		default:
+			r.done(0, err)
+		}
+		r.done = nil
+	}
+	return err
+}
+
+// Err returns the error, if any, from running the query.
+func (r *Row) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.row.Err()
+}
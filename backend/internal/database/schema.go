@@ -0,0 +1,194 @@
+package database
+
+// schemaStatements creates the Extensions database tables. Each statement must
+// be idempotent since it runs on every successful connection.
+var schemaStatements = []struct {
+	table string
+	sql   string
+}{
+	{
+		table: "health_check",
+		sql: `
+	IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='health_check' AND xtype='U')
+	CREATE TABLE health_check (
+		id INT IDENTITY(1,1) PRIMARY KEY,
+		timestamp DATETIME2 NOT NULL
+	)`,
+	},
+	{
+		table: "api_keys",
+		sql: `
+	IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='api_keys' AND xtype='U')
+	CREATE TABLE api_keys (
+		id INT IDENTITY(1,1) PRIMARY KEY,
+		name NVARCHAR(100) NOT NULL,
+		key_prefix VARCHAR(16) NOT NULL,
+		key_hash CHAR(64) NOT NULL UNIQUE,
+		scopes NVARCHAR(400) NOT NULL,
+		created_at DATETIME2 NOT NULL,
+		expires_at DATETIME2 NULL,
+		last_used_at DATETIME2 NULL,
+		revoked_at DATETIME2 NULL
+	)`,
+	},
+	{
+		table: "report_subscriptions",
+		sql: `
+	IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='report_subscriptions' AND xtype='U')
+	CREATE TABLE report_subscriptions (
+		id INT IDENTITY(1,1) PRIMARY KEY,
+		name NVARCHAR(100) NOT NULL,
+		report VARCHAR(40) NOT NULL,
+		format VARCHAR(10) NOT NULL,
+		period VARCHAR(40) NOT NULL,
+		employee NVARCHAR(100) NULL,
+		schedule VARCHAR(100) NOT NULL,
+		recipients NVARCHAR(1000) NOT NULL,
+		enabled BIT NOT NULL,
+		next_run_at DATETIME2 NULL,
+		created_at DATETIME2 NOT NULL
+	)`,
+	},
+	{
+		table: "report_runs",
+		sql: `
+	IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='report_runs' AND xtype='U')
+	CREATE TABLE report_runs (
+		id INT IDENTITY(1,1) PRIMARY KEY,
+		subscription_id INT NOT NULL REFERENCES report_subscriptions(id) ON DELETE CASCADE,
+		manual BIT NOT NULL,
+		started_at DATETIME2 NOT NULL,
+		finished_at DATETIME2 NULL,
+		status VARCHAR(20) NOT NULL,
+		error NVARCHAR(2000) NULL,
+		invoices INT NOT NULL,
+		start_date DATE NOT NULL,
+		end_date DATE NOT NULL
+	)`,
+	},
+	{
+		table: "webhooks",
+		sql: `
+	IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='webhooks' AND xtype='U')
+	CREATE TABLE webhooks (
+		id INT IDENTITY(1,1) PRIMARY KEY,
+		name NVARCHAR(100) NOT NULL,
+		url NVARCHAR(2000) NOT NULL,
+		secret VARCHAR(100) NOT NULL,
+		events NVARCHAR(400) NOT NULL,
+		min_subtotal DECIMAL(19,4) NULL,
+		enabled BIT NOT NULL,
+		created_at DATETIME2 NOT NULL
+	)`,
+	},
+	{
+		table: "webhook_deliveries",
+		sql: `
+	IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='webhook_deliveries' AND xtype='U')
+	CREATE TABLE webhook_deliveries (
+		id INT IDENTITY(1,1) PRIMARY KEY,
+		webhook_id INT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+		event VARCHAR(100) NOT NULL,
+		payload NVARCHAR(MAX) NOT NULL,
+		status VARCHAR(20) NOT NULL,
+		attempts INT NOT NULL,
+		response_status INT NULL,
+		error NVARCHAR(2000) NULL,
+		created_at DATETIME2 NOT NULL,
+		next_attempt_at DATETIME2 NULL,
+		delivered_at DATETIME2 NULL
+	)`,
+	},
+	{
+		table: "poller_state",
+		sql: `
+	IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='poller_state' AND xtype='U')
+	CREATE TABLE poller_state (
+		name VARCHAR(100) PRIMARY KEY,
+		value NVARCHAR(400) NOT NULL,
+		updated_at DATETIME2 NOT NULL
+	)`,
+	},
+	{
+		table: "invoice_snapshots",
+		sql: `
+	IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='invoice_snapshots' AND xtype='U')
+	CREATE TABLE invoice_snapshots (
+		tran_no INT PRIMARY KEY,
+		tran_date DATE NOT NULL,
+		sales_rep NVARCHAR(100) NOT NULL,
+		subtotal DECIMAL(19,4) NOT NULL,
+		content_hash CHAR(64) NOT NULL,
+		seen_at DATETIME2 NOT NULL
+	)`,
+	},
+	{
+		table: "users",
+		sql: `
+	IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='users' AND xtype='U')
+	CREATE TABLE users (
+		id INT IDENTITY(1,1) PRIMARY KEY,
+		username NVARCHAR(100) NOT NULL UNIQUE,
+		password_hash VARCHAR(100) NOT NULL,
+		is_admin BIT NOT NULL,
+		created_at DATETIME2 NOT NULL,
+		password_changed_at DATETIME2 NOT NULL,
+		disabled_at DATETIME2 NULL
+	)`,
+	},
+	{
+		table: "slow_queries",
+		sql: `
+	IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='slow_queries' AND xtype='U')
+	CREATE TABLE slow_queries (
+		id INT IDENTITY(1,1) PRIMARY KEY,
+		query_hash CHAR(64) NOT NULL,
+		query_text NVARCHAR(MAX) NOT NULL,
+		params NVARCHAR(MAX) NOT NULL,
+		duration_ms INT NOT NULL,
+		row_count INT NOT NULL,
+		error NVARCHAR(1000) NULL,
+		endpoint NVARCHAR(200) NULL,
+		user_name NVARCHAR(100) NULL,
+		request_id VARCHAR(64) NULL,
+		query_plan NVARCHAR(MAX) NULL,
+		recorded_at DATETIME2 NOT NULL
+	)`,
+	},
+	{
+		table: "sales_goals",
+		sql: `
+	IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='sales_goals' AND xtype='U')
+	CREATE TABLE sales_goals (
+		employee_id INT NOT NULL,
+		month DATE NOT NULL,
+		revenue_goal DECIMAL(19,4) NULL,
+		gross_profit_goal DECIMAL(19,4) NULL,
+		updated_at DATETIME2 NOT NULL,
+		PRIMARY KEY (employee_id, month)
+	)`,
+	},
+	{
+		table: "invoice_reviews",
+		sql: `
+	IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='invoice_reviews' AND xtype='U')
+	CREATE TABLE invoice_reviews (
+		invoice_number INT NOT NULL PRIMARY KEY,
+		status NVARCHAR(20) NOT NULL,
+		note NVARCHAR(1000) NOT NULL,
+		reviewed_by NVARCHAR(100) NOT NULL,
+		updated_at DATETIME2 NOT NULL
+	)`,
+	},
+	{
+		table: "write_off_item_codes",
+		sql: `
+	IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='write_off_item_codes' AND xtype='U')
+	CREATE TABLE write_off_item_codes (
+		id INT IDENTITY(1,1) PRIMARY KEY,
+		item_code NVARCHAR(50) NOT NULL UNIQUE,
+		description NVARCHAR(200) NOT NULL,
+		created_at DATETIME2 NOT NULL
+	)`,
+	},
+}
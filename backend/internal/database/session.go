@@ -0,0 +1,35 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/requestid"
+)
+
+// TaggedConn reserves a connection from db and, when ctx carries a request
+// ID, stores it in the SQL Server session as SESSION_CONTEXT(N'request_id').
+// DBAs can then match running queries (for example in sys.dm_exec_sessions)
+// to our request logs. The caller must close the returned connection.
+func TaggedConn(ctx context.Context, db *ReadOnlyDB) (*ReadOnlyConn, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve connection: %w", err)
+	}
+
+	id := requestid.From(ctx)
+	if id == "" {
+		return conn, nil
+	}
+
+	// Session state is cleared by the driver's connection reset when the
+	// connection returns to the pool, so tags never leak between requests.
+	// This fixed statement is the only one allowed to bypass the read-only
+	// query checks.
+	if _, err := conn.conn.ExecContext(ctx, `EXEC sp_set_session_context @key = N'request_id', @value = @p1`, id); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to tag session with request id: %w", err)
+	}
+
+	return conn, nil
+}
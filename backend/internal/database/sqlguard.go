@@ -0,0 +1,299 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ErrQueryRefused is returned for queries that CheckReadOnlyQuery rejects.
+var ErrQueryRefused = errors.New("query refused: only a single SELECT or WITH statement is allowed against Aptora")
+
+// forbiddenKeywords can change data, schema or server state, or run other
+// code, but aren't reserved, so reservedKeywords doesn't catch them. They
+// may not appear anywhere in an Aptora query, even as an identifier.
+var forbiddenKeywords = setOf(`RENAME SP_EXECUTESQL GO DISABLE ENABLE THROW RECEIVE SEND GET MOVE
+	CONVERSATION`)
+
+// reservedKeywords are T-SQL's reserved keywords. They can't be used as bare
+// identifiers, so wherever one appears outside a literal or quoted name it is
+// a keyword, and unless it is in selectKeywords it isn't part of a SELECT.
+// This is what stops a second statement that needs no separator, such as
+// "SELECT 1 PRINT 'x'".
+var reservedKeywords = setOf(`ADD ALL ALTER AND ANY AS ASC AUTHORIZATION BACKUP BEGIN BETWEEN BREAK BROWSE
+	BULK BY CASCADE CASE CHECK CHECKPOINT CLOSE CLUSTERED COALESCE COLLATE COLUMN COMMIT COMPUTE
+	CONSTRAINT CONTAINS CONTAINSTABLE CONTINUE CONVERT CREATE CROSS CURRENT CURRENT_DATE CURRENT_TIME
+	CURRENT_TIMESTAMP CURRENT_USER CURSOR DATABASE DBCC DEALLOCATE DECLARE DEFAULT DELETE DENY DESC
+	DISK DISTINCT DISTRIBUTED DOUBLE DROP DUMP ELSE END ERRLVL ESCAPE EXCEPT EXEC EXECUTE EXISTS EXIT
+	EXTERNAL FETCH FILE FILLFACTOR FOR FOREIGN FREETEXT FREETEXTTABLE FROM FULL FUNCTION GOTO GRANT
+	GROUP HAVING HOLDLOCK IDENTITY IDENTITY_INSERT IDENTITYCOL IF IN INDEX INNER INSERT INTERSECT INTO
+	IS JOIN KEY KILL LEFT LIKE LINENO LOAD MERGE NATIONAL NOCHECK NONCLUSTERED NOT NULL NULLIF OF OFF
+	OFFSETS ON OPEN OPENDATASOURCE OPENQUERY OPENROWSET OPENXML OPTION OR ORDER OUTER OVER PERCENT
+	PIVOT PLAN PRIMARY PRINT PROC PROCEDURE PUBLIC RAISERROR READ READTEXT RECONFIGURE REFERENCES
+	REPLICATION RESTORE RESTRICT RETURN REVERT REVOKE RIGHT ROLLBACK ROWCOUNT ROWGUIDCOL RULE SAVE
+	SCHEMA SECURITYAUDIT SELECT SEMANTICKEYPHRASETABLE SEMANTICSIMILARITYDETAILSTABLE
+	SEMANTICSIMILARITYTABLE SESSION_USER SET SETUSER SHUTDOWN SOME STATISTICS SYSTEM_USER TABLE
+	TABLESAMPLE TEXTSIZE THEN TO TOP TRAN TRANSACTION TRIGGER TRUNCATE TRY_CONVERT TSEQUAL UNION
+	UNIQUE UNPIVOT UPDATE UPDATETEXT USE USER VALUES VARYING VIEW WAITFOR WHEN WHERE WHILE WITH
+	WITHIN WRITETEXT`)
+
+// selectKeywords are the reserved keywords allowed in a read-only SELECT:
+// its clauses, joins, operators and the functions that happen to be
+// reserved. FETCH is handled separately, as it also starts a statement.
+var selectKeywords = setOf(`ALL AND ANY AS ASC BETWEEN BY CASE COALESCE COLLATE CONTAINS CONTAINSTABLE
+	CONVERT CROSS CURRENT_TIMESTAMP CURRENT_USER DESC DISTINCT ELSE END ESCAPE EXCEPT EXISTS FOR
+	FREETEXT FREETEXTTABLE FROM FULL GROUP HAVING HOLDLOCK IN INNER INTERSECT IS JOIN LEFT LIKE NOT
+	NULL NULLIF ON OPTION OR ORDER OUTER OVER PERCENT PIVOT RIGHT SELECT SESSION_USER SOME
+	SYSTEM_USER TABLESAMPLE THEN TOP TRY_CONVERT UNION UNPIVOT USER VALUES WHEN WHERE WITH WITHIN`)
+
+// setOperators may join two SELECTs into one statement.
+var setOperators = map[string]bool{"UNION": true, "ALL": true, "EXCEPT": true, "INTERSECT": true}
+
+// sqlToken is a keyword or identifier (upper-cased) or a single punctuation
+// character. Literals, quoted identifiers, variables and comments are
+// dropped, since they can't change what a statement does.
+type sqlToken struct {
+	text  string
+	depth int // parenthesis depth
+}
+
+// CheckReadOnlyQuery returns an error wrapping ErrQueryRefused unless query is
+// a single SELECT or WITH ... SELECT statement without any keyword that could
+// write or run other code. The check is deliberately strict: it tokenizes the
+// T-SQL rather than pattern matching, and only accepts the reserved keywords
+// a SELECT can use, so a statement that follows without a separator is
+// refused too. It is a second line of defence behind the read-only database
+// login.
+func CheckReadOnlyQuery(query string) error {
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return refused(err.Error())
+	}
+	if len(tokens) == 0 {
+		return refused("empty query")
+	}
+
+	first := tokens[0].text
+	if first != "SELECT" && first != "WITH" {
+		return refused("statement starts with " + first)
+	}
+
+	// A top-level SELECT after the first starts a second statement, unless a
+	// set operator joins it to the first, or it is the SELECT following a
+	// WITH clause's CTE definitions
+	selectSeen := first == "SELECT"
+	for i, tok := range tokens {
+		if forbiddenKeywords[tok.text] {
+			return refused("contains " + tok.text)
+		}
+		if reservedKeywords[tok.text] && !selectKeywords[tok.text] && !isOffsetFetch(tokens, i) {
+			return refused("contains " + tok.text)
+		}
+		if strings.HasPrefix(tok.text, "XP_") {
+			return refused("calls extended procedure " + tok.text)
+		}
+
+		switch tok.text {
+		case ";":
+			if i != len(tokens)-1 {
+				return refused("contains multiple statements")
+			}
+		case "SELECT":
+			if i == 0 || tok.depth > 0 {
+				continue
+			}
+			prev := tokens[i-1].text
+			switch {
+			case setOperators[prev]:
+			case !selectSeen && prev == ")":
+				selectSeen = true
+			default:
+				return refused("contains multiple statements")
+			}
+		case "WITH":
+			// Besides starting a statement, WITH only introduces table
+			// hints and TOP ... WITH TIES / GROUP BY ... WITH ROLLUP
+			if i == 0 {
+				continue
+			}
+			next := ""
+			if i+1 < len(tokens) {
+				next = tokens[i+1].text
+			}
+			if next != "(" && next != "TIES" && next != "ROLLUP" && next != "CUBE" {
+				return refused("contains multiple statements")
+			}
+		}
+	}
+	if !selectSeen {
+		return refused("WITH clause is not followed by SELECT")
+	}
+
+	return nil
+}
+
+// isOffsetFetch reports whether tokens[i] is the FETCH of an ORDER BY ...
+// OFFSET n ROWS FETCH NEXT n ROWS ONLY clause, rather than a cursor FETCH
+// statement.
+func isOffsetFetch(tokens []sqlToken, i int) bool {
+	if tokens[i].text != "FETCH" || i < 2 || (tokens[i-1].text != "ROWS" && tokens[i-1].text != "ROW") {
+		return false
+	}
+	// Literals and variables are dropped, so OFFSET @n ROWS tokenizes as
+	// OFFSET ROWS; a parenthesised expression is skipped as a whole
+	j := i - 2
+	if tokens[j].text == ")" {
+		for j > 0 && (tokens[j].text != "(" || tokens[j].depth != tokens[i].depth) {
+			j--
+		}
+		j--
+	}
+	return j >= 0 && tokens[j].text == "OFFSET" && tokens[j].depth == tokens[i].depth
+}
+
+func setOf(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+func refused(reason string) error {
+	return fmt.Errorf("%w (%s)", ErrQueryRefused, reason)
+}
+
+// tokenizeSQL splits T-SQL into keywords and punctuation, skipping comments,
+// string literals, quoted identifiers and variables. Unterminated literals and
+// comments are errors, so nothing can hide inside them, as are unbalanced
+// parentheses.
+func tokenizeSQL(query string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	src := []rune(query)
+	depth := 0
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		next := rune(0)
+		if i+1 < len(src) {
+			next = src[i+1]
+		}
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '-' && next == '-':
+			// Ending at either line break can only expose more tokens
+			for i < len(src) && src[i] != '\n' && src[i] != '\r' {
+				i++
+			}
+
+		case c == '/' && next == '*':
+			// T-SQL block comments nest
+			nested := 0
+			for {
+				if i+1 >= len(src) {
+					return nil, errors.New("unterminated comment")
+				}
+				if src[i] == '/' && src[i+1] == '*' {
+					nested++
+					i += 2
+				} else if src[i] == '*' && src[i+1] == '/' {
+					nested--
+					i += 2
+					if nested == 0 {
+						break
+					}
+				} else {
+					i++
+				}
+			}
+
+		case c == '\'' || ((c == 'N' || c == 'n') && next == '\''):
+			if c != '\'' {
+				i++
+			}
+			end, ok := skipQuoted(src, i, '\'')
+			if !ok {
+				return nil, errors.New("unterminated string")
+			}
+			i = end
+
+		case c == '"':
+			end, ok := skipQuoted(src, i, '"')
+			if !ok {
+				return nil, errors.New("unterminated quoted identifier")
+			}
+			i = end
+
+		case c == '[':
+			end, ok := skipQuoted(src, i, ']')
+			if !ok {
+				return nil, errors.New("unterminated bracketed identifier")
+			}
+			i = end
+
+		case c == '@':
+			// Parameters (@p1) and system functions (@@ROWCOUNT)
+			i++
+			for i < len(src) && (isWordRune(src[i]) || src[i] == '@') {
+				i++
+			}
+
+		case isWordRune(c):
+			start := i
+			for i < len(src) && isWordRune(src[i]) {
+				i++
+			}
+			word := strings.ToUpper(string(src[start:i]))
+			if unicode.IsDigit(c) {
+				continue // numeric literal
+			}
+			tokens = append(tokens, sqlToken{text: word, depth: depth})
+
+		case c == '(':
+			tokens = append(tokens, sqlToken{text: "(", depth: depth})
+			depth++
+			i++
+
+		case c == ')':
+			depth--
+			if depth < 0 {
+				return nil, errors.New("unbalanced parentheses")
+			}
+			tokens = append(tokens, sqlToken{text: ")", depth: depth})
+			i++
+
+		default:
+			tokens = append(tokens, sqlToken{text: string(c), depth: depth})
+			i++
+		}
+	}
+	if depth != 0 {
+		return nil, errors.New("unbalanced parentheses")
+	}
+
+	return tokens, nil
+}
+
+// skipQuoted returns the index just past the quoted section starting at
+// src[start], where a doubled closing quote is an escaped quote.
+func skipQuoted(src []rune, start int, closing rune) (int, bool) {
+	for i := start + 1; i < len(src); i++ {
+		if src[i] != closing {
+			continue
+		}
+		if i+1 < len(src) && src[i+1] == closing {
+			i++
+			continue
+		}
+		return i + 1, true
+	}
+	return 0, false
+}
+
+func isWordRune(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '#' || c == '$'
+}
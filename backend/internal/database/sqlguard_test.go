@@ -0,0 +1,115 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckReadOnlyQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		allowed bool
+	}{
+		// Queries the server runs against Aptora
+		{"employees", `SELECT id, Name FROM Employees WHERE inactive = 0`, true},
+		{"database name", `SELECT DB_NAME()`, true},
+		{"invoices", `SELECT i."Tran No" as Number, i."Tran Date", i."Sales Rep", i."Tran Subtotal"
+			FROM aptCDV_VW_APT_InvSalCredEstList i
+			WHERE i."Tran Date" >= @p1 AND i."Tran Date" <= @p2 AND i."Tran Type" = 'Invoice'
+				AND NOT (COALESCE(i."Tran Subtotal", 0) <= 0)
+			ORDER BY i."Tran Date" ASC, i."Tran No" ASC`, true},
+		{"rep totals", `SELECT i."Sales Rep",
+				SUM(CASE WHEN i."Tran Date" >= @p1 AND i."Tran Date" <= @p2 THEN 1 ELSE 0 END)
+			FROM aptCDV_VW_APT_InvSalCredEstList i
+			WHERE i."Tran Type" = 'Invoice' AND ((i."Tran Date" >= @p1) OR (i."Tran Date" <= @p4))
+			GROUP BY i."Sales Rep"`, true},
+		{"top with parameter", `SELECT TOP (@p2) i."Tran No" FROM aptCDV_VW_APT_InvSalCredEstList i ORDER BY i."Tran No" ASC`, true},
+		{"cached plan", planQuery, true},
+
+		// Other read-only shapes
+		{"trailing semicolon", `SELECT 1;`, true},
+		{"cte", `WITH recent AS (SELECT id FROM Employees) SELECT id FROM recent`, true},
+		{"union", `SELECT 1 UNION ALL SELECT 2 EXCEPT SELECT 3`, true},
+		{"subquery", `SELECT id FROM Employees WHERE id IN (SELECT id FROM Employees WHERE inactive = 0)`, true},
+		{"exists", `SELECT 1 WHERE EXISTS (SELECT 1 FROM Employees)`, true},
+		{"table hint", `SELECT id FROM Employees WITH (NOLOCK)`, true},
+		{"top with ties", `SELECT TOP 5 WITH TIES id FROM Employees ORDER BY id`, true},
+		{"rollup", `SELECT Name, COUNT(*) FROM Employees GROUP BY Name WITH ROLLUP`, true},
+		{"window function", `SELECT ROW_NUMBER() OVER (PARTITION BY Name ORDER BY id DESC) FROM Employees`, true},
+		{"left join", `SELECT e.id FROM Employees e LEFT OUTER JOIN Employees m ON m.id = e.id`, true},
+		{"offset fetch", `SELECT id FROM Employees ORDER BY id OFFSET 10 ROWS FETCH NEXT 5 ROWS ONLY`, true},
+		{"offset fetch expression", `SELECT id FROM Employees ORDER BY id OFFSET (@p1 * 2) ROWS FETCH FIRST 1 ROW ONLY`, true},
+		{"values constructor", `SELECT v.x FROM (VALUES (1), (2)) v(x)`, true},
+		{"convert and nullif", `SELECT CONVERT(NVARCHAR(10), NULLIF(id, 0)) FROM Employees`, true},
+
+		// Comments, literals and quoted names are not keywords
+		{"keyword in string", `SELECT 'DROP TABLE x; EXEC y' FROM Employees`, true},
+		{"escaped quote in string", `SELECT 'it''s; DELETE' FROM Employees`, true},
+		{"unicode string", `SELECT N'PRINT' FROM Employees`, true},
+		{"keyword in bracketed name", `SELECT [Drop], [Print], [a]]; DELETE] FROM Employees`, true},
+		{"keyword in quoted name", `SELECT "Delete" FROM Employees`, true},
+		{"keyword in line comment", "SELECT 1 -- ; DROP TABLE x\nFROM Employees", true},
+		{"keyword in block comment", `SELECT 1 /* ; DROP TABLE x */ FROM Employees`, true},
+		{"keyword in nested comment", `SELECT 1 /* /* */ DROP TABLE x */ FROM Employees`, true},
+		{"statement after line comment", "SELECT 1 -- harmless\nDROP TABLE x", false},
+		{"statement after block comment", `SELECT 1 /* harmless */ DROP TABLE x`, false},
+		{"unterminated comment", `SELECT 1 /* DROP TABLE x`, false},
+		{"unterminated string", `SELECT 'x`, false},
+		{"unterminated bracket", `SELECT [x FROM Employees`, false},
+
+		// Writes and code execution
+		{"empty", ``, false},
+		{"only comment", `-- SELECT 1`, false},
+		{"update", `UPDATE Employees SET inactive = 1`, false},
+		{"exec", `EXEC sp_who`, false},
+		{"execute in select", `SELECT 1 EXECUTE sp_who`, false},
+		{"sp_executesql", `SELECT 1 FROM Employees WHERE sp_executesql = 1`, false},
+		{"extended procedure", `SELECT 1 FROM xp_cmdshell`, false},
+		{"select into", `SELECT id INTO #copy FROM Employees`, false},
+		{"openrowset", `SELECT * FROM OPENROWSET('SQLNCLI', 'x', 'SELECT 1')`, false},
+		{"waitfor", `SELECT 1 WAITFOR DELAY '00:00:10'`, false},
+		{"cte then delete", `WITH x AS (SELECT 1 AS a) DELETE FROM x`, false},
+		{"cte without select", `WITH x AS (SELECT 1 AS a)`, false},
+
+		// Batches
+		{"semicolon batch", `SELECT 1; DELETE FROM Employees`, false},
+		{"semicolon select batch", `SELECT 1; SELECT 2`, false},
+		{"select batch", `SELECT 1 SELECT 2`, false},
+		{"with batch", `SELECT 1 WITH x AS (SELECT 1) SELECT 2`, false},
+		{"go batch", "SELECT 1\nGO\nSELECT 2", false},
+
+		// Statements that need no separator
+		{"disable trigger", `SELECT 1 DISABLE TRIGGER ALL ON DATABASE`, false},
+		{"enable trigger", `SELECT 1 ENABLE TRIGGER t ON x`, false},
+		{"raiserror", `SELECT 1 RAISERROR('x',16,1)`, false},
+		{"throw", `SELECT 1 THROW 50000, 'x', 1`, false},
+		{"cursor", `SELECT 1 OPEN c FETCH NEXT FROM c`, false},
+		{"cursor fetch", `SELECT 1 FETCH NEXT FROM c`, false},
+		{"cursor fetch after alias", `SELECT 1 rows FETCH NEXT FROM c`, false},
+		{"print", `SELECT 1 WHERE 1=1 PRINT 'x'`, false},
+		{"if", `SELECT 1 IF 1=1 SELECT 2`, false},
+		{"while", `SELECT 1 WHILE 1=1 BREAK`, false},
+		{"deallocate", `SELECT 1 CLOSE c DEALLOCATE c`, false},
+		{"revert", `SELECT 1 REVERT`, false},
+		{"set", `SELECT 1 SET NOCOUNT ON`, false},
+		{"transaction", `SELECT 1 BEGIN TRAN`, false},
+		{"kill", `SELECT 1 KILL 52`, false},
+		{"truncate in subquery", `SELECT (SELECT 1) TRUNCATE TABLE x`, false},
+		{"writetext", `SELECT 1 WRITETEXT t.c @ptr 'x'`, false},
+		{"receive", `SELECT 1 RECEIVE * FROM q`, false},
+		{"move conversation", `SELECT 1 MOVE CONVERSATION @h TO @g`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckReadOnlyQuery(tt.query)
+			if tt.allowed && err != nil {
+				t.Fatalf("CheckReadOnlyQuery(%q) = %v, want nil", tt.query, err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrQueryRefused) {
+				t.Fatalf("CheckReadOnlyQuery(%q) = %v, want ErrQueryRefused", tt.query, err)
+			}
+		})
+	}
+}
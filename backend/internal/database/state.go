@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Background pollers keep small pieces of state, such as the time of their
+// last scan, in the Extensions database poller_state table so they
+// resume where they left off after a restart.
+
+// LoadState returns a poller's saved state, or ok=false if none is saved.
+func LoadState(ctx context.Context, db *sql.DB, name string) (value string, ok bool, err error) {
+	err = db.QueryRowContext(ctx, `SELECT value FROM poller_state WHERE name = @p1`, name).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to load %s state: %w", name, err)
+	}
+	return value, true, nil
+}
+
+// Execer is implemented by *sql.DB and *sql.Tx, so state can be saved in the
+// same transaction as the work it tracks.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// SaveState stores a poller's state.
+func SaveState(ctx context.Context, db Execer, name, value string) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE poller_state SET value = @p2, updated_at = SYSUTCDATETIME() WHERE name = @p1
+		IF @@ROWCOUNT = 0
+			INSERT INTO poller_state (name, value, updated_at) VALUES (@p1, @p2, SYSUTCDATETIME())`,
+		name, value)
+	if err != nil {
+		return fmt.Errorf("failed to save %s state: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package events
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+)
+
+// Type names an internal event.
+type Type string
+
+const (
+	InvoiceInserted Type = "invoice.inserted"
+	InvoiceUpdated  Type = "invoice.updated"
+	InvoiceRemoved  Type = "invoice.removed"
+	HealthChanged   Type = "health.changed"
+	ReviewChanged   Type = "review.changed"
+)
+
+// Event is published on the Bus. IDs increase by one with every event.
+type Event struct {
+	ID   uint64
+	Type Type
+	Time time.Time
+	Data any
+}
+
+// HealthChanged events carry the new api.HealthResponse as Data.
+
+// InvoiceChange is the Data of invoice events. Previous is set for updates;
+// for removals Invoice holds the last known version.
+type InvoiceChange struct {
+	Invoice  api.Invoice
+	Previous *api.Invoice
+}
+
+// ReviewChange is the Data of ReviewChanged events, published when an
+// invoice's review status changes. Previous is nil for the first review.
+type ReviewChange struct {
+	Invoice  api.Invoice
+	Review   api.InvoiceReview
+	Previous *api.ReviewStatus
+}
+
+// Bus fans events out to subscribers in process. Publishing never blocks: a
+// subscriber whose buffer is full misses the event, which is logged. The most
+// recent events are kept so subscribers can catch up after reconnecting.
+type Bus struct {
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	nextID  uint64
+	subs    map[*subscriber]struct{}
+	history []Event // the most recent events, oldest first
+	size    int     // capacity of history
+}
+
+type subscriber struct {
+	name    string
+	ch      chan Event
+	dropped int
+}
+
+// NewBus returns an empty Bus that remembers the last history events.
+func NewBus(logger *slog.Logger, history int) *Bus {
+	return &Bus{
+		logger:  logger.With(slog.String("component", "events")),
+		subs:    map[*subscriber]struct{}{},
+		history: make([]Event, 0, history),
+		size:    history,
+	}
+}
+
+// Subscribe returns a channel receiving every event published from now on,
+// and a function that unsubscribes and closes the channel. name identifies
+// the subscriber in logs.
+func (b *Bus) Subscribe(name string, buffer int) (<-chan Event, func()) {
+	sub := &subscriber{name: name, ch: make(chan Event, buffer)}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub.ch, b.unsubscriber(sub)
+}
+
+// SubscribeAfter is like Subscribe, but also returns the remembered events
+// with IDs above after, so a subscriber can resume without gaps or
+// duplicates. complete is false if some of those events are no longer
+// remembered, or if after is not an ID this Bus has issued.
+func (b *Bus) SubscribeAfter(name string, buffer int, after uint64) (missed []Event, complete bool, ch <-chan Event, unsubscribe func()) {
+	sub := &subscriber{name: name, ch: make(chan Event, buffer)}
+
+	b.mu.Lock()
+	complete = after <= b.nextID
+	if complete && after < b.nextID {
+		complete = len(b.history) > 0 && b.history[0].ID <= after+1
+		for _, e := range b.history {
+			if e.ID > after {
+				missed = append(missed, e)
+			}
+		}
+	}
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	return missed, complete, sub.ch, b.unsubscriber(sub)
+}
+
+// unsubscriber returns a function that removes sub and closes its channel.
+func (b *Bus) unsubscriber(sub *subscriber) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, sub)
+			b.mu.Unlock()
+			close(sub.ch)
+		})
+	}
+}
+
+// Publish assigns the event an ID and delivers it to every subscriber.
+func (b *Bus) Publish(typ Type, data any) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	e := Event{ID: b.nextID, Type: typ, Time: time.Now().UTC(), Data: data}
+
+	if b.size > 0 {
+		if len(b.history) == b.size {
+			b.history = append(b.history[:0], b.history[1:]...)
+		}
+		b.history = append(b.history, e)
+	}
+
+	for sub := range b.subs {
+		select {
+		case sub.ch <- e:
+			if sub.dropped > 0 {
+				b.logger.Warn("event subscriber caught up", slog.String("subscriber", sub.name), slog.Int("dropped", sub.dropped))
+				sub.dropped = 0
+			}
+		default:
+			if sub.dropped == 0 {
+				b.logger.Error("event subscriber is falling behind; dropping events", slog.String("subscriber", sub.name))
+			}
+			sub.dropped++
+		}
+	}
+
+	return e
+}
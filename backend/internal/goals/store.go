@@ -0,0 +1,156 @@
+// Package goals stores monthly sales goals per employee in the Extensions
+// database. Employees are identified by their Aptora Employees.id.
+package goals
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+)
+
+// Totals are an employee's goals summed over the months of a range that
+// have one. A month without a goal is missing rather than zero, so the
+// Months fields count the months each sum covers, and a goal is nil if none
+// of the months have one.
+type Totals struct {
+	Revenue           *float64
+	GrossProfit       *float64
+	RevenueMonths     int
+	GrossProfitMonths int
+}
+
+// ParseMonth parses a YYYY-MM month to its first day.
+func ParseMonth(s string) (time.Time, error) {
+	month, err := time.Parse("2006-01", s)
+	if err != nil {
+		return time.Time{}, errors.New("month must be in YYYY-MM format")
+	}
+	return month, nil
+}
+
+// ValidateGoal checks a goal request before it is stored.
+func ValidateGoal(req api.SetSalesGoalRequest) error {
+	switch {
+	case req.EmployeeID <= 0:
+		return errors.New("employee_id is required")
+	case req.RevenueGoal != nil && *req.RevenueGoal < 0:
+		return errors.New("revenue_goal can't be negative")
+	case req.GrossProfitGoal != nil && *req.GrossProfitGoal < 0:
+		return errors.New("gross_profit_goal can't be negative")
+	}
+	_, err := ParseMonth(req.Month)
+	return err
+}
+
+// Set stores an employee's goals for a month, replacing any already set. If
+// neither goal is given, the month's goals are removed.
+func Set(ctx context.Context, db *sql.DB, req api.SetSalesGoalRequest) error {
+	month, err := ParseMonth(req.Month)
+	if err != nil {
+		return err
+	}
+
+	if req.RevenueGoal == nil && req.GrossProfitGoal == nil {
+		_, err := db.ExecContext(ctx, `DELETE FROM sales_goals WHERE employee_id = @p1 AND month = @p2`,
+			req.EmployeeID, month.Format("2006-01-02"))
+		if err != nil {
+			return fmt.Errorf("failed to delete sales goal: %w", err)
+		}
+		return nil
+	}
+
+	_, err = db.ExecContext(ctx, `
+		MERGE sales_goals AS g
+		USING (SELECT @p1 AS employee_id, CAST(@p2 AS DATE) AS month) AS s
+		ON g.employee_id = s.employee_id AND g.month = s.month
+		WHEN MATCHED THEN
+			UPDATE SET revenue_goal = @p3, gross_profit_goal = @p4, updated_at = @p5
+		WHEN NOT MATCHED THEN
+			INSERT (employee_id, month, revenue_goal, gross_profit_goal, updated_at)
+			VALUES (@p1, s.month, @p3, @p4, @p5);`,
+		req.EmployeeID, month.Format("2006-01-02"), nullFloat(req.RevenueGoal), nullFloat(req.GrossProfitGoal), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to store sales goal: %w", err)
+	}
+	return nil
+}
+
+// List returns every employee's goals for a month.
+func List(ctx context.Context, db *sql.DB, month time.Time) ([]api.SalesGoal, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT employee_id, revenue_goal, gross_profit_goal, updated_at
+		FROM sales_goals
+		WHERE month = @p1
+		ORDER BY employee_id`, month.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sales goals: %w", err)
+	}
+	defer rows.Close()
+
+	goals := []api.SalesGoal{}
+	for rows.Next() {
+		g := api.SalesGoal{Month: month.Format("2006-01")}
+		var revenue, grossProfit sql.NullFloat64
+		if err := rows.Scan(&g.EmployeeID, &revenue, &grossProfit, &g.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan sales goal: %w", err)
+		}
+		g.RevenueGoal = floatPtr(revenue)
+		g.GrossProfitGoal = floatPtr(grossProfit)
+		goals = append(goals, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read sales goals: %w", err)
+	}
+
+	return goals, nil
+}
+
+// Sum returns each employee's goals summed over the months from start to
+// end, keyed by employee ID. Employees without any goals are left out.
+func Sum(ctx context.Context, db *sql.DB, start, end time.Time) (map[int]Totals, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT employee_id, SUM(revenue_goal), SUM(gross_profit_goal), COUNT(revenue_goal), COUNT(gross_profit_goal)
+		FROM sales_goals
+		WHERE month >= @p1 AND month <= @p2
+		GROUP BY employee_id`,
+		start.AddDate(0, 0, 1-start.Day()).Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sales goals: %w", err)
+	}
+	defer rows.Close()
+
+	totals := map[int]Totals{}
+	for rows.Next() {
+		var id int
+		var t Totals
+		var revenue, grossProfit sql.NullFloat64
+		if err := rows.Scan(&id, &revenue, &grossProfit, &t.RevenueMonths, &t.GrossProfitMonths); err != nil {
+			return nil, fmt.Errorf("failed to scan sales goal: %w", err)
+		}
+		t.Revenue, t.GrossProfit = floatPtr(revenue), floatPtr(grossProfit)
+		totals[id] = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read sales goals: %w", err)
+	}
+
+	return totals, nil
+}
+
+func nullFloat(f *float64) sql.NullFloat64 {
+	if f == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: *f, Valid: true}
+}
+
+func floatPtr(f sql.NullFloat64) *float64 {
+	if !f.Valid {
+		return nil
+	}
+	return &f.Float64
+}
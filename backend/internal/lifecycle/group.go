@@ -0,0 +1,83 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Group runs named background workers. Every worker receives a context that
+// is cancelled on Stop (or when the Group's parent context is), and must
+// return promptly once it is.
+type Group struct {
+	logger *slog.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[string]int // worker name -> running goroutines
+}
+
+// NewGroup returns a Group whose workers stop when ctx is cancelled.
+func NewGroup(ctx context.Context, logger *slog.Logger) *Group {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Group{
+		logger:  logger,
+		ctx:     ctx,
+		cancel:  cancel,
+		running: map[string]int{},
+	}
+}
+
+// Go starts fn in a new goroutine. name identifies it in logs and errors.
+func (g *Group) Go(name string, fn func(ctx context.Context)) {
+	g.mu.Lock()
+	g.running[name]++
+	g.mu.Unlock()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer func() {
+			g.mu.Lock()
+			if g.running[name]--; g.running[name] == 0 {
+				delete(g.running, name)
+			}
+			g.mu.Unlock()
+		}()
+		fn(g.ctx)
+	}()
+}
+
+// Stop cancels every worker and waits for them to return. If ctx expires
+// first, it returns an error naming the workers that are still running;
+// they are abandoned.
+func (g *Group) Stop(ctx context.Context) error {
+	g.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		names := make([]string, 0, len(g.running))
+		for name := range g.running {
+			names = append(names, name)
+		}
+		g.mu.Unlock()
+		slices.Sort(names)
+
+		g.logger.Error("background workers did not stop in time", slog.Any("workers", names))
+		return fmt.Errorf("background workers did not stop in time: %s", strings.Join(names, ", "))
+	}
+}
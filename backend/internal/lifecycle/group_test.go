@@ -0,0 +1,91 @@
+package lifecycle
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGroupStopWaitsForWorkers(t *testing.T) {
+	g := NewGroup(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	finished := make(chan struct{})
+	g.Go("cooperative", func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+		close(finished)
+	})
+
+	if err := g.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop() = %v, want nil", err)
+	}
+	select {
+	case <-finished:
+	default:
+		t.Fatal("Stop returned before the worker did")
+	}
+}
+
+func TestGroupStopAbandonsWorkerIgnoringCancellation(t *testing.T) {
+	g := NewGroup(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	release := make(chan struct{})
+	defer close(release)
+	g.Go("stubborn", func(ctx context.Context) {
+		<-release
+	})
+	g.Go("cooperative", func(ctx context.Context) {
+		<-ctx.Done()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := g.Stop(ctx)
+	if err == nil {
+		t.Fatal("Stop() = nil, want an error naming the stuck worker")
+	}
+	if !strings.Contains(err.Error(), "stubborn") || strings.Contains(err.Error(), "cooperative") {
+		t.Fatalf("Stop() = %q, want only the stubborn worker named", err)
+	}
+}
+
+func TestGroupStopReturnsAtDeadline(t *testing.T) {
+	g := NewGroup(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	release := make(chan struct{})
+	defer close(release)
+	g.Go("stubborn", func(ctx context.Context) {
+		<-release
+	})
+
+	const deadline = 50 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+
+	start := time.Now()
+	_ = g.Stop(ctx)
+	if elapsed := time.Since(start); elapsed < deadline || elapsed > deadline+time.Second {
+		t.Fatalf("Stop returned after %v, want about %v", elapsed, deadline)
+	}
+}
+
+func TestGroupStopsWithParentContext(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	g := NewGroup(parent, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	stopped := make(chan struct{})
+	g.Go("worker", func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	})
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("worker was not cancelled with the parent context")
+	}
+}
@@ -0,0 +1,165 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Supported log output formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// redacted replaces sensitive values in log output.
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys whose values are always redacted.
+var sensitiveKeys = map[string]bool{
+	"password":          true,
+	"passwd":            true,
+	"pwd":               true,
+	"secret":            true,
+	"token":             true,
+	"authorization":     true,
+	"api_key":           true,
+	"dsn":               true,
+	"connection_string": true,
+	"conn_str":          true,
+}
+
+// sensitiveSuffixes catch variants such as db_password or admin_token.
+var sensitiveSuffixes = []string{"_password", "_secret", "_token", "_dsn", "_connection_string"}
+
+// secretPatterns find secrets embedded in otherwise harmless strings, such as
+// a connection string quoted in a driver error.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(password|pwd)\s*=\s*[^;\s]*`),
+	regexp.MustCompile(`(?i)\b[a-z][a-z0-9+.-]*://[^\s/@:]*:[^\s/@]*@`), // user:password@ in a URL
+	regexp.MustCompile(`(?i)\bBearer\s+[A-Za-z0-9._~+/=-]+`),
+	regexp.MustCompile(`\bapx_[A-Za-z0-9_-]+`),
+}
+
+// ParseFormat validates a LOG_FORMAT value.
+func ParseFormat(s string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case FormatText:
+		return FormatText, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	}
+	return "", fmt.Errorf("invalid log format %q: expected text or json", s)
+}
+
+// ParseLevel parses a LOG_LEVEL value such as "debug", "info", "warn" or "error".
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q: expected debug, info, warn or error", s)
+	}
+	return level, nil
+}
+
+// New creates a logger writing in the given format at the level held by
+// level, which can be changed while the program runs. Sensitive attributes
+// are redacted automatically.
+func New(w io.Writer, format string, level *slog.LevelVar) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	}
+
+	if format == FormatJSON {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// redact is a slog ReplaceAttr function that hides sensitive values.
+func redact(_ []string, a slog.Attr) slog.Attr {
+	if isSensitiveKey(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		if s := a.Value.String(); containsSecret(s) {
+			return slog.String(a.Key, RedactString(s))
+		}
+	case slog.KindAny:
+		// Errors frequently quote DSNs or headers
+		if err, ok := a.Value.Any().(error); ok {
+			if s := err.Error(); containsSecret(s) {
+				return slog.String(a.Key, RedactString(s))
+			}
+		}
+	}
+
+	return a
+}
+
+// RedactValue hides value entirely if key names a secret, such as
+// DB_PASSWORD, and otherwise hides any secrets embedded in it.
+func RedactValue(key, value string) string {
+	if value != "" && isSensitiveKey(key) {
+		return redacted
+	}
+	return RedactString(value)
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	if sensitiveKeys[key] {
+		return true
+	}
+	for _, suffix := range sensitiveSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsSecret(s string) bool {
+	for _, re := range secretPatterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactString hides secrets embedded in s, such as password=... in a
+// connection string. It is also useful for messages shown outside of logs.
+func RedactString(s string) string {
+	for _, re := range secretPatterns {
+		s = re.ReplaceAllStringFunc(s, func(match string) string {
+			if strings.HasPrefix(strings.ToLower(match), "bearer") {
+				return "Bearer " + redacted
+			}
+			if scheme, userinfo, ok := strings.Cut(match, "://"); ok {
+				user, _, _ := strings.Cut(userinfo, ":")
+				return scheme + "://" + user + ":" + redacted + "@"
+			}
+			if name, _, ok := strings.Cut(match, "="); ok {
+				return name + "=" + redacted
+			}
+			return redacted
+		})
+	}
+	return s
+}
+
+// ToggleDebug switches level between DEBUG and base, returning the new level.
+// It backs the SIGUSR1 handler.
+func ToggleDebug(level *slog.LevelVar, base slog.Level) slog.Level {
+	if level.Level() == slog.LevelDebug && base != slog.LevelDebug {
+		level.Set(base)
+	} else {
+		level.Set(slog.LevelDebug)
+	}
+	return level.Level()
+}
@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	const secret = "hunter2"
+	tests := []struct {
+		name string
+		attr slog.Attr
+	}{
+		{"password key", slog.String("password", secret)},
+		{"password suffix", slog.String("APTORA_DB_PASSWORD", secret)},
+		{"token suffix", slog.String("admin_token", secret)},
+		{"authorization", slog.String("Authorization", "Bearer "+secret)},
+		{"api key key", slog.String("api_key", secret)},
+		{"dsn key", slog.Any("dsn", "sqlserver://sa@db?database=Aptora&password="+secret)},
+		{"connection string value", slog.String("conn", "server=db;user id=sa;password="+secret+";database=Aptora")},
+		{"pwd in value", slog.String("detail", "Server=db;Pwd="+secret)},
+		{"URL credentials", slog.String("url", "sqlserver://sa:"+secret+"@db:1433")},
+		{"bearer in value", slog.String("header", "Authorization: Bearer "+secret)},
+		{"API key in value", slog.String("msg", "rejected key apx_"+secret)},
+		{"error quoting a connection string", slog.Any("error", errors.New("login failed for server=db;password="+secret))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, format := range []string{FormatText, FormatJSON} {
+				var buf bytes.Buffer
+				logger := New(&buf, format, new(slog.LevelVar))
+
+				logger.LogAttrs(t.Context(), slog.LevelInfo, "top level", tt.attr)
+				logger.LogAttrs(t.Context(), slog.LevelInfo, "in a group", slog.Group("db", tt.attr))
+				logger.WithGroup("request").LogAttrs(t.Context(), slog.LevelInfo, "in a logger group", tt.attr)
+
+				out := buf.String()
+				if strings.Contains(out, secret) {
+					t.Errorf("%s output leaks the secret:\n%s", format, out)
+				}
+				if n := strings.Count(out, redacted); n < 3 {
+					t.Errorf("%s output redacts %d of 3 lines:\n%s", format, n, out)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactKeepsHarmlessValues(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, FormatJSON, new(slog.LevelVar))
+	logger.Info("request", slog.String("path", "/api/invoices"), slog.Group("db", slog.String("database", "Aptora")))
+
+	out := buf.String()
+	if strings.Contains(out, redacted) || !strings.Contains(out, "/api/invoices") || !strings.Contains(out, "Aptora") {
+		t.Errorf("harmless values were changed: %s", out)
+	}
+}
+
+func TestRedactValue(t *testing.T) {
+	tests := []struct{ key, value, want string }{
+		{"EXTENSIONS_DB_PASSWORD", "hunter2", redacted},
+		{"ADMIN_TOKEN", "hunter2", redacted},
+		{"APTORA_DB_PASSWORD", "", ""},
+		{"APTORA_DB_HOST", "db.example.com", "db.example.com"},
+		{"DSN_NOTE", "server=db;password=hunter2", "server=db;password=" + redacted},
+	}
+	for _, tt := range tests {
+		if got := RedactValue(tt.key, tt.value); got != tt.want {
+			t.Errorf("RedactValue(%q, %q) = %q, want %q", tt.key, tt.value, got, tt.want)
+		}
+	}
+}
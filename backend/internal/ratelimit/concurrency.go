@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrOverloaded is returned when no slot became available in time, or when
+// too many callers are already waiting.
+var ErrOverloaded = errors.New("too many concurrent requests")
+
+// ConcurrencyLimiter caps the number of concurrent operations. Callers beyond
+// the cap queue for up to a timeout; callers beyond the queue size are shed
+// immediately.
+type ConcurrencyLimiter struct {
+	slots    chan struct{}
+	waiting  atomic.Int64
+	maxQueue int64
+	timeout  time.Duration
+}
+
+// NewConcurrencyLimiter allows up to max concurrent operations with up to
+// maxQueue callers waiting at most timeout for a slot.
+func NewConcurrencyLimiter(max, maxQueue int, timeout time.Duration) *ConcurrencyLimiter {
+	if max < 1 {
+		max = 1
+	}
+	return &ConcurrencyLimiter{
+		slots:    make(chan struct{}, max),
+		maxQueue: int64(maxQueue),
+		timeout:  timeout,
+	}
+}
+
+// Acquire waits for a slot. On success, the returned release function must
+// be called once the operation completes.
+func (c *ConcurrencyLimiter) Acquire(ctx context.Context) (func(), error) {
+	release := func() { <-c.slots }
+
+	// Fast path: a slot is free
+	select {
+	case c.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	if c.waiting.Add(1) > c.maxQueue {
+		c.waiting.Add(-1)
+		return nil, ErrOverloaded
+	}
+	defer c.waiting.Add(-1)
+
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+
+	select {
+	case c.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, ErrOverloaded
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// RetryAfter suggests how long shed callers should wait before retrying.
+func (c *ConcurrencyLimiter) RetryAfter() time.Duration {
+	return c.timeout
+}
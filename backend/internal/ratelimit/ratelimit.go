@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate describes a token bucket: PerMinute tokens are added each minute, up to
+// Burst tokens. A zero PerMinute disables limiting.
+type Rate struct {
+	PerMinute int
+	Burst     int
+}
+
+// ParseRate parses a rate in "<per minute>:<burst>" form, such as "60:10".
+// The burst may be omitted, in which case it defaults to the per-minute rate.
+func ParseRate(s string) (Rate, error) {
+	perMinuteStr, burstStr, hasBurst := strings.Cut(strings.TrimSpace(s), ":")
+
+	perMinute, err := strconv.Atoi(perMinuteStr)
+	if err != nil || perMinute < 0 {
+		return Rate{}, fmt.Errorf("invalid rate %q: expected <per minute>:<burst>", s)
+	}
+
+	burst := perMinute
+	if hasBurst {
+		burst, err = strconv.Atoi(burstStr)
+		if err != nil || burst < 1 {
+			return Rate{}, fmt.Errorf("invalid rate %q: burst must be a positive integer", s)
+		}
+	}
+
+	return Rate{PerMinute: perMinute, Burst: burst}, nil
+}
+
+// Limiter is a set of token buckets keyed by client.
+type Limiter struct {
+	rate  float64 // tokens per second
+	burst float64
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// sweepInterval controls how often idle buckets are discarded.
+const sweepInterval = time.Minute
+
+// NewLimiter creates a limiter for the given rate. It returns nil when the
+// rate disables limiting; a nil Limiter allows every request.
+func NewLimiter(r Rate) *Limiter {
+	if r.PerMinute <= 0 {
+		return nil
+	}
+	burst := r.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:      float64(r.PerMinute) / 60,
+		burst:     float64(burst),
+		now:       time.Now,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes a token from key's bucket. If the bucket is empty, it returns
+// false and how long until a token will be available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep discards buckets that have refilled completely, since they are
+// indistinguishable from new ones. The caller must hold l.mu.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
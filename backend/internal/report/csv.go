@@ -0,0 +1,43 @@
+package report
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+)
+
+// WriteInvoicesCSV writes one row per invoice.
+func WriteInvoicesCSV(w io.Writer, invoices []api.Invoice) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Invoice #", "Date", "Sales Rep", "Subtotal", "Write-off"})
+	for _, inv := range invoices {
+		cw.Write([]string{
+			strconv.Itoa(inv.Number),
+			inv.Date,
+			inv.EmployeeName,
+			strconv.FormatFloat(inv.Subtotal, 'f', 2, 64),
+			string(inv.WriteOffReason),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteRepTotalsCSV writes one row per sales rep followed by a total row.
+func WriteRepTotalsCSV(w io.Writer, invoices []api.Invoice) error {
+	reps, grand := GroupByRep(invoices)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Sales Rep", "Invoices", "Subtotal"})
+	for _, rep := range append(reps, grand) {
+		cw.Write([]string{
+			rep.EmployeeName,
+			strconv.Itoa(rep.Count),
+			strconv.FormatFloat(rep.Subtotal, 'f', 2, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,93 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+)
+
+// checkXref checks that pdf's cross-reference table points at each object
+// in turn, and that startxref points at the table.
+func checkXref(t *testing.T, pdf []byte) {
+	t.Helper()
+
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(pdf)
+	if m == nil {
+		t.Fatal("PDF doesn't end with startxref and the end-of-file marker")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(pdf[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d doesn't point at the xref table", xref)
+	}
+
+	lines := strings.Split(string(pdf[xref:]), "\n")
+	var count int
+	if _, err := fmt.Sscanf(lines[1], "0 %d", &count); err != nil {
+		t.Fatalf("bad xref subsection header %q", lines[1])
+	}
+	if lines[2] != "0000000000 65535 f " {
+		t.Errorf("xref entry 0 = %q, want the free list head", lines[2])
+	}
+	for n := 1; n < count; n++ {
+		entry := lines[2+n]
+		if len(entry) != 19 || !strings.HasSuffix(entry, " 00000 n ") {
+			t.Fatalf("xref entry %d = %q, want 20 bytes ending in n", n, entry)
+		}
+		offset, _ := strconv.Atoi(entry[:10])
+		if want := fmt.Sprintf("%d 0 obj\n", n); !bytes.HasPrefix(pdf[offset:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q, want %q", n, pdf[offset:min(offset+len(want), len(pdf))], want)
+		}
+	}
+	if !strings.Contains(lines[2+count], "trailer") || !strings.Contains(string(pdf[xref:]), fmt.Sprintf("/Size %d ", count)) {
+		t.Errorf("trailer doesn't follow %d xref entries with a matching /Size", count)
+	}
+}
+
+func TestDocumentXref(t *testing.T) {
+	for _, pages := range []int{0, 1, 3} {
+		t.Run(strconv.Itoa(pages)+" pages", func(t *testing.T) {
+			d := &Document{Title: "Report (draft) \\ obj", Created: time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)}
+			for i := range pages {
+				p := d.AddPage()
+				p.Text(72, 720, Bold, 12, fmt.Sprintf("Page %d: 1 0 obj endobj", i+1))
+				p.Line(72, 710, 540, 710, 0.5)
+				p.FillRect(72, 690, 468, 14, 0.9)
+			}
+
+			var buf bytes.Buffer
+			if _, err := d.WriteTo(&buf); err != nil {
+				t.Fatal(err)
+			}
+			checkXref(t, buf.Bytes())
+		})
+	}
+}
+
+func TestSalesPDFXref(t *testing.T) {
+	// Enough invoices for several pages
+	var invoices []api.Invoice
+	for i := range 150 {
+		invoices = append(invoices, api.Invoice{
+			Number:       1000 + i,
+			Date:         "2026-10-01",
+			EmployeeName: []string{"Jane Doe", "John Roe", "Café Owner"}[i%3],
+			Subtotal:     float64(i) * 12.5,
+		})
+	}
+	filter := SalesFilter{StartDate: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2026, 10, 31, 0, 0, 0, 0, time.UTC)}
+
+	var buf bytes.Buffer
+	if err := WriteSalesPDF(&buf, invoices, filter, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("/Count 1 ")) {
+		t.Fatal("report fits on one page; the test needs several")
+	}
+	checkXref(t, buf.Bytes())
+}
@@ -0,0 +1,248 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+)
+
+// SalesFilter describes the filters a sales report was generated with.
+type SalesFilter struct {
+	StartDate time.Time
+	EndDate   time.Time
+	Employee  string // empty for all employees
+}
+
+// RepTotal summarizes one sales rep's invoices.
+type RepTotal struct {
+	EmployeeName string
+	Count        int
+	Subtotal     float64
+	Invoices     []api.Invoice
+}
+
+// GroupByRep groups invoices by sales rep, sorted by rep name, and returns
+// the per-rep totals along with the grand total.
+func GroupByRep(invoices []api.Invoice) ([]RepTotal, RepTotal) {
+	byRep := map[string]*RepTotal{}
+	grand := RepTotal{EmployeeName: "Total"}
+
+	for _, inv := range invoices {
+		rep, ok := byRep[inv.EmployeeName]
+		if !ok {
+			rep = &RepTotal{EmployeeName: inv.EmployeeName}
+			byRep[inv.EmployeeName] = rep
+		}
+		rep.Count++
+		rep.Subtotal += inv.Subtotal
+		rep.Invoices = append(rep.Invoices, inv)
+
+		grand.Count++
+		grand.Subtotal += inv.Subtotal
+	}
+
+	reps := make([]RepTotal, 0, len(byRep))
+	for _, rep := range byRep {
+		reps = append(reps, *rep)
+	}
+	sort.Slice(reps, func(i, j int) bool { return reps[i].EmployeeName < reps[j].EmployeeName })
+
+	return reps, grand
+}
+
+// Layout of the sales report, in points.
+const (
+	margin       = 50.0
+	lineHeight   = 14.0
+	bodySize     = 9.0
+	colInvoice   = margin + 16
+	colDate      = margin + 140
+	colCount     = margin + 340
+	colSubtotal  = PageWidth - margin
+	footerHeight = 30.0
+)
+
+// salesWriter lays out the report, starting new pages as needed.
+type salesWriter struct {
+	doc       *Document
+	page      *Page
+	y         float64
+	generated time.Time
+	repTotals bool // one row per rep rather than per invoice
+}
+
+// WriteSalesPDF renders a paginated sales report with per-rep subtotals and a
+// grand total.
+func WriteSalesPDF(w io.Writer, invoices []api.Invoice, filter SalesFilter, generated time.Time) error {
+	sw := newSalesWriter("Sales Report", filter, generated)
+	reps, grand := GroupByRep(invoices)
+
+	if len(reps) == 0 {
+		sw.page.Text(margin, sw.y, Regular, 10, "No invoices found for the selected criteria.")
+	}
+
+	for _, rep := range reps {
+		// Keep the rep heading together with at least one invoice row
+		sw.ensureSpace(lineHeight * 4)
+		sw.page.FillRect(margin, sw.y-4, PageWidth-2*margin, lineHeight+2, 0.9)
+		sw.page.Text(margin+4, sw.y, Bold, 10, rep.EmployeeName)
+		sw.y -= lineHeight + 2
+		sw.columnHeader()
+
+		for _, inv := range rep.Invoices {
+			sw.ensureSpace(lineHeight)
+			sw.page.Text(colInvoice, sw.y, Regular, bodySize, strconv.Itoa(inv.Number))
+			sw.page.Text(colDate, sw.y, Regular, bodySize, inv.Date)
+			sw.page.TextRight(colSubtotal, sw.y, Regular, bodySize, FormatMoney(inv.Subtotal))
+			sw.y -= lineHeight
+		}
+
+		sw.ensureSpace(lineHeight * 2)
+		sw.page.Line(colDate, sw.y+lineHeight-3, colSubtotal, sw.y+lineHeight-3, 0.5)
+		sw.page.Text(colDate, sw.y, Bold, bodySize, fmt.Sprintf("Subtotal (%d invoice%s)", rep.Count, plural(rep.Count)))
+		sw.page.TextRight(colSubtotal, sw.y, Bold, bodySize, FormatMoney(rep.Subtotal))
+		sw.y -= lineHeight * 2
+	}
+
+	if len(reps) > 0 {
+		sw.grandTotal(grand, len(reps))
+	}
+
+	return sw.finish(w)
+}
+
+// WriteRepTotalsPDF renders one line per sales rep with their invoice count
+// and subtotal, the basis for commission calculations.
+func WriteRepTotalsPDF(w io.Writer, invoices []api.Invoice, filter SalesFilter, generated time.Time) error {
+	sw := newSalesWriter("Sales by Rep", filter, generated)
+	reps, grand := GroupByRep(invoices)
+
+	if len(reps) == 0 {
+		sw.page.Text(margin, sw.y, Regular, 10, "No invoices found for the selected criteria.")
+		return sw.finish(w)
+	}
+
+	sw.repTotals = true
+	sw.columnHeader()
+	for _, rep := range reps {
+		sw.ensureSpace(lineHeight)
+		sw.page.Text(colInvoice, sw.y, Regular, bodySize, rep.EmployeeName)
+		sw.page.TextRight(colCount, sw.y, Regular, bodySize, strconv.Itoa(rep.Count))
+		sw.page.TextRight(colSubtotal, sw.y, Regular, bodySize, FormatMoney(rep.Subtotal))
+		sw.y -= lineHeight
+	}
+	sw.y -= lineHeight
+	sw.grandTotal(grand, len(reps))
+
+	return sw.finish(w)
+}
+
+// newSalesWriter starts the first page with the report title, the filters
+// and the generation time.
+func newSalesWriter(title string, filter SalesFilter, generated time.Time) *salesWriter {
+	sw := &salesWriter{
+		doc:       &Document{Title: title, Created: generated},
+		generated: generated,
+	}
+	sw.newPage()
+
+	sw.page.Text(margin, sw.y, Bold, 18, title)
+	sw.y -= 24
+	employee := filter.Employee
+	if employee == "" {
+		employee = "All employees"
+	}
+	sw.page.Text(margin, sw.y, Regular, 10, fmt.Sprintf("Period: %s to %s",
+		filter.StartDate.Format("Jan 2, 2006"), filter.EndDate.Format("Jan 2, 2006")))
+	sw.y -= lineHeight
+	sw.page.Text(margin, sw.y, Regular, 10, "Employee: "+employee)
+	sw.y -= lineHeight
+	sw.page.Text(margin, sw.y, Regular, 10, "Generated: "+generated.Format("Jan 2, 2006 3:04 PM MST"))
+	sw.y -= lineHeight * 2
+
+	return sw
+}
+
+func (sw *salesWriter) grandTotal(grand RepTotal, reps int) {
+	sw.ensureSpace(lineHeight * 2)
+	sw.page.Line(margin, sw.y+lineHeight-2, colSubtotal, sw.y+lineHeight-2, 1)
+	sw.page.Text(margin, sw.y, Bold, 11, fmt.Sprintf("Grand total (%d invoice%s, %d rep%s)",
+		grand.Count, plural(grand.Count), reps, plural(reps)))
+	sw.page.TextRight(colSubtotal, sw.y, Bold, 11, FormatMoney(grand.Subtotal))
+	sw.y -= lineHeight
+}
+
+// finish adds the page footers, which need the final page count, and writes
+// the document.
+func (sw *salesWriter) finish(w io.Writer) error {
+	total := sw.doc.PageCount()
+	for i, p := range sw.doc.pages {
+		p.Line(margin, footerHeight+12, PageWidth-margin, footerHeight+12, 0.5)
+		p.Text(margin, footerHeight, Regular, 8, "Generated "+sw.generated.Format("2006-01-02 15:04 MST"))
+		p.TextRight(PageWidth-margin, footerHeight, Regular, 8, fmt.Sprintf("Page %d of %d", i+1, total))
+	}
+
+	_, err := sw.doc.WriteTo(w)
+	return err
+}
+
+func (sw *salesWriter) newPage() {
+	sw.page = sw.doc.AddPage()
+	sw.y = PageHeight - margin
+}
+
+// ensureSpace starts a new page if less than height remains above the footer.
+func (sw *salesWriter) ensureSpace(height float64) {
+	if sw.y-height >= footerHeight+24 {
+		return
+	}
+	sw.newPage()
+	sw.columnHeader()
+}
+
+func (sw *salesWriter) columnHeader() {
+	if sw.repTotals {
+		sw.page.Text(colInvoice, sw.y, Bold, 8, "SALES REP")
+		sw.page.TextRight(colCount, sw.y, Bold, 8, "INVOICES")
+	} else {
+		sw.page.Text(colInvoice, sw.y, Bold, 8, "INVOICE #")
+		sw.page.Text(colDate, sw.y, Bold, 8, "DATE")
+	}
+	sw.page.TextRight(colSubtotal, sw.y, Bold, 8, "SUBTOTAL")
+	sw.y -= lineHeight
+}
+
+// FormatMoney formats an amount as US dollars with thousands separators,
+// for example -$1,234.50.
+func FormatMoney(amount float64) string {
+	// Round first, so amounts that round to zero aren't shown as -$0.00
+	cents := int64(math.Round(amount * 100))
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	whole := strconv.FormatInt(cents/100, 10)
+
+	var b strings.Builder
+	for i, c := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	return fmt.Sprintf("%s$%s.%02d", sign, b.String(), cents%100)
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
@@ -0,0 +1,24 @@
+package report
+
+import "testing"
+
+func TestFormatMoney(t *testing.T) {
+	tests := []struct {
+		amount float64
+		want   string
+	}{
+		{0, "$0.00"},
+		{1234.5, "$1,234.50"},
+		{-1234.5, "-$1,234.50"},
+		{1234567.891, "$1,234,567.89"},
+		{999.999, "$1,000.00"},
+		{-0.001, "$0.00"},
+		{-0.004, "$0.00"},
+		{-0.005, "-$0.01"},
+	}
+	for _, tt := range tests {
+		if got := FormatMoney(tt.amount); got != tt.want {
+			t.Errorf("FormatMoney(%v) = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Package reviews stores the review status of Aptora invoices in the
+// Extensions database. Aptora has no review workflow, so this is the only
+// record of it. Invoices are identified by their Aptora "Tran No".
+package reviews
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+)
+
+// maxNote is the longest note the invoice_reviews table holds.
+const maxNote = 1000
+
+// ErrNotFound is returned when an invoice has not been reviewed.
+var ErrNotFound = errors.New("invoice review not found")
+
+// ValidateReview checks a review request before it is stored.
+func ValidateReview(req api.SetInvoiceReviewRequest) error {
+	switch {
+	case !slices.Contains(api.ReviewStatuses, req.Status):
+		return fmt.Errorf("unknown status %q", req.Status)
+	case utf8.RuneCountInString(req.Note) > maxNote:
+		return fmt.Errorf("note can't be longer than %d characters", maxNote)
+	}
+	return nil
+}
+
+// Get returns an invoice's review.
+func Get(ctx context.Context, db *sql.DB, number int) (api.InvoiceReview, error) {
+	r := api.InvoiceReview{InvoiceNumber: number}
+	err := db.QueryRowContext(ctx, `
+		SELECT status, note, reviewed_by, updated_at
+		FROM invoice_reviews
+		WHERE invoice_number = @p1`, number).Scan(&r.Status, &r.Note, &r.ReviewedBy, &r.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return api.InvoiceReview{}, ErrNotFound
+	}
+	if err != nil {
+		return api.InvoiceReview{}, fmt.Errorf("failed to query invoice review: %w", err)
+	}
+	return r, nil
+}
+
+// Set stores an invoice's review, replacing any earlier one, and returns the
+// stored review with the status it replaced, or nil if the invoice had not
+// been reviewed. reviewedBy names who set it.
+func Set(ctx context.Context, db *sql.DB, number int, req api.SetInvoiceReviewRequest, reviewedBy string) (api.InvoiceReview, *api.ReviewStatus, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return api.InvoiceReview{}, nil, fmt.Errorf("failed to start review transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the row, or the gap where it goes, so concurrent updates each see
+	// the status they replace
+	var previous *api.ReviewStatus
+	var status api.ReviewStatus
+	err = tx.QueryRowContext(ctx, `
+		SELECT status FROM invoice_reviews WITH (UPDLOCK, HOLDLOCK)
+		WHERE invoice_number = @p1`, number).Scan(&status)
+	switch {
+	case err == nil:
+		previous = &status
+	case !errors.Is(err, sql.ErrNoRows):
+		return api.InvoiceReview{}, nil, fmt.Errorf("failed to query invoice review: %w", err)
+	}
+
+	r := api.InvoiceReview{
+		InvoiceNumber: number,
+		Status:        req.Status,
+		Note:          req.Note,
+		ReviewedBy:    reviewedBy,
+		UpdatedAt:     time.Now().UTC(),
+	}
+	query := `
+		INSERT INTO invoice_reviews (invoice_number, status, note, reviewed_by, updated_at)
+		VALUES (@p1, @p2, @p3, @p4, @p5)`
+	if previous != nil {
+		query = `
+			UPDATE invoice_reviews SET status = @p2, note = @p3, reviewed_by = @p4, updated_at = @p5
+			WHERE invoice_number = @p1`
+	}
+	if _, err := tx.ExecContext(ctx, query, number, string(r.Status), r.Note, r.ReviewedBy, r.UpdatedAt); err != nil {
+		return api.InvoiceReview{}, nil, fmt.Errorf("failed to store invoice review: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return api.InvoiceReview{}, nil, fmt.Errorf("failed to commit invoice review: %w", err)
+	}
+	return r, previous, nil
+}
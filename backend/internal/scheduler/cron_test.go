@@ -0,0 +1,150 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	valid := []string{
+		"* * * * *",
+		"*/15 8-17 * * 1-5",
+		"0 9 1,15 * *",
+		"5/10 0 * * 7",
+		"0-30/10 * * 1-12 *",
+		"  @daily  ",
+		"@hourly",
+		"@weekly",
+		"@monthly",
+	}
+	for _, expr := range valid {
+		if _, err := ParseSchedule(expr); err != nil {
+			t.Errorf("ParseSchedule(%q) = %v, want nil", expr, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1- * * * *",
+		"@yearly",
+	}
+	for _, expr := range invalid {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("ParseSchedule(%q) = nil, want an error", expr)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	utc := time.UTC
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"next minute", "* * * * *", time.Date(2026, 1, 5, 10, 0, 30, 0, utc), time.Date(2026, 1, 5, 10, 1, 0, 0, utc)},
+		{"strictly after", "0 9 * * *", time.Date(2026, 1, 5, 9, 0, 0, 0, utc), time.Date(2026, 1, 6, 9, 0, 0, 0, utc)},
+		{"step", "*/15 * * * *", time.Date(2026, 1, 5, 10, 16, 0, 0, utc), time.Date(2026, 1, 5, 10, 30, 0, 0, utc)},
+		{"weekdays", "0 8 * * 1-5", time.Date(2026, 1, 9, 9, 0, 0, 0, utc), time.Date(2026, 1, 12, 8, 0, 0, 0, utc)},
+		{"sunday as 7", "0 0 * * 7", time.Date(2026, 1, 5, 0, 0, 0, 0, utc), time.Date(2026, 1, 11, 0, 0, 0, 0, utc)},
+		{"either day field", "0 0 13 * 5", time.Date(2026, 2, 1, 0, 0, 0, 0, utc), time.Date(2026, 2, 6, 0, 0, 0, 0, utc)},
+		{"weekly", "@weekly", time.Date(2026, 1, 7, 12, 0, 0, 0, utc), time.Date(2026, 1, 11, 0, 0, 0, 0, utc)},
+
+		// Month ends
+		{"monthly at year end", "@monthly", time.Date(2026, 12, 31, 23, 59, 0, 0, utc), time.Date(2027, 1, 1, 0, 0, 0, 0, utc)},
+		{"31st skips short months", "0 9 31 * *", time.Date(2026, 1, 31, 10, 0, 0, 0, utc), time.Date(2026, 3, 31, 9, 0, 0, 0, utc)},
+		{"30th skips february", "0 0 30 * *", time.Date(2026, 1, 30, 0, 0, 0, 0, utc), time.Date(2026, 3, 30, 0, 0, 0, 0, utc)},
+		{"29th of february", "0 0 29 2 *", time.Date(2026, 3, 1, 0, 0, 0, 0, utc), time.Date(2028, 2, 29, 0, 0, 0, 0, utc)},
+		{"impossible date", "0 0 30 2 *", time.Date(2026, 1, 1, 0, 0, 0, 0, utc), time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseSchedule(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseSchedule(%q) = %v", tt.expr, err)
+			}
+			if got := s.Next(tt.from); !got.Equal(tt.want) {
+				t.Fatalf("Next(%v) = %v, want %v", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleNextDaylightSaving(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	// In 2026 New York springs forward from 2:00 EST to 3:00 EDT on March 8
+	// and falls back from 2:00 EDT to 1:00 EST on November 1
+	est := time.FixedZone("EST", -5*60*60)
+	edt := time.FixedZone("EDT", -4*60*60)
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want []time.Time // consecutive runs
+	}{
+		{"skipped time runs after the jump", "30 2 * * *", time.Date(2026, 3, 7, 3, 0, 0, 0, ny), []time.Time{
+			time.Date(2026, 3, 8, 3, 0, 0, 0, edt),
+			time.Date(2026, 3, 9, 2, 30, 0, 0, edt),
+		}},
+		{"time after the jump", "30 3 * * *", time.Date(2026, 3, 8, 0, 0, 0, 0, ny), []time.Time{
+			time.Date(2026, 3, 8, 3, 30, 0, 0, edt),
+			time.Date(2026, 3, 9, 3, 30, 0, 0, edt),
+		}},
+		{"repeated time runs once", "30 1 * * *", time.Date(2026, 11, 1, 0, 0, 0, 0, ny), []time.Time{
+			time.Date(2026, 11, 1, 1, 30, 0, 0, edt),
+			time.Date(2026, 11, 2, 1, 30, 0, 0, est),
+		}},
+		{"daily midnight", "@daily", time.Date(2026, 10, 31, 12, 0, 0, 0, ny), []time.Time{
+			time.Date(2026, 11, 1, 0, 0, 0, 0, edt),
+			time.Date(2026, 11, 2, 0, 0, 0, 0, est),
+		}},
+		{"wildcard hour follows elapsed time", "*/30 * * * *", time.Date(2026, 11, 1, 0, 50, 0, 0, ny), []time.Time{
+			time.Date(2026, 11, 1, 1, 0, 0, 0, edt),
+			time.Date(2026, 11, 1, 1, 30, 0, 0, edt),
+			time.Date(2026, 11, 1, 1, 0, 0, 0, est),
+			time.Date(2026, 11, 1, 1, 30, 0, 0, est),
+			time.Date(2026, 11, 1, 2, 0, 0, 0, est),
+		}},
+		{"wildcard hour across the gap", "0 * * * *", time.Date(2026, 3, 8, 0, 30, 0, 0, ny), []time.Time{
+			time.Date(2026, 3, 8, 1, 0, 0, 0, est),
+			time.Date(2026, 3, 8, 3, 0, 0, 0, edt),
+			time.Date(2026, 3, 8, 4, 0, 0, 0, edt),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseSchedule(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseSchedule(%q) = %v", tt.expr, err)
+			}
+			from := tt.from
+			for _, want := range tt.want {
+				got := s.Next(from)
+				if !got.Equal(want) {
+					t.Fatalf("Next(%v) = %v, want %v", from, got, want)
+				}
+				if got.Location() != ny {
+					t.Fatalf("Next(%v) is in %v, want %v", from, got.Location(), ny)
+				}
+				from = got
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSession is what the stub SMTP server received.
+type smtpSession struct {
+	auth string // decoded AUTH PLAIN credentials
+	from string
+	rcpt []string
+	data []byte
+}
+
+// startSMTPStub accepts one SMTP session on a local port and sends what it
+// received on the returned channel. rejectRcpt makes it refuse that
+// recipient.
+func startSMTPStub(t *testing.T, rejectRcpt string) (port int, sessions <-chan smtpSession) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	ch := make(chan smtpSession, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+		tp := textproto.NewConn(conn)
+		var s smtpSession
+		defer func() { ch <- s }()
+
+		tp.PrintfLine("220 localhost stub")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO":
+				tp.PrintfLine("250-localhost")
+				tp.PrintfLine("250-8BITMIME")
+				tp.PrintfLine("250 AUTH PLAIN")
+			case "AUTH":
+				_, encoded, _ := strings.Cut(arg, " ")
+				decoded, _ := base64.StdEncoding.DecodeString(encoded)
+				s.auth = string(decoded)
+				tp.PrintfLine("235 authenticated")
+			case "MAIL":
+				s.from = smtpPath(arg)
+				tp.PrintfLine("250 ok")
+			case "RCPT":
+				rcpt := smtpPath(arg)
+				if rcpt == rejectRcpt {
+					tp.PrintfLine("550 no such user")
+					continue
+				}
+				s.rcpt = append(s.rcpt, rcpt)
+				tp.PrintfLine("250 ok")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				if s.data, err = tp.ReadDotBytes(); err != nil {
+					return
+				}
+				tp.PrintfLine("250 queued")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				return
+			default:
+				tp.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+
+	return ln.Addr().(*net.TCPAddr).Port, ch
+}
+
+// smtpPath returns the address in a MAIL or RCPT argument such as
+// "FROM:<a@example.com> BODY=8BITMIME".
+func smtpPath(arg string) string {
+	_, path, _ := strings.Cut(arg, "<")
+	path, _, _ = strings.Cut(path, ">")
+	return path
+}
+
+func TestMailerSend(t *testing.T) {
+	port, sessions := startSMTPStub(t, "")
+	m := NewMailer(SMTPConfig{
+		Host:     "127.0.0.1",
+		Port:     port,
+		Username: "reports",
+		Password: "secret",
+		From:     "reports@example.com",
+		Security: SMTPNone,
+	})
+
+	to := []string{"alice@example.com", "bob@example.com"}
+	pdf := bytes.Repeat([]byte("%PDF-1.7 report "), 20)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := m.Send(ctx, to, "Ventes — janvier", "Report attached.\nSee you.", Attachment{
+		Filename:    "sales report.pdf",
+		ContentType: "application/pdf",
+		Data:        pdf,
+	})
+	if err != nil {
+		t.Fatalf("Send() = %v", err)
+	}
+	s := <-sessions
+
+	if s.auth != "\x00reports\x00secret" {
+		t.Errorf("AUTH PLAIN credentials = %q", s.auth)
+	}
+	if s.from != "reports@example.com" {
+		t.Errorf("MAIL FROM = %q, want reports@example.com", s.from)
+	}
+	if !slices.Equal(s.rcpt, to) {
+		t.Errorf("RCPT TO = %v, want %v", s.rcpt, to)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(s.data))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+	if got := msg.Header.Get("From"); got != "reports@example.com" {
+		t.Errorf("From = %q", got)
+	}
+	addrs, err := msg.Header.AddressList("To")
+	if err != nil {
+		t.Fatalf("failed to parse To: %v", err)
+	}
+	var gotTo []string
+	for _, a := range addrs {
+		gotTo = append(gotTo, a.Address)
+	}
+	if !slices.Equal(gotTo, to) {
+		t.Errorf("To = %v, want %v", gotTo, to)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Ventes — janvier" {
+		t.Errorf("Subject = %q (%v)", subject, err)
+	}
+	if _, err := msg.Header.Date(); err != nil {
+		t.Errorf("Date header: %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type = %q (%v), want multipart/mixed", msg.Header.Get("Content-Type"), err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+
+	body, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("failed to read body part: %v", err)
+	}
+	if got := body.Header.Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("body Content-Type = %q", got)
+	}
+	// The stub reads the DATA section with textproto, which turns CRLF
+	// line endings into LF
+	text, _ := io.ReadAll(body)
+	if got := strings.TrimRight(string(text), "\n"); got != "Report attached.\nSee you." {
+		t.Errorf("body = %q", got)
+	}
+
+	att, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("failed to read attachment part: %v", err)
+	}
+	if got := att.Header.Get("Content-Type"); got != "application/pdf" {
+		t.Errorf("attachment Content-Type = %q", got)
+	}
+	if got := att.FileName(); got != "sales report.pdf" {
+		t.Errorf("attachment filename = %q", got)
+	}
+	if got := att.Header.Get("Content-Transfer-Encoding"); got != "base64" {
+		t.Fatalf("attachment Content-Transfer-Encoding = %q", got)
+	}
+	encoded, _ := io.ReadAll(att)
+	lines := strings.Split(strings.TrimRight(string(encoded), "\n"), "\n")
+	for _, line := range lines {
+		if len(line) > 76 {
+			t.Errorf("attachment line is %d characters, want at most 76", len(line))
+		}
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.Join(lines, ""))
+	if err != nil || !bytes.Equal(data, pdf) {
+		t.Errorf("attachment data doesn't round-trip (%v)", err)
+	}
+
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("message has more than two parts (%v)", err)
+	}
+}
+
+func TestMailerSendRejectedRecipient(t *testing.T) {
+	port, sessions := startSMTPStub(t, "bob@example.com")
+	m := NewMailer(SMTPConfig{Host: "127.0.0.1", Port: port, From: "reports@example.com", Security: SMTPNone})
+
+	err := m.Send(context.Background(), []string{"alice@example.com", "bob@example.com"}, "Sales", "", Attachment{
+		Filename: "r.pdf", ContentType: "application/pdf",
+	})
+	if err == nil || !strings.Contains(err.Error(), "bob@example.com") {
+		t.Fatalf("Send() = %v, want an error naming the rejected recipient", err)
+	}
+	if s := <-sessions; s.data != nil {
+		t.Error("message was sent despite the rejected recipient")
+	}
+}
+
+func TestMailerSendRequiresStartTLS(t *testing.T) {
+	port, _ := startSMTPStub(t, "")
+	m := NewMailer(SMTPConfig{Host: "127.0.0.1", Port: port, From: "reports@example.com", Security: SMTPStartTLS})
+
+	err := m.Send(context.Background(), []string{"alice@example.com"}, "Sales", "", Attachment{})
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("Send() = %v, want a STARTTLS error", err)
+	}
+}
+
+func TestMailerSendNotConfigured(t *testing.T) {
+	if err := NewMailer(SMTPConfig{}).Send(context.Background(), []string{"a@example.com"}, "s", "b", Attachment{}); err == nil {
+		t.Fatal("Send() = nil, want an error")
+	}
+}
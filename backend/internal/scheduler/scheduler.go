@@ -0,0 +1,289 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"slices"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/database"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/report"
+)
+
+// maxRecipients limits how many addresses one subscription can email.
+const maxRecipients = 20
+
+// InvoiceLoader returns the invoices dated from start through end, optionally
+// for a single sales rep.
+type InvoiceLoader func(ctx context.Context, start, end time.Time, employee string) ([]api.Invoice, error)
+
+// Scheduler runs report subscriptions when they are due and emails the
+// results. Subscriptions and their run history live in the Extensions
+// database, so schedules survive restarts and missed runs are caught up once.
+type Scheduler struct {
+	logger *slog.Logger
+	db     *database.Manager
+	load   InvoiceLoader
+	mailer *Mailer
+}
+
+// New returns a Scheduler that loads invoices with load and sends reports
+// through mailer.
+func New(logger *slog.Logger, db *database.Manager, load InvoiceLoader, mailer *Mailer) *Scheduler {
+	return &Scheduler{
+		logger: logger.With(slog.String("component", "scheduler")),
+		db:     db,
+		load:   load,
+		mailer: mailer,
+	}
+}
+
+// Enabled reports whether the scheduler can send reports.
+func (s *Scheduler) Enabled() bool {
+	return s.mailer.cfg.Enabled()
+}
+
+// Run checks for due subscriptions every minute until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	if !s.Enabled() {
+		s.logger.Info("report scheduler disabled; SMTP_HOST is not set")
+		return
+	}
+
+	cleanedUp := false
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		release := s.db.Hold()
+		if db := s.db.ExtensionsDB(); db != nil {
+			if !cleanedUp {
+				if n, err := failInterruptedRuns(ctx, db); err != nil {
+					s.logger.Error("failed to clean up interrupted report runs", slog.Any("error", err))
+				} else {
+					cleanedUp = true
+					if n > 0 {
+						s.logger.Warn("marked interrupted report runs as failed", slog.Int64("runs", n))
+					}
+				}
+			}
+			s.runDue(ctx)
+		}
+		release()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDue runs every due subscription in turn.
+func (s *Scheduler) runDue(ctx context.Context) {
+	db := s.db.ExtensionsDB()
+	subs, err := dueSubscriptions(ctx, db, time.Now())
+	if err != nil {
+		s.logger.Error("failed to load due report subscriptions", slog.Any("error", err))
+		return
+	}
+
+	for _, sub := range subs {
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Schedule the next run first so a failing report doesn't retry
+		// every minute
+		next := time.Time{}
+		if schedule, err := ParseSchedule(sub.Schedule); err == nil {
+			next = schedule.Next(time.Now())
+		}
+		if err := setNextRun(ctx, db, sub.ID, next); err != nil {
+			s.logger.Error("failed to schedule report subscription", slog.Int("subscription_id", sub.ID), slog.Any("error", err))
+			continue
+		}
+
+		s.execute(ctx, sub, false)
+	}
+}
+
+// RunNow generates and sends a subscription's report immediately, without
+// changing its schedule.
+func (s *Scheduler) RunNow(ctx context.Context, id int) (api.ReportRun, error) {
+	defer s.db.Hold()()
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		return api.ReportRun{}, errors.New("extensions database not available")
+	}
+	sub, err := GetSubscription(ctx, db, id)
+	if err != nil {
+		return api.ReportRun{}, err
+	}
+	return s.execute(ctx, sub, true)
+}
+
+// execute runs one subscription, recording the run and its outcome. The
+// returned error is only set when the run couldn't be recorded; report
+// failures are part of the run.
+func (s *Scheduler) execute(ctx context.Context, sub api.ReportSubscription, manual bool) (api.ReportRun, error) {
+	logger := s.logger.With(slog.Int("subscription_id", sub.ID), slog.String("subscription", sub.Name))
+	db := s.db.ExtensionsDB()
+
+	now := time.Now()
+	start, end := periodRange(sub.Period, now)
+	run := api.ReportRun{
+		SubscriptionID: sub.ID,
+		Manual:         manual,
+		StartedAt:      now.UTC(),
+		Status:         api.RunRunning,
+		StartDate:      start.Format("2006-01-02"),
+		EndDate:        end.Format("2006-01-02"),
+	}
+	run, err := startRun(ctx, db, run)
+	if err != nil {
+		logger.Error("failed to record report run", slog.Any("error", err))
+		return api.ReportRun{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	invoices, err := s.send(ctx, sub, start, end, now)
+	run.Invoices = invoices
+	run.Status = api.RunSucceeded
+	if err != nil {
+		run.Status = api.RunFailed
+		run.Error = err.Error()
+		logger.Error("report run failed", slog.Int("run_id", run.ID), slog.Any("error", err))
+	} else {
+		logger.Info("report sent", slog.Int("run_id", run.ID), slog.Int("invoices", invoices),
+			slog.Int("recipients", len(sub.Recipients)))
+	}
+
+	finished := time.Now().UTC()
+	run.FinishedAt = &finished
+	// Record the result even if ctx was cancelled during the run
+	if err := finishRun(context.WithoutCancel(ctx), db, run); err != nil {
+		logger.Error("failed to record report run result", slog.Int("run_id", run.ID), slog.Any("error", err))
+	}
+
+	return run, nil
+}
+
+// send generates the report and emails it, returning the number of invoices
+// it covered.
+func (s *Scheduler) send(ctx context.Context, sub api.ReportSubscription, start, end, now time.Time) (int, error) {
+	invoices, err := s.load(ctx, start, end, sub.Employee)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load invoices: %w", err)
+	}
+
+	att, err := generate(sub, invoices, start, end, now)
+	if err != nil {
+		return len(invoices), fmt.Errorf("failed to generate report: %w", err)
+	}
+
+	subject := fmt.Sprintf("%s: %s to %s", sub.Name, start.Format("Jan 2, 2006"), end.Format("Jan 2, 2006"))
+	body := fmt.Sprintf("Attached is the %q report for %s through %s (%d invoices).\n\n"+
+		"This email was sent automatically by Aptora Extensions.\n",
+		sub.Name, start.Format("2006-01-02"), end.Format("2006-01-02"), len(invoices))
+
+	if err := s.mailer.Send(ctx, sub.Recipients, subject, body, att); err != nil {
+		return len(invoices), err
+	}
+	return len(invoices), nil
+}
+
+// generate renders a subscription's report as an email attachment.
+func generate(sub api.ReportSubscription, invoices []api.Invoice, start, end, now time.Time) (Attachment, error) {
+	var buf bytes.Buffer
+	filter := report.SalesFilter{StartDate: start, EndDate: end, Employee: sub.Employee}
+
+	var err error
+	switch {
+	case sub.Report == api.ReportInvoiceSummary && sub.Format == api.ReportFormatPDF:
+		err = report.WriteSalesPDF(&buf, invoices, filter, now)
+	case sub.Report == api.ReportInvoiceSummary && sub.Format == api.ReportFormatCSV:
+		err = report.WriteInvoicesCSV(&buf, invoices)
+	case sub.Report == api.ReportCommissions && sub.Format == api.ReportFormatPDF:
+		err = report.WriteRepTotalsPDF(&buf, invoices, filter, now)
+	case sub.Report == api.ReportCommissions && sub.Format == api.ReportFormatCSV:
+		err = report.WriteRepTotalsCSV(&buf, invoices)
+	default:
+		err = fmt.Errorf("unsupported report %q in format %q", sub.Report, sub.Format)
+	}
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if sub.Format == api.ReportFormatPDF {
+		contentType = "application/pdf"
+	}
+	return Attachment{
+		Filename:    fmt.Sprintf("%s-%s-to-%s.%s", sub.Report, start.Format("2006-01-02"), end.Format("2006-01-02"), sub.Format),
+		ContentType: contentType,
+		Data:        buf.Bytes(),
+	}, nil
+}
+
+// periodRange returns the first and last dates covered by period for a run
+// at now.
+func periodRange(period api.ReportPeriod, now time.Time) (time.Time, time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case api.PeriodPreviousDay:
+		day := today.AddDate(0, 0, -1)
+		return day, day
+	case api.PeriodPreviousWeek:
+		// Weeks start on Monday
+		sinceMonday := (int(today.Weekday()) + 6) % 7
+		monday := today.AddDate(0, 0, -sinceMonday-7)
+		return monday, monday.AddDate(0, 0, 6)
+	case api.PeriodMonthToDate:
+		return today.AddDate(0, 0, 1-today.Day()), today
+	default: // api.PeriodPreviousMonth
+		first := today.AddDate(0, 0, 1-today.Day()).AddDate(0, -1, 0)
+		return first, first.AddDate(0, 1, -1)
+	}
+}
+
+// ValidateSubscription checks a subscription request before it is stored.
+func ValidateSubscription(req api.CreateReportSubscriptionRequest) error {
+	switch {
+	case req.Name == "":
+		return errors.New("name is required")
+	case !slices.Contains(api.ReportKinds, req.Report):
+		return fmt.Errorf("unknown report %q", req.Report)
+	case !slices.Contains(api.ReportFormats, req.Format):
+		return fmt.Errorf("unknown format %q", req.Format)
+	case !slices.Contains(api.ReportPeriods, req.Period):
+		return fmt.Errorf("unknown period %q", req.Period)
+	case len(req.Recipients) == 0:
+		return errors.New("at least one recipient is required")
+	case len(req.Recipients) > maxRecipients:
+		return fmt.Errorf("at most %d recipients are allowed", maxRecipients)
+	}
+
+	for _, rcpt := range req.Recipients {
+		addr, err := mail.ParseAddress(rcpt)
+		if err != nil || addr.Address != rcpt {
+			return fmt.Errorf("invalid recipient %q; use a bare address like name@example.com", rcpt)
+		}
+	}
+
+	schedule, err := ParseSchedule(req.Schedule)
+	if err != nil {
+		return fmt.Errorf("invalid schedule: %w", err)
+	}
+	if schedule.Next(time.Now()).IsZero() {
+		return errors.New("schedule never runs")
+	}
+	return nil
+}
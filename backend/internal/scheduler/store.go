@@ -0,0 +1,229 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+)
+
+// ErrNotFound is returned when a subscription ID does not exist.
+var ErrNotFound = errors.New("report subscription not found")
+
+const subscriptionColumns = `id, name, report, format, period, employee, schedule, recipients, enabled, next_run_at, created_at`
+
+// CreateSubscription stores a new, enabled subscription and schedules its
+// first run.
+func CreateSubscription(ctx context.Context, db *sql.DB, req api.CreateReportSubscriptionRequest) (api.ReportSubscription, error) {
+	schedule, err := ParseSchedule(req.Schedule)
+	if err != nil {
+		return api.ReportSubscription{}, err
+	}
+
+	sub := api.ReportSubscription{
+		Name:       req.Name,
+		Report:     req.Report,
+		Format:     req.Format,
+		Period:     req.Period,
+		Employee:   req.Employee,
+		Schedule:   req.Schedule,
+		Recipients: req.Recipients,
+		Enabled:    true,
+		CreatedAt:  time.Now().UTC(),
+	}
+	next := sql.NullTime{}
+	if t := schedule.Next(time.Now()); !t.IsZero() {
+		t = t.UTC()
+		sub.NextRunAt = &t
+		next = sql.NullTime{Time: t, Valid: true}
+	}
+
+	err = db.QueryRowContext(ctx, `
+		INSERT INTO report_subscriptions (name, report, format, period, employee, schedule, recipients, enabled, next_run_at, created_at)
+		OUTPUT INSERTED.id
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, 1, @p8, @p9)`,
+		sub.Name, string(sub.Report), string(sub.Format), string(sub.Period), nullString(sub.Employee),
+		sub.Schedule, strings.Join(sub.Recipients, ","), next, sub.CreatedAt,
+	).Scan(&sub.ID)
+	if err != nil {
+		return api.ReportSubscription{}, fmt.Errorf("failed to insert report subscription: %w", err)
+	}
+
+	return sub, nil
+}
+
+// ListSubscriptions returns every subscription.
+func ListSubscriptions(ctx context.Context, db *sql.DB) ([]api.ReportSubscription, error) {
+	return querySubscriptions(ctx, db, `SELECT `+subscriptionColumns+` FROM report_subscriptions ORDER BY id`)
+}
+
+// GetSubscription returns one subscription.
+func GetSubscription(ctx context.Context, db *sql.DB, id int) (api.ReportSubscription, error) {
+	subs, err := querySubscriptions(ctx, db, `SELECT `+subscriptionColumns+` FROM report_subscriptions WHERE id = @p1`, id)
+	if err != nil {
+		return api.ReportSubscription{}, err
+	}
+	if len(subs) == 0 {
+		return api.ReportSubscription{}, ErrNotFound
+	}
+	return subs[0], nil
+}
+
+// DeleteSubscription removes a subscription along with its run history.
+func DeleteSubscription(ctx context.Context, db *sql.DB, id int) error {
+	res, err := db.ExecContext(ctx, `DELETE FROM report_subscriptions WHERE id = @p1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete report subscription: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete report subscription: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// dueSubscriptions returns enabled subscriptions whose next run is at or
+// before now.
+func dueSubscriptions(ctx context.Context, db *sql.DB, now time.Time) ([]api.ReportSubscription, error) {
+	return querySubscriptions(ctx, db, `
+		SELECT `+subscriptionColumns+` FROM report_subscriptions
+		WHERE enabled = 1 AND next_run_at <= @p1
+		ORDER BY next_run_at`, now.UTC())
+}
+
+// setNextRun records when a subscription should run next. A zero time
+// leaves it unscheduled.
+func setNextRun(ctx context.Context, db *sql.DB, id int, next time.Time) error {
+	nt := sql.NullTime{}
+	if !next.IsZero() {
+		nt = sql.NullTime{Time: next.UTC(), Valid: true}
+	}
+	if _, err := db.ExecContext(ctx, `UPDATE report_subscriptions SET next_run_at = @p1 WHERE id = @p2`, nt, id); err != nil {
+		return fmt.Errorf("failed to schedule next run: %w", err)
+	}
+	return nil
+}
+
+func querySubscriptions(ctx context.Context, db *sql.DB, query string, args ...any) ([]api.ReportSubscription, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query report subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	subs := []api.ReportSubscription{}
+	for rows.Next() {
+		var sub api.ReportSubscription
+		var report, format, period, recipients string
+		var employee sql.NullString
+		var next sql.NullTime
+		err := rows.Scan(&sub.ID, &sub.Name, &report, &format, &period, &employee,
+			&sub.Schedule, &recipients, &sub.Enabled, &next, &sub.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan report subscription: %w", err)
+		}
+		sub.Report = api.ReportKind(report)
+		sub.Format = api.ReportFormat(format)
+		sub.Period = api.ReportPeriod(period)
+		sub.Employee = employee.String
+		sub.Recipients = strings.Split(recipients, ",")
+		if next.Valid {
+			sub.NextRunAt = &next.Time
+		}
+		subs = append(subs, sub)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read report subscriptions: %w", err)
+	}
+
+	return subs, nil
+}
+
+// startRun records the start of a run and returns it with its ID.
+func startRun(ctx context.Context, db *sql.DB, run api.ReportRun) (api.ReportRun, error) {
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO report_runs (subscription_id, manual, started_at, status, invoices, start_date, end_date)
+		OUTPUT INSERTED.id
+		VALUES (@p1, @p2, @p3, @p4, 0, @p5, @p6)`,
+		run.SubscriptionID, run.Manual, run.StartedAt, string(run.Status), run.StartDate, run.EndDate,
+	).Scan(&run.ID)
+	if err != nil {
+		return api.ReportRun{}, fmt.Errorf("failed to record report run: %w", err)
+	}
+	return run, nil
+}
+
+// finishRun records the outcome of a run.
+func finishRun(ctx context.Context, db *sql.DB, run api.ReportRun) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE report_runs SET finished_at = @p1, status = @p2, error = @p3, invoices = @p4
+		WHERE id = @p5`,
+		*run.FinishedAt, string(run.Status), nullString(run.Error), run.Invoices, run.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record report run result: %w", err)
+	}
+	return nil
+}
+
+// failInterruptedRuns marks runs left running by a previous process as
+// failed, so the history doesn't show them as in progress forever.
+func failInterruptedRuns(ctx context.Context, db *sql.DB) (int64, error) {
+	res, err := db.ExecContext(ctx, `
+		UPDATE report_runs SET finished_at = SYSUTCDATETIME(), status = @p1, error = 'interrupted by server restart'
+		WHERE status = @p2`, string(api.RunFailed), string(api.RunRunning))
+	if err != nil {
+		return 0, fmt.Errorf("failed to clean up interrupted runs: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// ListRuns returns the most recent runs of a subscription, newest first.
+func ListRuns(ctx context.Context, db *sql.DB, subscriptionID, limit int) ([]api.ReportRun, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT TOP (@p2) id, subscription_id, manual, started_at, finished_at, status, error, invoices, start_date, end_date
+		FROM report_runs
+		WHERE subscription_id = @p1
+		ORDER BY started_at DESC, id DESC`, subscriptionID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query report runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []api.ReportRun{}
+	for rows.Next() {
+		var run api.ReportRun
+		var status string
+		var finished sql.NullTime
+		var runErr sql.NullString
+		var start, end time.Time
+		err := rows.Scan(&run.ID, &run.SubscriptionID, &run.Manual, &run.StartedAt, &finished,
+			&status, &runErr, &run.Invoices, &start, &end)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan report run: %w", err)
+		}
+		run.Status = api.ReportRunStatus(status)
+		run.Error = runErr.String
+		run.StartDate = start.Format("2006-01-02")
+		run.EndDate = end.Format("2006-01-02")
+		if finished.Valid {
+			run.FinishedAt = &finished.Time
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read report runs: %w", err)
+	}
+
+	return runs, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/auth"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/logging"
+)
+
+func (s *Server) handlePurgeCache(w http.ResponseWriter, r *http.Request) {
+	purged := s.invoiceCache.Purge()
+	s.log(r.Context()).Info("purged query cache", slog.Int("entries", purged))
+
+	resp := api.PurgeCacheResponse{Purged: purged}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleGetLogLevel(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.LogLevel == nil {
+		s.writeError(w, r, http.StatusNotFound, api.CodeNotFound, "log level is not adjustable")
+		return
+	}
+
+	resp := api.LogLevel{Level: s.cfg.LogLevel.Level().String()}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleSetLogLevel(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.LogLevel == nil {
+		s.writeError(w, r, http.StatusNotFound, api.CodeNotFound, "log level is not adjustable")
+		return
+	}
+
+	var req api.LogLevel
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, "invalid request body")
+		return
+	}
+	level, err := logging.ParseLevel(req.Level)
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, err.Error())
+		return
+	}
+
+	s.cfg.LogLevel.Set(level)
+	s.log(r.Context()).Warn("log level changed", slog.String("level", level.String()))
+
+	resp := api.LogLevel{Level: level.String()}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	keys, err := auth.ListAPIKeys(ctx, db)
+	if err != nil {
+		s.log(r.Context()).Error("failed to list API keys", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to list API keys")
+		return
+	}
+
+	resp := api.APIKeysResponse{APIKeys: keys}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	var req api.CreateAPIKeyRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err == nil {
+		req.Name = strings.TrimSpace(req.Name)
+		switch {
+		case req.Name == "":
+			err = errors.New("name is required")
+		case req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()):
+			err = errors.New("expires_at must be in the future")
+		default:
+			err = auth.ValidateScopes(req.Scopes)
+		}
+	}
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, "invalid API key request: "+err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	key, secret, err := auth.CreateAPIKey(ctx, db, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		s.log(r.Context()).Error("failed to create API key", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to create API key")
+		return
+	}
+
+	s.log(r.Context()).Info("created API key",
+		slog.Int("api_key_id", key.ID),
+		slog.String("api_key_name", key.Name),
+		slog.String("scopes", strings.Join(key.Scopes, ",")),
+	)
+
+	// The secret is only ever returned here
+	resp := api.CreatedAPIKey{APIKey: key, Key: secret}
+	s.writeJSON(w, http.StatusCreated, resp)
+}
+
+func (s *Server) handleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, "invalid API key id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := auth.RevokeAPIKey(ctx, db, id); err != nil {
+		if errors.Is(err, auth.ErrNotFound) {
+			s.writeError(w, r, http.StatusNotFound, api.CodeNotFound, "API key not found")
+			return
+		}
+		s.log(r.Context()).Error("failed to revoke API key", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to revoke API key")
+		return
+	}
+
+	s.log(r.Context()).Info("revoked API key", slog.Int("api_key_id", id))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/auth"
+)
+
+// principal identifies who made a request that presented credentials.
+type principal struct {
+	admin  bool
+	apiKey *auth.APIKey
+}
+
+// name identifies the principal in logs and records: the API key's name, or
+// "admin". It is empty for anonymous requests.
+func (p *principal) name() string {
+	switch {
+	case p == nil:
+		return ""
+	case p.apiKey != nil:
+		return p.apiKey.Name
+	case p.admin:
+		return "admin"
+	}
+	return ""
+}
+
+type principalKey struct{}
+
+// principalFrom returns the authenticated principal, or nil for requests
+// without credentials (browser sessions on the internal network).
+func principalFrom(ctx context.Context) *principal {
+	p, _ := ctx.Value(principalKey{}).(*principal)
+	return p
+}
+
+// authenticate resolves the bearer token, if any, to the admin principal or an
+// API key. Requests that present invalid credentials are rejected, while
+// requests without an Authorization header continue unauthenticated.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || token == "" {
+			s.writeUnauthorized(w, r, "invalid authorization header")
+			return
+		}
+
+		if s.cfg.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AdminToken)) == 1 {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, &principal{admin: true})))
+			return
+		}
+
+		if !auth.IsAPIKey(token) {
+			s.writeUnauthorized(w, r, "invalid API key")
+			return
+		}
+
+		db := s.db.ExtensionsDB()
+		if db == nil {
+			s.writeDBUnavailable(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		key, err := auth.AuthenticateAPIKey(ctx, db, token)
+		if errors.Is(err, auth.ErrInvalidKey) {
+			s.writeUnauthorized(w, r, "invalid API key")
+			return
+		}
+		if err != nil {
+			s.log(r.Context()).Error("failed to authenticate API key", slog.Any("error", err))
+			s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to authenticate API key")
+			return
+		}
+
+		// Attribute the request to the key in the request log
+		if info := requestInfoFrom(r.Context()); info != nil {
+			info.apiKey = &key
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, &principal{apiKey: &key})))
+	})
+}
+
+// requireScope restricts API keys to routes covered by their scopes. The admin
+// token is not restricted, and neither are requests without an Authorization
+// header: they skip the scope check entirely, because browsers on the internal
+// network don't authenticate yet. requireScope is therefore not access
+// control, and no route may rely on it to keep anonymous clients out; add
+// requirePrincipal or requireAdmin for that.
+func (s *Server) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if p := principalFrom(r.Context()); p != nil && p.apiKey != nil && !p.apiKey.HasScope(scope) {
+				s.writeError(w, r, http.StatusForbidden, api.CodeForbidden, "API key does not have the "+scope+" scope")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requirePrincipal rejects requests without credentials. Combine it with
+// requireScope to limit API keys as well.
+func (s *Server) requirePrincipal(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if principalFrom(r.Context()) == nil {
+			s.writeUnauthorized(w, r, "authorization required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAdmin only lets requests through that presented the configured admin
+// token. The admin API is disabled when no token is set.
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p := principalFrom(r.Context()); p == nil || !p.admin {
+			s.writeUnauthorized(w, r, "admin authorization required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) writeUnauthorized(w http.ResponseWriter, r *http.Request, msg string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="aptora-extensions"`)
+	s.writeError(w, r, http.StatusUnauthorized, api.CodeUnauthorized, msg)
+}
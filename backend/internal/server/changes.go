@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/database"
+)
+
+// maxScanRows caps how many invoices one change scan reads. A window that
+// exceeds it should be shortened with CHANGE_SCAN_WINDOW_DAYS.
+const maxScanRows = 50000
+
+// invoicesSince returns every invoice dated on or after since, for the change
+// detector.
+func (s *Server) invoicesSince(ctx context.Context, since time.Time) ([]api.Invoice, error) {
+	invoices := []api.Invoice{}
+	err := s.withAptoraConn(ctx, func(conn database.Querier) error {
+		args := []any{since.Format("2006-01-02"), maxScanRows + 1}
+		rules, err := s.writeOffRules(ctx, &args)
+		if err != nil {
+			return err
+		}
+		rows, err := conn.QueryContext(ctx, `
+			SELECT TOP (@p2) i."Tran No", i."Tran Date", i."Sales Rep", i."Tran Subtotal", `+rules.reasonSQL()+`
+			FROM aptCDV_VW_APT_InvSalCredEstList i
+			WHERE i."Tran Type" = 'Invoice' AND i."Tran Date" >= @p1
+			ORDER BY i."Tran No" ASC`, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var inv api.Invoice
+			var date time.Time
+			var reason sql.NullString
+			if err := rows.Scan(&inv.Number, &date, &inv.EmployeeName, &inv.Subtotal, &reason); err != nil {
+				return err
+			}
+			inv.Date = date.Format("2006-01-02")
+			markWriteOff(&inv, reason)
+			invoices = append(invoices, inv)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recent invoices: %w", err)
+	}
+
+	// A truncated scan would report the missing invoices as removed
+	if len(invoices) > maxScanRows {
+		return nil, fmt.Errorf("change scan window holds more than %d invoices", maxScanRows)
+	}
+	return invoices, nil
+}
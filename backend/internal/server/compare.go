@@ -0,0 +1,281 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/database"
+)
+
+// dateRange is an inclusive range of days.
+type dateRange struct {
+	start, end time.Time
+}
+
+func (d dateRange) api() api.DateRange {
+	return api.DateRange{StartDate: d.start.Format("2006-01-02"), EndDate: d.end.Format("2006-01-02")}
+}
+
+// isWholeMonths reports whether the range starts on the 1st and ends on the
+// last day of a month.
+func (d dateRange) isWholeMonths() bool {
+	return d.start.Day() == 1 && d.end.AddDate(0, 0, 1).Day() == 1
+}
+
+// priorRange returns the range the basis compares d against.
+func priorRange(d dateRange, basis api.CompareBasis) dateRange {
+	if basis == api.ComparePriorYear {
+		return dateRange{start: shiftYear(d.start, false), end: shiftYear(d.end, d.end.AddDate(0, 0, 1).Day() == 1)}
+	}
+
+	if d.isWholeMonths() {
+		months := (d.end.Year()-d.start.Year())*12 + int(d.end.Month()-d.start.Month()) + 1
+		return dateRange{start: d.start.AddDate(0, -months, 0), end: d.start.AddDate(0, 0, -1)}
+	}
+	days := int(d.end.Sub(d.start).Hours()/24) + 1
+	return dateRange{start: d.start.AddDate(0, 0, -days), end: d.start.AddDate(0, 0, -1)}
+}
+
+// shiftYear returns the same day a year earlier, with February 29th
+// becoming February 28th rather than March 1st. With monthEnd the result is
+// the last day of the month, so a range ending February 28th is compared
+// through February 29th of a leap year.
+func shiftYear(day time.Time, monthEnd bool) time.Time {
+	if monthEnd {
+		first := time.Date(day.Year()-1, day.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return first.AddDate(0, 1, -1)
+	}
+	shifted := time.Date(day.Year()-1, day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	if shifted.Month() != day.Month() {
+		return shifted.AddDate(0, 0, -shifted.Day())
+	}
+	return shifted
+}
+
+// parseComparison validates the comparison range: either both
+// compare_start_date and compare_end_date, or vs (default prior_period).
+func parseComparison(q url.Values, current dateRange) (dateRange, error) {
+	startStr := strings.TrimSpace(q.Get("compare_start_date"))
+	endStr := strings.TrimSpace(q.Get("compare_end_date"))
+	vs := api.CompareBasis(strings.TrimSpace(q.Get("vs")))
+
+	if startStr == "" && endStr == "" {
+		if vs == "" {
+			vs = api.ComparePriorPeriod
+		}
+		if !slices.Contains(api.CompareBases, vs) {
+			return dateRange{}, errors.New("vs must be prior_period or prior_year")
+		}
+		return priorRange(current, vs), nil
+	}
+
+	if vs != "" {
+		return dateRange{}, errors.New("use either vs or compare_start_date and compare_end_date, not both")
+	}
+	if startStr == "" || endStr == "" {
+		return dateRange{}, errors.New("compare_start_date and compare_end_date must be given together")
+	}
+	start, err := time.Parse("2006-01-02", startStr)
+	if err != nil {
+		return dateRange{}, errors.New("compare_start_date must be in YYYY-MM-DD format")
+	}
+	end, err := time.Parse("2006-01-02", endStr)
+	if err != nil {
+		return dateRange{}, errors.New("compare_end_date must be in YYYY-MM-DD format")
+	}
+	if end.Before(start) {
+		return dateRange{}, errors.New("compare_end_date must not be before compare_start_date")
+	}
+	return dateRange{start: start, end: end}, nil
+}
+
+func (s *Server) handleCompareInvoices(w http.ResponseWriter, r *http.Request) {
+	db := s.db.AptoraDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	filter, err := parseInvoiceFilter(r.URL.Query())
+	if err == nil && filter.EndDate.Before(filter.StartDate) {
+		err = errors.New("end_date must not be before start_date")
+	}
+	var previous dateRange
+	current := dateRange{start: filter.StartDate, end: filter.EndDate}
+	if err == nil {
+		previous, err = parseComparison(r.URL.Query(), current)
+	}
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, err.Error())
+		return
+	}
+
+	attrs := append(filter.logAttrs(),
+		slog.String("compare_start_date", previous.start.Format("2006-01-02")),
+		slog.String("compare_end_date", previous.end.Format("2006-01-02")),
+	)
+	var totals map[string]repTotals
+	err = s.withQueryBudget(r.Context(), "invoices", attrs, func(ctx context.Context) error {
+		return s.withAptoraConn(ctx, func(conn database.Querier) error {
+			var err error
+			totals, err = s.queryRepTotals(ctx, conn, current, previous, filter.Employee)
+			return err
+		})
+	})
+	if err != nil {
+		s.writeQueryError(w, r, err, "failed to compare invoices")
+		return
+	}
+
+	resp := api.InvoiceComparisonResponse{
+		Current:  current.api(),
+		Previous: previous.api(),
+		Reps:     make([]api.RepComparison, 0, len(totals)),
+	}
+	var sum repTotals
+	for rep, t := range totals {
+		resp.Reps = append(resp.Reps, api.RepComparison{EmployeeName: rep, InvoiceMetrics: t.metrics()})
+		sum.count += t.count
+		sum.subtotal += t.subtotal
+		sum.cost += t.cost
+		sum.priorCount += t.priorCount
+		sum.priorSubtotal += t.priorSubtotal
+		sum.priorCost += t.priorCost
+	}
+	sum.hasCost = s.cfg.AptoraSources.InvoiceCostColumn != ""
+	resp.Total = sum.metrics()
+	slices.SortFunc(resp.Reps, func(a, b api.RepComparison) int {
+		if a.Subtotal.Current != b.Subtotal.Current {
+			if a.Subtotal.Current > b.Subtotal.Current {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.EmployeeName, b.EmployeeName)
+	})
+
+	s.writeJSONWithETag(w, r, resp)
+}
+
+// repTotals are a sales rep's invoice totals in two periods. Costs are only
+// summed when hasCost is set.
+type repTotals struct {
+	count         int
+	subtotal      float64
+	cost          float64
+	priorCount    int
+	priorSubtotal float64
+	priorCost     float64
+	hasCost       bool
+}
+
+func (t repTotals) metrics() api.InvoiceMetrics {
+	m := api.InvoiceMetrics{
+		Count:    metricChange(float64(t.count), float64(t.priorCount)),
+		Subtotal: metricChange(roundCents(t.subtotal), roundCents(t.priorSubtotal)),
+	}
+	if t.hasCost {
+		cost := metricChange(roundCents(t.cost), roundCents(t.priorCost))
+		grossProfit := metricChange(roundCents(t.subtotal-t.cost), roundCents(t.priorSubtotal-t.priorCost))
+		margin := metricChange(marginPercent(t.subtotal, t.cost), marginPercent(t.priorSubtotal, t.priorCost))
+		m.Cost, m.GrossProfit, m.GrossMarginPercent = &cost, &grossProfit, &margin
+	}
+	return m
+}
+
+// marginPercent returns gross profit as a percentage of subtotal, to one
+// decimal place, or 0 without a subtotal.
+func marginPercent(subtotal, cost float64) float64 {
+	if subtotal == 0 {
+		return 0
+	}
+	return math.Round((subtotal-cost)/subtotal*1000) / 10
+}
+
+func metricChange(current, previous float64) api.MetricChange {
+	return api.MetricChange{
+		Current:       current,
+		Previous:      previous,
+		Change:        roundCents(current - previous),
+		ChangePercent: percentChange(current, previous),
+	}
+}
+
+// queryRepTotals sums each sales rep's invoices in the current and prior
+// ranges in one pass. The ranges may overlap. An empty employee includes
+// every rep. Costs are summed when the invoice cost column is configured,
+// with a missing cost counting as zero.
+func (s *Server) queryRepTotals(ctx context.Context, db database.Querier, current, prior dateRange, employee string) (map[string]repTotals, error) {
+	// Without a cost column the costs are summed as zero and ignored
+	cost := "0"
+	costColumn := s.cfg.AptoraSources.InvoiceCostColumn
+	if costColumn != "" {
+		cost = "COALESCE(i." + quoteName(costColumn) + ", 0)"
+	}
+	query := `
+		SELECT i."Sales Rep",
+			SUM(CASE WHEN i."Tran Date" >= @p1 AND i."Tran Date" <= @p2 THEN 1 ELSE 0 END),
+			SUM(CASE WHEN i."Tran Date" >= @p1 AND i."Tran Date" <= @p2 THEN i."Tran Subtotal" ELSE 0 END),
+			SUM(CASE WHEN i."Tran Date" >= @p1 AND i."Tran Date" <= @p2 THEN ` + cost + ` ELSE 0 END),
+			SUM(CASE WHEN i."Tran Date" >= @p3 AND i."Tran Date" <= @p4 THEN 1 ELSE 0 END),
+			SUM(CASE WHEN i."Tran Date" >= @p3 AND i."Tran Date" <= @p4 THEN i."Tran Subtotal" ELSE 0 END),
+			SUM(CASE WHEN i."Tran Date" >= @p3 AND i."Tran Date" <= @p4 THEN ` + cost + ` ELSE 0 END)
+		FROM aptCDV_VW_APT_InvSalCredEstList i
+		WHERE i."Tran Type" = 'Invoice'
+			AND ((i."Tran Date" >= @p1 AND i."Tran Date" <= @p2) OR (i."Tran Date" >= @p3 AND i."Tran Date" <= @p4))`
+	args := []interface{}{
+		current.start.Format("2006-01-02"), current.end.Format("2006-01-02"),
+		prior.start.Format("2006-01-02"), prior.end.Format("2006-01-02"),
+	}
+	if employee != "" {
+		query += ` AND i."Sales Rep" = @p5`
+		args = append(args, employee)
+	}
+	query += ` GROUP BY i."Sales Rep"`
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sales rep totals: %w", err)
+	}
+	defer rows.Close()
+
+	totals := map[string]repTotals{}
+	for rows.Next() {
+		var rep string
+		t := repTotals{hasCost: costColumn != ""}
+		if err := rows.Scan(&rep, &t.count, &t.subtotal, &t.cost, &t.priorCount, &t.priorSubtotal, &t.priorCost); err != nil {
+			s.log(ctx).Error("failed to scan sales rep totals row", slog.Any("error", err))
+			continue
+		}
+		totals[rep] = t
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read sales rep totals: %w", err)
+	}
+
+	return totals, nil
+}
+
+// percentChange returns the change from prior to current as a percentage,
+// to one decimal place, or nil if there was nothing before.
+func percentChange(current, prior float64) *float64 {
+	if prior == 0 {
+		return nil
+	}
+	p := math.Round((current-prior)/math.Abs(prior)*1000) / 10
+	return &p
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
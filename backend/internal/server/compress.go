@@ -0,0 +1,289 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// compressMinSize is the smallest response body worth compressing. Smaller
+// bodies are sent as-is since the compression overhead outweighs the savings.
+const compressMinSize = 1024
+
+// brotliLevel trades some of Brotli's ratio for speed, since responses are
+// compressed on every request. It still beats gzip's default on JSON.
+const brotliLevel = 4
+
+// encoder is a compressing writer that can be pooled.
+type encoder interface {
+	io.Writer
+	Flush() error
+	Close() error
+	Reset(w io.Writer)
+}
+
+// compressEncoding is a content coding compress produces, with a pool of
+// its encoders.
+type compressEncoding struct {
+	name string
+	pool *sync.Pool
+}
+
+// compressEncodings lists the encodings compress produces, in order of
+// preference.
+var compressEncodings = []compressEncoding{
+	{"br", &sync.Pool{New: func() any { return brotli.NewWriterLevel(io.Discard, brotliLevel) }}},
+	{"gzip", &sync.Pool{New: func() any {
+		w, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return w
+	}}},
+}
+
+// compressibleTypes lists the media types that benefit from compression.
+var compressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"image/svg+xml",
+}
+
+// compress compresses responses with Brotli or gzip, whichever the client
+// accepts, preferring Brotli. Responses that are already encoded (such as
+// precompressed assets), small, or of a non-compressible type are passed
+// through untouched.
+func (s *Server) compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		i := slices.IndexFunc(compressEncodings, func(e compressEncoding) bool { return acceptsEncoding(r, e.name) })
+		if i < 0 || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+			encoding:       compressEncodings[i].name,
+			pool:           compressEncodings[i].pool,
+			ifNoneMatch:    r.Header.Get("If-None-Match"),
+		}
+		defer cw.Close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// acceptsEncoding reports whether the request's Accept-Encoding allows the
+// given content coding.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+			continue
+		}
+		// Honor explicit refusals such as "gzip;q=0"
+		if qStr, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, err := strconv.ParseFloat(qStr, 64)
+			return err == nil && q > 0
+		}
+		return true
+	}
+	return false
+}
+
+// compressWriter buffers the start of a response until it knows whether the
+// response is worth compressing.
+type compressWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	decided     bool
+	buf         bytes.Buffer
+	encoding    string     // the content coding used if the response is compressed
+	pool        *sync.Pool // of encoders for encoding
+	enc         encoder
+	ifNoneMatch string // the request's, to label 304s for compressed variants
+}
+
+func (cw *compressWriter) WriteHeader(statusCode int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.statusCode = statusCode
+
+	// Only full 200 responses are compressed; errors, partial content and
+	// 304s pass through unchanged
+	if statusCode != http.StatusOK {
+		_ = cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+
+	cw.buf.Write(b)
+	if cw.buf.Len() >= compressMinSize {
+		if err := cw.decide(cw.shouldCompress()); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush sends any buffered data to the client, deciding on compression
+// immediately if the response is still being buffered.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		_ = cw.decide(cw.buf.Len() >= compressMinSize && cw.shouldCompress())
+	}
+	if cw.enc != nil {
+		_ = cw.enc.Flush()
+	}
+	// The writer may itself be wrapped, e.g. by the request logger
+	_ = http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close completes the response, flushing any buffered or compressed data.
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		if !cw.wroteHeader {
+			// Handler never wrote anything; let net/http send its default response
+			cw.decided = true
+			return nil
+		}
+		if err := cw.decide(cw.buf.Len() >= compressMinSize && cw.shouldCompress()); err != nil {
+			return err
+		}
+	}
+	if cw.enc != nil {
+		err := cw.enc.Close()
+		cw.pool.Put(cw.enc)
+		cw.enc = nil
+		return err
+	}
+	return nil
+}
+
+// shouldCompress reports whether the response headers allow compression.
+func (cw *compressWriter) shouldCompress() bool {
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	// Event streams are flushed a few bytes at a time
+	if strings.HasPrefix(h.Get("Content-Type"), "text/event-stream") {
+		return false
+	}
+	contentType := h.Get("Content-Type")
+	for _, t := range compressibleTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// decide writes the response header and any buffered body, either through
+// an encoder or directly.
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+
+	// The compressed body differs from the identity one, so a strong ETag
+	// must too. A 304 confirming a client's cached compressed variant
+	// repeats its tag.
+	etag := cw.Header().Get("ETag")
+	variant := encodedETag(etag, cw.encoding)
+	if compress || (cw.statusCode == http.StatusNotModified && etagMatches(cw.ifNoneMatch, variant)) {
+		if etag != "" {
+			cw.Header().Set("ETag", variant)
+		}
+	}
+	if compress {
+		cw.Header().Set("Content-Encoding", cw.encoding)
+		cw.Header().Del("Content-Length")
+		cw.enc = cw.pool.Get().(encoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.statusCode)
+
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(cw.buf.Bytes())
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf.Bytes())
+	}
+	cw.buf.Reset()
+	return err
+}
+
+// precompressedEncodings lists the encodings produced at build time for the
+// frontend assets, in order of preference.
+var precompressedEncodings = []struct {
+	encoding  string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// servePrecompressed serves a build-time compressed variant of requestPath
+// from fsys if the client accepts one. It returns false if no suitable
+// variant exists, in which case nothing has been written.
+func servePrecompressed(w http.ResponseWriter, r *http.Request, fsys fs.FS, requestPath string) bool {
+	for _, pc := range precompressedEncodings {
+		if !acceptsEncoding(r, pc.encoding) {
+			continue
+		}
+
+		f, err := fsys.Open(requestPath + pc.extension)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+
+		stat, err := f.Stat()
+		rs, ok := f.(io.ReadSeeker)
+		if err != nil || !ok {
+			continue
+		}
+
+		if contentType := mime.TypeByExtension(path.Ext(requestPath)); contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Header().Set("Content-Encoding", pc.encoding)
+		http.ServeContent(w, r, requestPath, stat.ModTime(), rs)
+		return true
+	}
+	return false
+}
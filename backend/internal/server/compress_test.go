@@ -0,0 +1,59 @@
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestCompressEncodings(t *testing.T) {
+	body := strings.Repeat(`{"number":1,"employee_name":"Jane Doe"}`, 100)
+	handler := (&Server{}).compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"abc"`)
+		io.WriteString(w, body)
+	}))
+
+	tests := []struct {
+		acceptEncoding, encoding, etag string
+		decode                         func(io.Reader) (io.Reader, error)
+	}{
+		{"gzip, deflate, br", "br", `"abc-br"`, func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil }},
+		{"gzip, br;q=0", "gzip", `"abc-gzip"`, func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{"identity", "", `"abc"`, func(r io.Reader) (io.Reader, error) { return r, nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/invoices", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.encoding)
+			}
+			if got := rec.Header().Get("ETag"); got != tt.etag {
+				t.Errorf("ETag = %s, want %s", got, tt.etag)
+			}
+			r, err := tt.decode(rec.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := io.ReadAll(r); err != nil || string(got) != body {
+				t.Errorf("decoded body differs (%v)", err)
+			}
+		})
+	}
+
+	// Each encoded tag revalidates the cached response
+	for _, etag := range []string{`"abc"`, `"abc-gzip"`, `"abc-br"`} {
+		if !etagMatches(etag, `"abc"`) {
+			t.Errorf("If-None-Match %s doesn't match", etag)
+		}
+	}
+}
@@ -2,67 +2,59 @@ package server
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"log/slog"
 	"net/http"
-	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/database"
 )
 
 func (s *Server) handleEmployees(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
 	db := s.db.AptoraDB()
 	if db == nil {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		resp := map[string]string{"error": "database not available"}
-		if err := json.NewEncoder(w).Encode(resp); err != nil {
-			s.logger.Error("failed to encode error response", slog.Any("error", err))
-		}
+		s.writeDBUnavailable(w, r)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-	defer cancel()
-
-	rows, err := db.QueryContext(ctx, "SELECT id, Name FROM Employees WHERE inactive = 0")
+	var employees []api.Employee
+	err := s.withQueryBudget(r.Context(), "employees", nil, func(ctx context.Context) error {
+		return s.withAptoraConn(ctx, func(conn database.Querier) error {
+			var err error
+			employees, err = s.queryEmployees(ctx, conn)
+			return err
+		})
+	})
 	if err != nil {
-		s.logger.Error("failed to query employees", slog.Any("error", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		resp := map[string]string{"error": "failed to query employees"}
-		if err := json.NewEncoder(w).Encode(resp); err != nil {
-			s.logger.Error("failed to encode error response", slog.Any("error", err))
-		}
+		s.writeQueryError(w, r, err, "failed to query employees")
 		return
 	}
-	defer rows.Close()
 
-	type Employee struct {
-		ID   int    `json:"id"`
-		Name string `json:"name"`
+	resp := api.EmployeesResponse{Employees: employees}
+	s.writeJSONWithETag(w, r, resp)
+}
+
+// queryEmployees loads the active employees.
+func (s *Server) queryEmployees(ctx context.Context, db database.Querier) ([]api.Employee, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id, Name FROM Employees WHERE inactive = 0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query employees: %w", err)
 	}
+	defer rows.Close()
 
-	employees := []Employee{}
+	employees := []api.Employee{}
 	for rows.Next() {
-		var emp Employee
+		var emp api.Employee
 		if err := rows.Scan(&emp.ID, &emp.Name); err != nil {
-			s.logger.Error("failed to scan employee row", slog.Any("error", err))
+			s.log(ctx).Error("failed to scan employee row", slog.Any("error", err))
 			continue
 		}
 		employees = append(employees, emp)
 	}
 
 	if err := rows.Err(); err != nil {
-		s.logger.Error("error iterating employee rows", slog.Any("error", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		resp := map[string]string{"error": "failed to read employees"}
-		if err := json.NewEncoder(w).Encode(resp); err != nil {
-			s.logger.Error("failed to encode error response", slog.Any("error", err))
-		}
-		return
+		return nil, fmt.Errorf("failed to read employees: %w", err)
 	}
 
-	resp := map[string][]Employee{"employees": employees}
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		s.logger.Error("failed to encode employees response", slog.Any("error", err))
-	}
+	return employees, nil
 }
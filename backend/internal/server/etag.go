@@ -0,0 +1,89 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// hashedAssetPattern matches Vite build output such as assets/index-B1x2y3z4.js.
+// These filenames change whenever their content does, so they can be cached forever.
+var hashedAssetPattern = regexp.MustCompile(`^assets/.+-[A-Za-z0-9_-]{8,}\.[A-Za-z0-9]+$`)
+
+// writeJSONWithETag encodes v as the response body with a strong ETag derived
+// from the body. When the request's If-None-Match matches, it responds with
+// 304 Not Modified and no body instead.
+func (s *Server) writeJSONWithETag(w http.ResponseWriter, r *http.Request, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		s.log(r.Context()).Error("failed to encode response", slog.Any("error", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// Match json.Encoder output
+	body = append(body, '\n')
+
+	sum := sha256.Sum256(body)
+	etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	// Responses reflect live Aptora data, so clients must revalidate every time.
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if _, err := w.Write(body); err != nil {
+		s.log(r.Context()).Error("failed to write response", slog.Any("error", err))
+	}
+}
+
+// encodedETag returns the ETag of a response tagged etag once compress has
+// encoded it, marked with the encoding (`"abc-gzip"`, `"abc-br"`). Weak
+// ETags and ones already marked are returned unchanged.
+func encodedETag(etag, encoding string) string {
+	if etag == "" || strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	for _, e := range compressEncodings {
+		if strings.HasSuffix(etag, "-"+e.name+`"`) {
+			return etag
+		}
+	}
+	return strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag,
+// using the weak comparison required by RFC 9110 for If-None-Match. The
+// compressed variants' tags match too, since they have the same content.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+		for _, e := range compressEncodings {
+			if candidate == encodedETag(etag, e.name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// assetCacheControl returns the Cache-Control value for an embedded frontend file.
+func assetCacheControl(requestPath string) string {
+	if hashedAssetPattern.MatchString(requestPath) {
+		return "public, max-age=31536000, immutable"
+	}
+	return "no-cache"
+}
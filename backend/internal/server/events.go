@@ -0,0 +1,227 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/events"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/requestid"
+)
+
+const (
+	// eventHistory is how many recent events are kept for clients resuming
+	// with Last-Event-ID.
+	eventHistory = 500
+	// streamBuffer is how many events a stream can fall behind before it
+	// misses some and is sent a stream.reset.
+	streamBuffer = 64
+	// streamHeartbeat is how often an idle stream sends a comment, so
+	// proxies don't close it and dead clients are noticed.
+	streamHeartbeat = 15 * time.Second
+	// streamWriteTimeout bounds each write to a stream.
+	streamWriteTimeout = 10 * time.Second
+	// healthCheckInterval is how often the health state is checked for
+	// health.changed events.
+	healthCheckInterval = 5 * time.Second
+	// streamRetryAfter is the Retry-After sent to clients turned away because
+	// MaxEventStreams streams are open.
+	streamRetryAfter = 30 * time.Second
+)
+
+// handleEvents streams events to the client as server-sent events until the
+// client disconnects or the server shuts down.
+//
+// Event IDs are "<epoch>-<n>", where the epoch identifies this server
+// process. A client resuming with a Last-Event-ID from another process, or
+// one older than the remembered history, gets a stream.reset event telling
+// it to reload. At most MaxEventStreams streams are open at once; clients
+// beyond that get 503.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	// Streams don't use the database, and would keep reloaded pools open
+	releasePools(r.Context())
+
+	if n := s.streams.Add(1); n > int64(s.cfg.MaxEventStreams) {
+		s.streams.Add(-1)
+		s.log(r.Context()).Warn("refusing event stream: too many open streams", slog.Int64("streams", n-1))
+		s.writeRetryAfter(w, r, http.StatusServiceUnavailable, api.CodeOverloaded, streamRetryAfter, "too many open event streams, please try again later")
+		return
+	}
+	defer s.streams.Add(-1)
+
+	rc := http.NewResponseController(w)
+	name := "stream " + requestid.From(r.Context())
+
+	var (
+		missed      []events.Event
+		complete    = true
+		ch          <-chan events.Event
+		unsubscribe func()
+	)
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		if after, ok := s.parseEventID(lastEventID); ok {
+			missed, complete, ch, unsubscribe = s.events.SubscribeAfter(name, streamBuffer, after)
+		} else {
+			complete = false
+		}
+	}
+	if ch == nil {
+		ch, unsubscribe = s.events.Subscribe(name, streamBuffer)
+	}
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	// Stop nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// last is the ID of the last event sent, or 0 until one is
+	var last uint64
+	send := func(write func() error) bool {
+		_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if err := write(); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+	sendEvent := func(e events.Event) bool {
+		// A gap in IDs means this stream fell behind and missed events
+		if last != 0 && e.ID != last+1 {
+			if !send(func() error { return s.writeStreamReset(w) }) {
+				return false
+			}
+		}
+		last = e.ID
+		return send(func() error { return s.writeStreamEvent(w, e) })
+	}
+
+	ok := send(func() error {
+		_, err := fmt.Fprintf(w, "retry: %d\n\n", (5 * time.Second).Milliseconds())
+		return err
+	})
+	if ok && !complete {
+		ok = send(func() error { return s.writeStreamReset(w) })
+	}
+	for _, e := range missed {
+		if !ok {
+			break
+		}
+		ok = sendEvent(e)
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for ok {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		case e, open := <-ch:
+			if !open {
+				return
+			}
+			ok = sendEvent(e)
+		case <-heartbeat.C:
+			ok = send(func() error {
+				_, err := fmt.Fprint(w, ": heartbeat\n\n")
+				return err
+			})
+		}
+	}
+	s.log(r.Context()).Debug("event stream closed by failed write")
+}
+
+// writeStreamEvent writes e in server-sent event format. Events without a
+// stream representation are skipped.
+func (s *Server) writeStreamEvent(w http.ResponseWriter, e events.Event) error {
+	ev := api.StreamEvent{Type: api.StreamEventType(e.Type), Time: e.Time}
+	switch data := e.Data.(type) {
+	case events.InvoiceChange:
+		ev.Invoice = &data.Invoice
+		ev.Previous = data.Previous
+	case api.HealthResponse:
+		ev.Health = &data
+	case events.ReviewChange:
+		ev.Invoice = &data.Invoice
+		ev.Review = &data.Review
+		ev.PreviousStatus = data.Previous
+	default:
+		return nil
+	}
+	return writeSSE(w, s.streamEpoch+"-"+strconv.FormatUint(e.ID, 10), ev)
+}
+
+// writeStreamReset tells the client it missed events. It has no ID, so the
+// client's Last-Event-ID is left unchanged.
+func (s *Server) writeStreamReset(w http.ResponseWriter) error {
+	return writeSSE(w, "", api.StreamEvent{Type: api.StreamReset, Time: time.Now().UTC()})
+}
+
+func writeSSE(w http.ResponseWriter, id string, ev api.StreamEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	if id != "" {
+		b.WriteString("id: " + id + "\n")
+	}
+	b.WriteString("event: " + string(ev.Type) + "\n")
+	b.WriteString("data: " + string(data) + "\n\n")
+	_, err = w.Write([]byte(b.String()))
+	return err
+}
+
+// parseEventID returns the bus event ID of a Last-Event-ID sent by a client,
+// or false if it isn't from this server process.
+func (s *Server) parseEventID(id string) (uint64, bool) {
+	epoch, n, ok := strings.Cut(id, "-")
+	if !ok || epoch != s.streamEpoch {
+		return 0, false
+	}
+	after, err := strconv.ParseUint(n, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return after, true
+}
+
+// watchHealth publishes a health.changed event whenever the database health
+// changes, until ctx is cancelled.
+func (s *Server) watchHealth(ctx context.Context) {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	previous, _ := s.db.IsHealthy()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		healthy, _ := s.db.IsHealthy()
+		if healthy == previous {
+			continue
+		}
+		previous = healthy
+
+		// The error message is left out, since streams aren't limited to
+		// admins
+		health := api.HealthResponse{Status: "healthy"}
+		if !healthy {
+			health = api.HealthResponse{Status: "unhealthy", Code: api.CodeDBUnavailable}
+		}
+		s.logger.Info("health state changed", slog.String("status", health.Status))
+		s.events.Publish(events.HealthChanged, health)
+	}
+}
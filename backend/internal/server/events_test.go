@@ -0,0 +1,99 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/database"
+)
+
+func newEventsTestServer(t *testing.T, maxStreams int) *httptest.Server {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewServer(logger, Config{AdminToken: "admin-secret", MaxEventStreams: maxStreams}, database.NewManager(logger, database.Config{}))
+	ts := httptest.NewServer(s.router)
+	t.Cleanup(func() {
+		close(s.closing)
+		ts.Close()
+	})
+	return ts
+}
+
+// openStream requests /api/events, and for a 200 response waits until the
+// stream has started.
+func openStream(t *testing.T, url, token string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url+"/api/events", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /api/events failed: %v", err)
+	}
+	if resp.StatusCode == http.StatusOK {
+		line, err := bufio.NewReader(resp.Body).ReadString('\n')
+		if err != nil || !strings.HasPrefix(line, "retry:") {
+			t.Fatalf("stream started with %q (%v), want a retry field", line, err)
+		}
+	}
+	return resp
+}
+
+func TestEventsRequireCredentials(t *testing.T) {
+	ts := newEventsTestServer(t, 10)
+
+	resp := openStream(t, ts.URL, "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("anonymous stream got %d, want 401", resp.StatusCode)
+	}
+	if resp.Header.Get("WWW-Authenticate") == "" {
+		t.Error("401 response has no WWW-Authenticate header")
+	}
+
+	resp = openStream(t, ts.URL, "admin-secret")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("admin stream got %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestEventsStreamCap(t *testing.T) {
+	ts := newEventsTestServer(t, 2)
+
+	first := openStream(t, ts.URL, "admin-secret")
+	second := openStream(t, ts.URL, "admin-secret")
+	defer second.Body.Close()
+	if first.StatusCode != http.StatusOK || second.StatusCode != http.StatusOK {
+		t.Fatalf("streams within the cap got %d and %d, want 200", first.StatusCode, second.StatusCode)
+	}
+
+	refused := openStream(t, ts.URL, "admin-secret")
+	refused.Body.Close()
+	if refused.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("stream over the cap got %d, want 503", refused.StatusCode)
+	}
+	if refused.Header.Get("Retry-After") == "" {
+		t.Error("503 response has no Retry-After header")
+	}
+
+	// Closing a stream frees its place
+	first.Body.Close()
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		resp := openStream(t, ts.URL, "admin-secret")
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stream after one closed got %d, want 200", resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/goals"
+)
+
+func (s *Server) handleListSalesGoals(w http.ResponseWriter, r *http.Request) {
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	month := time.Now().Format("2006-01")
+	if v := r.URL.Query().Get("month"); v != "" {
+		month = v
+	}
+	first, err := goals.ParseMonth(month)
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	list, err := goals.List(ctx, db, first)
+	if err != nil {
+		s.log(r.Context()).Error("failed to list sales goals", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to list sales goals")
+		return
+	}
+
+	resp := api.SalesGoalsResponse{Goals: list}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleSetSalesGoal(w http.ResponseWriter, r *http.Request) {
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	var req api.SetSalesGoalRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err == nil {
+		err = goals.ValidateGoal(req)
+	}
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, "invalid sales goal: "+err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := goals.Set(ctx, db, req); err != nil {
+		s.log(r.Context()).Error("failed to set sales goal", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to set sales goal")
+		return
+	}
+
+	s.log(r.Context()).Info("set sales goal", slog.Int("employee_id", req.EmployeeID), slog.String("month", req.Month))
+	w.WriteHeader(http.StatusNoContent)
+}
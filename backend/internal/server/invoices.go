@@ -2,133 +2,210 @@ package server
 
 import (
 	"context"
-	"encoding/json"
+	"database/sql"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/database"
 )
 
-func (s *Server) handleInvoices(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// maxInvoiceRows is the largest result the invoices endpoint will return.
+const maxInvoiceRows = 500
+
+// invoiceFilter holds the normalized query parameters for invoice queries.
+type invoiceFilter struct {
+	StartDate time.Time
+	EndDate   time.Time
+	Employee  string
+	WriteOff  *bool // only write-offs, or only other invoices; nil for both
+}
+
+// invoiceResult is the cached outcome of an invoice query. Invoices is only
+// populated when Count is within the row limit of the query.
+type invoiceResult struct {
+	Count    int
+	Invoices []api.Invoice
+}
+
+// parseInvoiceFilter validates and normalizes the invoice query parameters.
+func parseInvoiceFilter(q url.Values) (invoiceFilter, error) {
+	startStr := strings.TrimSpace(q.Get("start_date"))
+	endStr := strings.TrimSpace(q.Get("end_date"))
+	if startStr == "" || endStr == "" {
+		return invoiceFilter{}, errors.New("start_date and end_date are required (YYYY-MM-DD format)")
+	}
+
+	start, err := time.Parse("2006-01-02", startStr)
+	if err != nil {
+		return invoiceFilter{}, errors.New("start_date must be in YYYY-MM-DD format")
+	}
+	end, err := time.Parse("2006-01-02", endStr)
+	if err != nil {
+		return invoiceFilter{}, errors.New("end_date must be in YYYY-MM-DD format")
+	}
+
+	return invoiceFilter{
+		StartDate: start,
+		EndDate:   end,
+		Employee:  strings.TrimSpace(q.Get("employee")),
+	}, nil
+}
 
+// cacheKey returns a stable key for the filter, so equivalent requests share
+// a cache entry regardless of parameter order or formatting.
+func (f invoiceFilter) cacheKey() string {
+	key := fmt.Sprintf("invoices|%s|%s|%s", f.StartDate.Format("2006-01-02"), f.EndDate.Format("2006-01-02"), f.Employee)
+	if f.WriteOff != nil {
+		key += "|write_off=" + strconv.FormatBool(*f.WriteOff)
+	}
+	return key
+}
+
+// logAttrs describes the filter in slow query logs.
+func (f invoiceFilter) logAttrs() []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("start_date", f.StartDate.Format("2006-01-02")),
+		slog.String("end_date", f.EndDate.Format("2006-01-02")),
+		slog.String("employee", f.Employee),
+	}
+	if f.WriteOff != nil {
+		attrs = append(attrs, slog.Bool("is_write_off", *f.WriteOff))
+	}
+	return attrs
+}
+
+// invoiceCacheTTL returns how long results for the filter may be cached. Ranges
+// that end before the current month are historical and rarely change.
+func (s *Server) invoiceCacheTTL(f invoiceFilter) time.Duration {
+	now := time.Now()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if f.EndDate.Before(monthStart) {
+		return s.cfg.QueryCacheHistoricalTTL
+	}
+	return s.cfg.QueryCacheTTL
+}
+
+func (s *Server) handleInvoices(w http.ResponseWriter, r *http.Request) {
 	db := s.db.AptoraDB()
 	if db == nil {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		resp := map[string]string{"error": "database not available"}
-		if err := json.NewEncoder(w).Encode(resp); err != nil {
-			s.logger.Error("failed to encode error response", slog.Any("error", err))
-		}
+		s.writeDBUnavailable(w, r)
 		return
 	}
 
 	// Parse and validate query parameters
-	startDate := r.URL.Query().Get("start_date")
-	endDate := r.URL.Query().Get("end_date")
-	employeeStr := r.URL.Query().Get("employee")
-
-	if startDate == "" || endDate == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		resp := map[string]string{"error": "start_date and end_date are required (YYYY-MM-DD format)"}
-		if err := json.NewEncoder(w).Encode(resp); err != nil {
-			s.logger.Error("failed to encode error response", slog.Any("error", err))
+	filter, err := parseInvoiceFilter(r.URL.Query())
+	if v := strings.TrimSpace(r.URL.Query().Get("is_write_off")); err == nil && v != "" {
+		writeOff, parseErr := strconv.ParseBool(v)
+		if parseErr != nil {
+			err = errors.New("is_write_off must be true or false")
 		}
+		filter.WriteOff = &writeOff
+	}
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, err.Error())
 		return
 	}
 
-	// Build query - join with Employees to get employee name
-	query := `
-		SELECT i."Tran No" as Number, i."Tran Date", i."Sales Rep", i."Tran Subtotal"
-		FROM aptCDV_VW_APT_InvSalCredEstList i
-		WHERE i."Tran Date" >= @p1 AND i."Tran Date" <= @p2 AND i."Tran Type" = 'Invoice'`
-	args := []interface{}{startDate, endDate}
+	result, cached, err := s.invoiceCache.GetOrLoad(r.Context(), filter.cacheKey(), func(ctx context.Context) (invoiceResult, time.Duration, error) {
+		var result invoiceResult
+		err := s.withQueryBudget(ctx, "invoices", filter.logAttrs(), func(ctx context.Context) error {
+			return s.withAptoraConn(ctx, func(conn database.Querier) error {
+				var err error
+				result, err = s.queryInvoices(ctx, conn, filter, maxInvoiceRows)
+				return err
+			})
+		})
+		return result, s.invoiceCacheTTL(filter), err
+	})
+	if err != nil {
+		s.writeQueryError(w, r, err, "failed to query invoices")
+		return
+	}
 
-	if employeeStr != "" {
-		query += ` AND i."Sales Rep" = @p3`
-		args = append(args, employeeStr)
+	if cached {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
 	}
 
-	// Sort by date ascending by default
-	query += ` ORDER BY i."Tran Date" ASC, i."Tran No" ASC`
+	if result.Count > maxInvoiceRows {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeTooManyRows,
+			fmt.Sprintf("query would return more than %d invoices, please use a narrower filter", maxInvoiceRows))
+		return
+	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-	defer cancel()
+	resp := api.InvoicesResponse{Invoices: result.Invoices}
+	s.writeJSONWithETag(w, r, resp)
+}
 
-	// First, check count to enforce 500 limit
-	countQuery := `
-		SELECT COUNT(*) 
+// queryInvoices counts the matching invoices and, if the count is within
+// limit, loads them.
+func (s *Server) queryInvoices(ctx context.Context, db database.Querier, filter invoiceFilter, limit int) (invoiceResult, error) {
+	where := `
 		FROM aptCDV_VW_APT_InvSalCredEstList i
 		WHERE i."Tran Date" >= @p1 AND i."Tran Date" <= @p2 AND i."Tran Type" = 'Invoice'`
-	if employeeStr != "" {
-		countQuery += ` AND i."Sales Rep" = @p3`
+	args := []interface{}{filter.StartDate.Format("2006-01-02"), filter.EndDate.Format("2006-01-02")}
+
+	if filter.Employee != "" {
+		where += ` AND i."Sales Rep" = @p3`
+		args = append(args, filter.Employee)
 	}
-	var count int
-	if err := db.QueryRowContext(ctx, countQuery, args...).Scan(&count); err != nil {
-		s.logger.Error("failed to count invoices", slog.Any("error", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		resp := map[string]string{"error": "failed to count invoices"}
-		if err := json.NewEncoder(w).Encode(resp); err != nil {
-			s.logger.Error("failed to encode error response", slog.Any("error", err))
+	rules, err := s.writeOffRules(ctx, &args)
+	if err != nil {
+		return invoiceResult{}, err
+	}
+	if filter.WriteOff != nil {
+		if *filter.WriteOff {
+			where += ` AND ` + rules.condition()
+		} else {
+			where += ` AND NOT ` + rules.condition()
 		}
-		return
 	}
 
-	if count > 500 {
-		w.WriteHeader(http.StatusBadRequest)
-		resp := map[string]string{"error": "query would return more than 500 invoices, please use a narrower filter"}
-		if err := json.NewEncoder(w).Encode(resp); err != nil {
-			s.logger.Error("failed to encode error response", slog.Any("error", err))
-		}
-		return
+	// First, check count to enforce the row limit
+	var count int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) `+where, args...).Scan(&count); err != nil {
+		return invoiceResult{}, fmt.Errorf("failed to count invoices: %w", err)
 	}
 
-	// Execute main query
+	if count > limit {
+		return invoiceResult{Count: count}, nil
+	}
+
+	// Sort by date ascending by default
+	query := `SELECT i."Tran No" as Number, i."Tran Date", i."Sales Rep", i."Tran Subtotal", ` + rules.reasonSQL() + where +
+		` ORDER BY i."Tran Date" ASC, i."Tran No" ASC`
+
 	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
-		s.logger.Error("failed to query invoices", slog.Any("error", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		resp := map[string]string{"error": "failed to query invoices"}
-		if err := json.NewEncoder(w).Encode(resp); err != nil {
-			s.logger.Error("failed to encode error response", slog.Any("error", err))
-		}
-		return
+		return invoiceResult{}, fmt.Errorf("failed to query invoices: %w", err)
 	}
 	defer rows.Close()
 
-	type Invoice struct {
-		Number       int     `json:"number"`
-		Date         string  `json:"date"`
-		EmployeeName string  `json:"employee_name"`
-		Subtotal     float64 `json:"subtotal"`
-		// TODO: add total_cost
-		// TODO: add gross_profit (subtotal - total_cost)
-		// TODO: add gross_profit_percentage gross_profit / subtotal
-		// TODO: add is_write_off
-	}
-
-	invoices := []Invoice{}
+	invoices := []api.Invoice{}
 	for rows.Next() {
-		var inv Invoice
+		var inv api.Invoice
 		var date time.Time
-		if err := rows.Scan(&inv.Number, &date, &inv.EmployeeName, &inv.Subtotal); err != nil {
-			s.logger.Error("failed to scan invoice row", slog.Any("error", err))
+		var reason sql.NullString
+		if err := rows.Scan(&inv.Number, &date, &inv.EmployeeName, &inv.Subtotal, &reason); err != nil {
+			s.log(ctx).Error("failed to scan invoice row", slog.Any("error", err))
 			continue
 		}
 		inv.Date = date.Format("2006-01-02")
+		markWriteOff(&inv, reason)
 		invoices = append(invoices, inv)
 	}
 
 	if err := rows.Err(); err != nil {
-		s.logger.Error("error iterating invoice rows", slog.Any("error", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		resp := map[string]string{"error": "failed to read invoices"}
-		if err := json.NewEncoder(w).Encode(resp); err != nil {
-			s.logger.Error("failed to encode error response", slog.Any("error", err))
-		}
-		return
+		return invoiceResult{}, fmt.Errorf("failed to read invoices: %w", err)
 	}
 
-	resp := map[string][]Invoice{"invoices": invoices}
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		s.logger.Error("failed to encode invoices response", slog.Any("error", err))
-	}
+	return invoiceResult{Count: count, Invoices: invoices}, nil
 }
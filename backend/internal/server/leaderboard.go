@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/database"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/goals"
+)
+
+// leaderboardRange holds the dates a leaderboard covers. The prior period
+// is cut to the same number of days as the current one has had so far.
+type leaderboardRange struct {
+	start, end, asOf       time.Time
+	priorStart, priorEnd   time.Time
+	elapsedDays, totalDays int
+	months                 int
+}
+
+func newLeaderboardRange(period api.LeaderboardPeriod, now time.Time) leaderboardRange {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	var start time.Time
+	var months int
+	switch period {
+	case api.LeaderboardQuarter:
+		start = time.Date(today.Year(), (today.Month()-1)/3*3+1, 1, 0, 0, 0, 0, time.UTC)
+		months = 3
+	case api.LeaderboardYear:
+		start = time.Date(today.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+		months = 12
+	default: // api.LeaderboardMonth
+		start = time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+		months = 1
+	}
+
+	lr := leaderboardRange{
+		start:       start,
+		end:         start.AddDate(0, months, -1),
+		asOf:        today,
+		priorStart:  start.AddDate(0, -months, 0),
+		elapsedDays: int(today.Sub(start).Hours()/24) + 1,
+		months:      months,
+	}
+	lr.totalDays = int(lr.end.Sub(start).Hours()/24) + 1
+
+	// A prior period shorter than the days elapsed, like February compared
+	// from March 31st, is compared whole
+	lr.priorEnd = lr.priorStart.AddDate(0, 0, lr.elapsedDays-1)
+	if !lr.priorEnd.Before(start) {
+		lr.priorEnd = start.AddDate(0, 0, -1)
+	}
+	return lr
+}
+
+func (s *Server) handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	db := s.db.AptoraDB()
+	extDB := s.db.ExtensionsDB()
+	if db == nil || extDB == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	period := api.LeaderboardPeriod(strings.TrimSpace(r.URL.Query().Get("period")))
+	if period == "" {
+		period = api.LeaderboardMonth
+	}
+	if !slices.Contains(api.LeaderboardPeriods, period) {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, "period must be month, quarter or year")
+		return
+	}
+	lr := newLeaderboardRange(period, time.Now())
+
+	var employees []api.Employee
+	var totals map[string]repTotals
+	err := s.withQueryBudget(r.Context(), "leaderboard", []slog.Attr{slog.String("period", string(period))}, func(ctx context.Context) error {
+		return s.withAptoraConn(ctx, func(conn database.Querier) error {
+			var err error
+			if employees, err = s.queryEmployees(ctx, conn); err != nil {
+				return err
+			}
+			totals, err = s.queryRepTotals(ctx, conn,
+				dateRange{start: lr.start, end: lr.asOf}, dateRange{start: lr.priorStart, end: lr.priorEnd}, "")
+			return err
+		})
+	})
+	if err != nil {
+		s.writeQueryError(w, r, err, "failed to query leaderboard")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	goalTotals, err := goals.Sum(ctx, extDB, lr.start, lr.end)
+	if err != nil {
+		s.log(r.Context()).Error("failed to load sales goals", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to load sales goals")
+		return
+	}
+
+	resp := api.LeaderboardResponse{
+		Period:         period,
+		StartDate:      lr.start.Format("2006-01-02"),
+		EndDate:        lr.end.Format("2006-01-02"),
+		AsOf:           lr.asOf.Format("2006-01-02"),
+		PriorStartDate: lr.priorStart.Format("2006-01-02"),
+		PriorEndDate:   lr.priorEnd.Format("2006-01-02"),
+		Entries:        leaderboardEntries(employees, totals, goalTotals, lr, s.cfg.AptoraSources.InvoiceCostColumn != ""),
+	}
+	s.writeJSONWithETag(w, r, resp)
+}
+
+// leaderboardEntries ranks the employees by revenue. Employees with equal
+// revenue share a rank. Gross profit is only shown with hasCost, when
+// invoice costs are read from Aptora.
+func leaderboardEntries(employees []api.Employee, totals map[string]repTotals, goalTotals map[int]goals.Totals, lr leaderboardRange, hasCost bool) []api.LeaderboardEntry {
+	entries := make([]api.LeaderboardEntry, 0, len(employees))
+	for _, emp := range employees {
+		t := totals[emp.Name]
+		g := goalTotals[emp.ID]
+		e := api.LeaderboardEntry{
+			EmployeeID:       emp.ID,
+			EmployeeName:     emp.Name,
+			InvoiceCount:     t.count,
+			Revenue:          roundCents(t.subtotal),
+			ProjectedRevenue: roundCents(t.subtotal / float64(lr.elapsedDays) * float64(lr.totalDays)),
+			PriorRevenue:     roundCents(t.priorSubtotal),
+			Change:           roundCents(t.subtotal - t.priorSubtotal),
+			ChangePercent:    percentChange(t.subtotal, t.priorSubtotal),
+		}
+		e.RevenueGoal, e.RevenueGoalMissingMonths = periodGoal(g.Revenue, g.RevenueMonths, lr.months)
+		e.GrossProfitGoal, e.GrossProfitGoalMissingMonths = periodGoal(g.GrossProfit, g.GrossProfitMonths, lr.months)
+		if e.RevenueGoal != nil && *e.RevenueGoal > 0 {
+			e.GoalProgress = percentOf(t.subtotal, *e.RevenueGoal)
+			e.ProjectedProgress = percentOf(e.ProjectedRevenue, *e.RevenueGoal)
+		}
+		if hasCost {
+			grossProfit := roundCents(t.subtotal - t.cost)
+			projected := roundCents((t.subtotal - t.cost) / float64(lr.elapsedDays) * float64(lr.totalDays))
+			e.GrossProfit, e.ProjectedGrossProfit = &grossProfit, &projected
+			if e.GrossProfitGoal != nil && *e.GrossProfitGoal > 0 {
+				e.GrossProfitProgress = percentOf(grossProfit, *e.GrossProfitGoal)
+				e.ProjectedGrossProfitProgress = percentOf(projected, *e.GrossProfitGoal)
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	slices.SortStableFunc(entries, func(a, b api.LeaderboardEntry) int {
+		if a.Revenue != b.Revenue {
+			if a.Revenue > b.Revenue {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.EmployeeName, b.EmployeeName)
+	})
+	for i := range entries {
+		entries[i].Rank = i + 1
+		if i > 0 && entries[i].Revenue == entries[i-1].Revenue {
+			entries[i].Rank = entries[i-1].Rank
+		}
+	}
+	return entries
+}
+
+// periodGoal returns a goal summed over the months that have one, or nil
+// unless every month of the period does, with the number of months missing
+// one. A missing month isn't taken as a goal of zero.
+func periodGoal(sum *float64, months, periodMonths int) (*float64, int) {
+	if missing := periodMonths - months; missing > 0 {
+		return nil, missing
+	}
+	return sum, 0
+}
+
+// percentOf returns part as a percentage of whole, to one decimal place.
+func percentOf(part, whole float64) *float64 {
+	p := math.Round(part/whole*1000) / 10
+	return &p
+}
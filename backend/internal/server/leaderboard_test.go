@@ -0,0 +1,52 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/goals"
+)
+
+func TestLeaderboardGoals(t *testing.T) {
+	lr := newLeaderboardRange(api.LeaderboardQuarter, time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC))
+	employees := []api.Employee{{ID: 1, Name: "Jane Doe"}, {ID: 2, Name: "John Roe"}}
+	totals := map[string]repTotals{
+		"Jane Doe": {count: 4, subtotal: 3000, cost: 1800},
+		"John Roe": {count: 2, subtotal: 1000, cost: 400},
+	}
+	revenue, grossProfit := 12000.0, 4000.0
+	goalTotals := map[int]goals.Totals{
+		1: {Revenue: &revenue, GrossProfit: &grossProfit, RevenueMonths: 3, GrossProfitMonths: 3},
+		2: {Revenue: &revenue, GrossProfit: &grossProfit, RevenueMonths: 3, GrossProfitMonths: 1},
+	}
+
+	entries := leaderboardEntries(employees, totals, goalTotals, lr, true)
+	jane, john := entries[0], entries[1]
+	if jane.EmployeeID != 1 || john.EmployeeID != 2 {
+		t.Fatalf("entries ranked %d, %d, want 1, 2", jane.EmployeeID, john.EmployeeID)
+	}
+	if jane.GrossProfit == nil || *jane.GrossProfit != 1200 {
+		t.Errorf("gross profit = %v, want 1200", jane.GrossProfit)
+	}
+	if jane.GrossProfitProgress == nil || *jane.GrossProfitProgress != 30 {
+		t.Errorf("gross profit progress = %v, want 30", jane.GrossProfitProgress)
+	}
+
+	// Two months without a gross profit goal leave it missing, not summed
+	// as zero
+	if john.GrossProfitGoal != nil || john.GrossProfitProgress != nil || john.GrossProfitGoalMissingMonths != 2 {
+		t.Errorf("partial gross profit goal = %v, progress %v, %d missing months; want null, null, 2",
+			john.GrossProfitGoal, john.GrossProfitProgress, john.GrossProfitGoalMissingMonths)
+	}
+	if john.RevenueGoal == nil || john.RevenueGoalMissingMonths != 0 {
+		t.Errorf("complete revenue goal = %v with %d missing months", john.RevenueGoal, john.RevenueGoalMissingMonths)
+	}
+
+	// Without costs gross profit isn't shown, and employees without goals
+	// are missing every month
+	entries = leaderboardEntries(employees, totals, nil, lr, false)
+	if e := entries[0]; e.GrossProfit != nil || e.ProjectedGrossProfit != nil || e.RevenueGoalMissingMonths != 3 {
+		t.Errorf("entry without costs or goals = %+v", e)
+	}
+}
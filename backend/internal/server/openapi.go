@@ -0,0 +1,57 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+)
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, api.OpenAPI())
+}
+
+// CheckOpenAPI compares the router with api.Endpoints and returns an error
+// listing any route missing from either side. cmd/apigen -check runs it in CI
+// so the published spec can't drift from the handlers; the package tests also
+// check each handler's response type and status against its entry.
+func (s *Server) CheckOpenAPI() error {
+	registered := map[string]bool{}
+	err := chi.Walk(s.router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		// Skip the SPA catch-all and chi's implicit trailing-slash variants
+		if strings.HasSuffix(route, "/*") || (strings.HasSuffix(route, "/") && route != "/") {
+			return nil
+		}
+		registered[method+" "+route] = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk routes: %w", err)
+	}
+
+	documented := map[string]bool{}
+	for _, ep := range api.Endpoints {
+		documented[ep.Method+" "+ep.Path] = true
+	}
+
+	var problems []string
+	for route := range registered {
+		if !documented[route] {
+			problems = append(problems, "route not in api.Endpoints: "+route)
+		}
+	}
+	for route := range documented {
+		if !registered[route] {
+			problems = append(problems, "api.Endpoints entry has no route: "+route)
+		}
+	}
+
+	if len(problems) > 0 {
+		slices.Sort(problems)
+		return fmt.Errorf("OpenAPI spec and router disagree:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/database"
+)
+
+func newSpecTestServer() *Server {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := Config{AdminToken: "admin-secret", LogLevel: new(slog.LevelVar)}
+	return NewServer(logger, cfg, database.NewManager(logger, database.Config{}))
+}
+
+func TestOpenAPIMatchesRouter(t *testing.T) {
+	if err := newSpecTestServer().CheckOpenAPI(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// specResponse is what a handler writes on success.
+type specResponse struct {
+	body        any // zero value of the response type; nil for no body
+	status      int
+	contentType string // for non-JSON bodies
+}
+
+// handlerResponses lists what each route's handler writes on success. A
+// handler that changes its response must change this table too, and the
+// test then holds api.Endpoints, and so the spec and the TypeScript types,
+// to it.
+var handlerResponses = map[string]specResponse{
+	"GET /health":                                   {api.HealthResponse{}, http.StatusOK, ""},
+	"GET /api/openapi.json":                         {map[string]any{}, http.StatusOK, ""},
+	"GET /api/employees":                            {api.EmployeesResponse{}, http.StatusOK, ""},
+	"GET /api/invoices":                             {api.InvoicesResponse{}, http.StatusOK, ""},
+	"GET /api/invoices/compare":                     {api.InvoiceComparisonResponse{}, http.StatusOK, ""},
+	"GET /api/invoices/{number}/review":             {api.InvoiceReview{}, http.StatusOK, ""},
+	"PUT /api/invoices/{number}/review":             {api.InvoiceReview{}, http.StatusOK, ""},
+	"GET /api/leaderboard":                          {api.LeaderboardResponse{}, http.StatusOK, ""},
+	"GET /api/reports/sales.pdf":                    {nil, http.StatusOK, "application/pdf"},
+	"GET /api/write-offs":                           {api.WriteOffsResponse{}, http.StatusOK, ""},
+	"GET /api/events":                               {api.StreamEvent{}, http.StatusOK, "text/event-stream"},
+	"DELETE /api/admin/cache":                       {api.PurgeCacheResponse{}, http.StatusOK, ""},
+	"GET /api/admin/log-level":                      {api.LogLevel{}, http.StatusOK, ""},
+	"PUT /api/admin/log-level":                      {api.LogLevel{}, http.StatusOK, ""},
+	"GET /api/admin/api-keys":                       {api.APIKeysResponse{}, http.StatusOK, ""},
+	"POST /api/admin/api-keys":                      {api.CreatedAPIKey{}, http.StatusCreated, ""},
+	"DELETE /api/admin/api-keys/{id}":               {nil, http.StatusNoContent, ""},
+	"GET /api/admin/report-subscriptions":           {api.ReportSubscriptionsResponse{}, http.StatusOK, ""},
+	"POST /api/admin/report-subscriptions":          {api.ReportSubscription{}, http.StatusCreated, ""},
+	"DELETE /api/admin/report-subscriptions/{id}":   {nil, http.StatusNoContent, ""},
+	"GET /api/admin/report-subscriptions/{id}/runs": {api.ReportRunsResponse{}, http.StatusOK, ""},
+	"POST /api/admin/report-subscriptions/{id}/run": {api.ReportRun{}, http.StatusOK, ""},
+	"GET /api/admin/webhooks":                       {api.WebhooksResponse{}, http.StatusOK, ""},
+	"POST /api/admin/webhooks":                      {api.CreatedWebhook{}, http.StatusCreated, ""},
+	"DELETE /api/admin/webhooks/{id}":               {nil, http.StatusNoContent, ""},
+	"GET /api/admin/webhooks/{id}/deliveries":       {api.WebhookDeliveriesResponse{}, http.StatusOK, ""},
+	"POST /api/admin/webhooks/{id}/test":            {api.WebhookDelivery{}, http.StatusOK, ""},
+	"GET /api/admin/slow-queries":                   {api.SlowQueriesResponse{}, http.StatusOK, ""},
+	"GET /api/admin/slow-queries/{id}/plan":         {nil, http.StatusOK, "application/xml"},
+	"GET /api/admin/sales-goals":                    {api.SalesGoalsResponse{}, http.StatusOK, ""},
+	"PUT /api/admin/sales-goals":                    {nil, http.StatusNoContent, ""},
+	"GET /api/admin/write-off-item-codes":           {api.WriteOffItemCodesResponse{}, http.StatusOK, ""},
+	"POST /api/admin/write-off-item-codes":          {api.WriteOffItemCode{}, http.StatusCreated, ""},
+	"DELETE /api/admin/write-off-item-codes/{id}":   {nil, http.StatusNoContent, ""},
+}
+
+func TestOpenAPIResponses(t *testing.T) {
+	spec := api.OpenAPI()
+	paths := spec["paths"].(map[string]any)
+
+	if len(handlerResponses) != len(api.Endpoints) {
+		t.Errorf("handlerResponses has %d routes, api.Endpoints has %d", len(handlerResponses), len(api.Endpoints))
+	}
+	for _, ep := range api.Endpoints {
+		route := ep.Method + " " + ep.Path
+		t.Run(route, func(t *testing.T) {
+			want, ok := handlerResponses[route]
+			if !ok {
+				t.Fatal("route missing from handlerResponses")
+			}
+			status := ep.Status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if reflect.TypeOf(ep.Response) != reflect.TypeOf(want.body) || status != want.status || ep.ContentType != want.contentType {
+				t.Fatalf("endpoint documents %d %T %q, handler writes %d %T %q",
+					status, ep.Response, ep.ContentType, want.status, want.body, want.contentType)
+			}
+
+			op := paths[ep.Path].(map[string]any)[strings.ToLower(ep.Method)].(map[string]any)
+			success, ok := op["responses"].(map[string]any)[strconv.Itoa(want.status)].(map[string]any)
+			if !ok {
+				t.Fatalf("spec has no %d response", want.status)
+			}
+			content, hasContent := success["content"].(map[string]any)
+			if want.body == nil && want.contentType == "" {
+				if hasContent {
+					t.Errorf("spec documents a body for a response without one")
+				}
+				return
+			}
+			contentType := want.contentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			media, ok := content[contentType].(map[string]any)
+			if !ok {
+				t.Fatalf("spec has no %s content", contentType)
+			}
+			if typ := reflect.TypeOf(want.body); typ != nil && typ.Kind() == reflect.Struct {
+				if ref := media["schema"].(map[string]any)["$ref"]; ref != "#/components/schemas/"+typ.Name() {
+					t.Errorf("spec schema is %v, want %s", ref, typ.Name())
+				}
+			}
+		})
+	}
+}
+
+// TestOpenAPIResponseBodies calls the handlers that work without a database
+// and validates what they write against the spec's schemas.
+func TestOpenAPIResponseBodies(t *testing.T) {
+	spec := api.OpenAPI()
+	schemas := spec["components"].(map[string]any)["schemas"].(map[string]any)
+	paths := spec["paths"].(map[string]any)
+	s := newSpecTestServer()
+
+	tests := []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodGet, "/health", "", http.StatusServiceUnavailable}, // no database configured
+		{http.MethodGet, "/api/openapi.json", "", http.StatusOK},
+		{http.MethodDelete, "/api/admin/cache", "", http.StatusOK},
+		{http.MethodGet, "/api/admin/log-level", "", http.StatusOK},
+		{http.MethodPut, "/api/admin/log-level", `{"level":"debug"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer admin-secret")
+			rec := httptest.NewRecorder()
+			s.router.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("got %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+
+			// Health reports an unhealthy database with its success schema
+			status := handlerResponses[tt.method+" "+tt.path].status
+			op := paths[tt.path].(map[string]any)[strings.ToLower(tt.method)].(map[string]any)
+			content := op["responses"].(map[string]any)[strconv.Itoa(status)].(map[string]any)["content"].(map[string]any)
+			schema := content["application/json"].(map[string]any)["schema"].(map[string]any)
+
+			var body any
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("response isn't JSON: %v", err)
+			}
+			checkSchema(t, schemas, schema, body, "body")
+		})
+	}
+}
+
+// checkSchema reports where value doesn't match the JSON schema.
+func checkSchema(t *testing.T, schemas map[string]any, schema map[string]any, value any, path string) {
+	t.Helper()
+	if ref, ok := schema["$ref"].(string); ok {
+		schema = schemas[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]any)
+	}
+	if value == nil {
+		if schema["nullable"] != true && len(schema) > 0 {
+			t.Errorf("%s is null but not nullable", path)
+		}
+		return
+	}
+	if allOf, ok := schema["allOf"].([]any); ok {
+		for _, s := range allOf {
+			checkSchema(t, schemas, s.(map[string]any), value, path)
+		}
+		return
+	}
+
+	switch schema["type"] {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			t.Errorf("%s is %T, want an object", path, value)
+			return
+		}
+		props, _ := schema["properties"].(map[string]any)
+		required, _ := schema["required"].([]string)
+		for _, name := range required {
+			if _, ok := obj[name]; !ok {
+				t.Errorf("%s has no required %s", path, name)
+			}
+		}
+		for name, v := range obj {
+			switch {
+			case props[name] != nil:
+				checkSchema(t, schemas, props[name].(map[string]any), v, path+"."+name)
+			case schema["additionalProperties"] != nil:
+				checkSchema(t, schemas, schema["additionalProperties"].(map[string]any), v, path+"."+name)
+			case props != nil:
+				t.Errorf("%s has undocumented %s", path, name)
+			}
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			t.Errorf("%s is %T, want an array", path, value)
+			return
+		}
+		for i, v := range items {
+			checkSchema(t, schemas, schema["items"].(map[string]any), v, path+"["+strconv.Itoa(i)+"]")
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			t.Errorf("%s is %T, want a string", path, value)
+			return
+		}
+		if enum, ok := schema["enum"].([]string); ok && !slices.Contains(enum, s) {
+			t.Errorf("%s is %q, want one of %v", path, s, enum)
+		}
+	case "integer", "number":
+		if _, ok := value.(float64); !ok {
+			t.Errorf("%s is %T, want a number", path, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			t.Errorf("%s is %T, want a boolean", path, value)
+		}
+	}
+}
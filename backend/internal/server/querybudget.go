@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/ratelimit"
+)
+
+// defaultQueryTimeout is the budget for routes without a configured one.
+const defaultQueryTimeout = 10 * time.Second
+
+// slowQueryFraction is the share of its budget a query may use before it is
+// logged as slow.
+const slowQueryFraction = 0.8
+
+// statusClientClosedRequest is recorded in the request log when the client
+// disconnected before a response could be sent (nginx's convention).
+const statusClientClosedRequest = 499
+
+// queryTimeout returns the time budget for route's Aptora queries.
+func (s *Server) queryTimeout(route string) time.Duration {
+	if timeout := s.cfg.QueryTimeouts[route]; timeout > 0 {
+		return timeout
+	}
+	return defaultQueryTimeout
+}
+
+// withQueryBudget runs fn with ctx limited to route's query budget. If fn
+// fails because the budget ran out or the caller went away, the returned
+// error wraps the context's error even when the driver doesn't, so
+// writeQueryError can tell the outcomes apart. Queries that use most of the
+// budget are logged as slow, along with params.
+func (s *Server) withQueryBudget(ctx context.Context, route string, params []slog.Attr, fn func(ctx context.Context) error) error {
+	budget := s.queryTimeout(route)
+	ctx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+
+	start := time.Now()
+	err := fn(ctx)
+	elapsed := time.Since(start)
+
+	if err != nil && ctx.Err() != nil && !errors.Is(err, ctx.Err()) {
+		err = fmt.Errorf("%w: %w", ctx.Err(), err)
+	}
+
+	if elapsed >= time.Duration(float64(budget)*slowQueryFraction) {
+		attrs := append([]slog.Attr{
+			slog.String("route", route),
+			slog.Duration("duration", elapsed),
+			slog.Duration("budget", budget),
+			slog.Bool("timed_out", errors.Is(err, context.DeadlineExceeded)),
+		}, params...)
+		s.log(ctx).LogAttrs(ctx, slog.LevelWarn, "slow Aptora query", attrs...)
+	}
+
+	return err
+}
+
+// writeQueryError responds to a failed Aptora query:
+//   - a client that went away gets no response, only a log line
+//   - a request shed for lack of a query slot gets 503 overloaded
+//   - a query that ran out of its budget gets 504 query_timeout
+//   - anything else is logged and gets a 500 with msg
+func (s *Server) writeQueryError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	switch {
+	case r.Context().Err() != nil:
+		s.log(r.Context()).Info("client disconnected before the query finished", slog.Any("error", err))
+		w.WriteHeader(statusClientClosedRequest)
+	case errors.Is(err, ratelimit.ErrOverloaded):
+		s.writeAptoraOverloaded(w, r)
+	case errors.Is(err, context.DeadlineExceeded):
+		s.log(r.Context()).Warn("query exceeded its time budget", slog.Any("error", err))
+		s.writeError(w, r, http.StatusGatewayTimeout, api.CodeQueryTimeout,
+			"the query took too long, please use a narrower filter or try again later")
+	default:
+		s.log(r.Context()).Error(msg, slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, msg)
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+)
+
+// rateLimit limits each client to the configured rate for the named route.
+// Routes registered under the same name share one budget. Routes without a
+// configured rate are not limited.
+func (s *Server) rateLimit(route string) func(http.Handler) http.Handler {
+	limiter := s.limiters[route]
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := clientKey(r)
+			if ok, wait := limiter.Allow(key); !ok {
+				s.log(r.Context()).Warn("rate limit exceeded", slog.String("route", route), slog.String("client", key))
+				s.writeRetryAfter(w, r, http.StatusTooManyRequests, api.CodeRateLimited, wait, "rate limit exceeded, please slow down")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientKey identifies the client for rate limiting: the API key if one was
+// used, otherwise the remote IP address.
+func clientKey(r *http.Request) string {
+	if p := principalFrom(r.Context()); p != nil {
+		if p.apiKey != nil {
+			return "api_key:" + strconv.Itoa(p.apiKey.ID)
+		}
+		if p.admin {
+			return "admin"
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// writeAptoraOverloaded responds when no Aptora query slot became available.
+func (s *Server) writeAptoraOverloaded(w http.ResponseWriter, r *http.Request) {
+	s.log(r.Context()).Warn("shedding request: too many concurrent Aptora queries")
+	s.writeRetryAfter(w, r, http.StatusServiceUnavailable, api.CodeOverloaded, s.aptoraSlots.RetryAfter(), "server is busy, please try again shortly")
+}
+
+func (s *Server) writeRetryAfter(w http.ResponseWriter, r *http.Request, status int, code api.ErrorCode, wait time.Duration, msg string) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	s.writeError(w, r, status, code, msg)
+}
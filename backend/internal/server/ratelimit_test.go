@@ -0,0 +1,38 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/database"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/ratelimit"
+)
+
+func TestRateLimitSharedByRouteName(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := Config{
+		AdminToken: "admin-secret",
+		RateLimits: map[string]ratelimit.Rate{"invoices": {PerMinute: 1, Burst: 1}},
+	}
+	s := NewServer(logger, cfg, database.NewManager(logger, database.Config{}))
+
+	get := func(path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Both routes are limited as "invoices", so the first request uses up
+	// the budget of the second
+	if code := get("/api/invoices"); code == http.StatusTooManyRequests {
+		t.Fatalf("first request got %d", code)
+	}
+	if code := get("/api/invoices/compare"); code != http.StatusTooManyRequests {
+		t.Errorf("second route got %d, want 429 from the shared budget", code)
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/database"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/report"
+)
+
+// maxReportRows is the largest number of invoices a report will render. It is
+// higher than maxInvoiceRows because reports aren't rendered in the browser.
+const maxReportRows = 5000
+
+// handleSalesReportPDF renders the invoices matching the same filters as
+// handleInvoices as a PDF grouped by sales rep.
+func (s *Server) handleSalesReportPDF(w http.ResponseWriter, r *http.Request) {
+	db := s.db.AptoraDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	filter, err := parseInvoiceFilter(r.URL.Query())
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, err.Error())
+		return
+	}
+
+	result, err := s.loadReportInvoices(r.Context(), filter)
+	if err != nil {
+		s.writeQueryError(w, r, err, "failed to query invoices")
+		return
+	}
+
+	if result.Count > maxReportRows {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeTooManyRows,
+			fmt.Sprintf("report would include more than %d invoices, please use a narrower filter", maxReportRows))
+		return
+	}
+
+	// Render into a buffer so a failure can still produce an error response
+	var buf bytes.Buffer
+	err = report.WriteSalesPDF(&buf, result.Invoices, report.SalesFilter{
+		StartDate: filter.StartDate,
+		EndDate:   filter.EndDate,
+		Employee:  filter.Employee,
+	}, time.Now())
+	if err != nil {
+		s.log(r.Context()).Error("failed to render sales report", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to render report")
+		return
+	}
+
+	filename := fmt.Sprintf("sales-report-%s-to-%s.pdf", filter.StartDate.Format("2006-01-02"), filter.EndDate.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="`+filename+`"`)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := buf.WriteTo(w); err != nil {
+		s.log(r.Context()).Warn("failed to write sales report", slog.Any("error", err))
+	}
+}
+
+// loadReportInvoices queries invoices for a report. Reports bypass the query
+// cache since they use a different row limit and are requested rarely.
+func (s *Server) loadReportInvoices(ctx context.Context, filter invoiceFilter) (invoiceResult, error) {
+	var result invoiceResult
+	err := s.withQueryBudget(ctx, "reports", filter.logAttrs(), func(ctx context.Context) error {
+		return s.withAptoraConn(ctx, func(conn database.Querier) error {
+			var err error
+			result, err = s.queryInvoices(ctx, conn, filter, maxReportRows)
+			return err
+		})
+	})
+	return result, err
+}
+
+// LoadInvoices loads the invoices from start to end, inclusive, for
+// scheduled reports and command-line exports, which can't ask the user for a
+// narrower filter. It fails rather than truncating the result.
+func (s *Server) LoadInvoices(ctx context.Context, start, end time.Time, employee string) ([]api.Invoice, error) {
+	result, err := s.loadReportInvoices(ctx, invoiceFilter{StartDate: start, EndDate: end, Employee: employee})
+	if err != nil {
+		return nil, err
+	}
+	if result.Count > maxReportRows {
+		return nil, fmt.Errorf("report would include %d invoices, more than the limit of %d", result.Count, maxReportRows)
+	}
+	return result.Invoices, nil
+}
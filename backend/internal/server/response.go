@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/requestid"
+)
+
+// writeJSON encodes v as the response body with the given status.
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Error("failed to encode response", slog.Any("error", err))
+	}
+}
+
+// writeError sends an API error. Clients that accept application/problem+json
+// get RFC 7807 problem details; everyone else gets an api.ErrorResponse.
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request, status int, code api.ErrorCode, msg string) {
+	requestID := requestid.From(r.Context())
+
+	if !strings.Contains(r.Header.Get("Accept"), "application/problem+json") {
+		s.writeJSON(w, status, api.ErrorResponse{Error: msg, Code: code, RequestID: requestID})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	resp := api.ProblemResponse{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    msg,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: requestID,
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		s.logger.Error("failed to encode error response", slog.Any("error", err))
+	}
+}
+
+// writeDBUnavailable responds when a database connection isn't established.
+func (s *Server) writeDBUnavailable(w http.ResponseWriter, r *http.Request) {
+	s.writeError(w, r, http.StatusServiceUnavailable, api.CodeDBUnavailable, "database not available")
+}
+
+type poolReleaseKey struct{}
+
+// holdPools holds the database pools for the duration of the request, so a
+// reload doesn't close them under it.
+func (s *Server) holdPools(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release := s.db.Hold()
+		defer release()
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), poolReleaseKey{}, release)))
+	})
+}
+
+// releasePools releases the pools held by holdPools early, for long-lived
+// requests that are done with the database.
+func releasePools(ctx context.Context) {
+	if release, ok := ctx.Value(poolReleaseKey{}).(func()); ok {
+		release()
+	}
+}
+
+// recoverer turns handler panics into JSON 500 responses instead of dropped
+// connections.
+func (s *Server) recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			s.log(r.Context()).Error("panic while handling request",
+				slog.Any("panic", rec),
+				slog.String("path", r.URL.Path),
+				slog.String("stack", string(debug.Stack())),
+			)
+			s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "internal server error")
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/database"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/events"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/reviews"
+)
+
+// errInvoiceNotFound is returned by queryInvoice for unknown invoice numbers.
+var errInvoiceNotFound = errors.New("invoice not found")
+
+func (s *Server) handleGetInvoiceReview(w http.ResponseWriter, r *http.Request) {
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	number, err := strconv.Atoi(chi.URLParam(r, "number"))
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, "invalid invoice number")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	review, err := reviews.Get(ctx, db, number)
+	if err != nil {
+		if errors.Is(err, reviews.ErrNotFound) {
+			s.writeError(w, r, http.StatusNotFound, api.CodeNotFound, "invoice has not been reviewed")
+			return
+		}
+		s.log(r.Context()).Error("failed to get invoice review", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to get invoice review")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, review)
+}
+
+// handleSetInvoiceReview stores an invoice's review status. A change of
+// status is published on the event bus, which fires invoice.disputed
+// webhooks when the new status is disputed.
+func (s *Server) handleSetInvoiceReview(w http.ResponseWriter, r *http.Request) {
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	number, err := strconv.Atoi(chi.URLParam(r, "number"))
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, "invalid invoice number")
+		return
+	}
+
+	var req api.SetInvoiceReviewRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err == nil {
+		err = reviews.ValidateReview(req)
+	}
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, "invalid review: "+err.Error())
+		return
+	}
+
+	// Only invoices that exist in Aptora can be reviewed, and the event
+	// carries the invoice for webhook receivers
+	var inv api.Invoice
+	err = s.withQueryBudget(r.Context(), "invoices", []slog.Attr{slog.Int("invoice_number", number)}, func(ctx context.Context) error {
+		return s.withAptoraConn(ctx, func(conn database.Querier) error {
+			var err error
+			inv, err = s.queryInvoice(ctx, conn, number)
+			return err
+		})
+	})
+	if errors.Is(err, errInvoiceNotFound) {
+		s.writeError(w, r, http.StatusNotFound, api.CodeNotFound, "invoice not found")
+		return
+	}
+	if err != nil {
+		s.writeQueryError(w, r, err, "failed to query invoice")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	review, previous, err := reviews.Set(ctx, db, number, req, principalFrom(r.Context()).name())
+	if err != nil {
+		s.log(r.Context()).Error("failed to set invoice review", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to set invoice review")
+		return
+	}
+
+	if previous == nil || *previous != review.Status {
+		s.events.Publish(events.ReviewChanged, events.ReviewChange{Invoice: inv, Review: review, Previous: previous})
+	}
+
+	s.log(r.Context()).Info("set invoice review", slog.Int("invoice_number", number), slog.String("status", string(review.Status)))
+	s.writeJSON(w, http.StatusOK, review)
+}
+
+// queryInvoice loads one invoice by number.
+func (s *Server) queryInvoice(ctx context.Context, db database.Querier, number int) (api.Invoice, error) {
+	args := []any{number}
+	rules, err := s.writeOffRules(ctx, &args)
+	if err != nil {
+		return api.Invoice{}, err
+	}
+
+	inv := api.Invoice{Number: number}
+	var date time.Time
+	var reason sql.NullString
+	err = db.QueryRowContext(ctx, `
+		SELECT i."Tran Date", i."Sales Rep", i."Tran Subtotal", `+rules.reasonSQL()+`
+		FROM aptCDV_VW_APT_InvSalCredEstList i
+		WHERE i."Tran No" = @p1 AND i."Tran Type" = 'Invoice'`, args...).Scan(&date, &inv.EmployeeName, &inv.Subtotal, &reason)
+	if errors.Is(err, sql.ErrNoRows) {
+		return api.Invoice{}, errInvoiceNotFound
+	}
+	if err != nil {
+		return api.Invoice{}, fmt.Errorf("failed to query invoice: %w", err)
+	}
+	inv.Date = date.Format("2006-01-02")
+	markWriteOff(&inv, reason)
+	return inv, nil
+}
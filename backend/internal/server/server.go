@@ -4,65 +4,183 @@ import (
 	"context"
 
 	"embed"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"io/fs"
 	"log/slog"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"path"
+	"strconv"
 
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/auth"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/cache"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/changes"
 	"github.com/kwila-cloud/aptora-extensions/backend/internal/database"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/events"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/lifecycle"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/ratelimit"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/requestid"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/scheduler"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/slowlog"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/webhooks"
 )
 
 //go:embed all:built-frontend
 var staticFiles embed.FS
 
+// Config contains the HTTP server settings.
+type Config struct {
+	DevMode    bool
+	AdminToken string         // bearer token for /api/admin; empty disables the admin API
+	LogLevel   *slog.LevelVar // adjustable through /api/admin/log-level
+
+	QueryCacheTTL           time.Duration
+	QueryCacheHistoricalTTL time.Duration
+	QueryCacheMaxEntries    int
+
+	RateLimits map[string]ratelimit.Rate // per-client rate limit by route name
+
+	QueryTimeouts map[string]time.Duration // time budget for Aptora queries by route name
+
+	AptoraSources AptoraSources // Aptora views and columns beyond the invoice view
+
+	AptoraMaxConcurrentQueries int
+	AptoraQueryQueueSize       int
+	AptoraQueryQueueTimeout    time.Duration
+
+	SlowQueryThreshold   time.Duration // Aptora queries this slow are recorded; 0 disables
+	SlowQueryCapturePlan bool          // store each slow query's cached plan
+
+	SMTP scheduler.SMTPConfig // outgoing mail for scheduled reports; empty Host disables the scheduler
+
+	ChangeScanInterval   time.Duration // how often to scan Aptora for invoice changes; 0 disables
+	ChangeScanWindowDays int           // how many days of invoices each scan covers
+
+	MaxEventStreams int // cap on concurrent /api/events streams
+
+	ShutdownTimeout time.Duration // overall deadline for a graceful shutdown
+}
+
 type Server struct {
 	logger     *slog.Logger
 	router     chi.Router
 	httpServer *http.Server
 	devMode    bool
 	db         *database.Manager
+	cfg        Config
+
+	invoiceCache *cache.Cache[invoiceResult]
+	aptoraSlots  *ratelimit.ConcurrencyLimiter
+	limiters     map[string]*ratelimit.Limiter // per-client rate limits by route name
+	scheduler    *scheduler.Scheduler
+	webhooks     *webhooks.Dispatcher
+	events       *events.Bus
+	streamEpoch  string        // prefix of event stream IDs, unique to this process
+	closing      chan struct{} // closed when shutdown starts, ending event streams
+	streams      atomic.Int64  // open event streams
+	changes      *changes.Detector
+	slowQueries  *slowlog.Recorder
 }
 
-func NewServer(logger *slog.Logger, devMode bool, db *database.Manager) *Server {
+func NewServer(logger *slog.Logger, cfg Config, db *database.Manager) *Server {
 	s := &Server{
-		logger:  logger,
-		router:  chi.NewRouter(),
-		devMode: devMode,
-		db:      db,
+		logger:       logger,
+		router:       chi.NewRouter(),
+		devMode:      cfg.DevMode,
+		db:           db,
+		cfg:          cfg,
+		invoiceCache: cache.New[invoiceResult](cfg.QueryCacheMaxEntries),
+		aptoraSlots:  ratelimit.NewConcurrencyLimiter(cfg.AptoraMaxConcurrentQueries, cfg.AptoraQueryQueueSize, cfg.AptoraQueryQueueTimeout),
+		limiters:     make(map[string]*ratelimit.Limiter, len(cfg.RateLimits)),
 	}
+	for route, rate := range cfg.RateLimits {
+		s.limiters[route] = ratelimit.NewLimiter(rate)
+	}
+	s.scheduler = scheduler.New(logger, db, s.LoadInvoices, scheduler.NewMailer(cfg.SMTP))
+	s.webhooks = webhooks.NewDispatcher(logger, db)
+	s.events = events.NewBus(logger, eventHistory)
+	s.streamEpoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+	s.closing = make(chan struct{})
+	s.changes = changes.New(logger, db, s.events, s.invoicesSince, cfg.ChangeScanInterval, cfg.ChangeScanWindowDays)
+	s.slowQueries = slowlog.New(logger, db, cfg.SlowQueryThreshold, cfg.SlowQueryCapturePlan)
 	s.registerRoutes()
 	return s
 }
 
-// requestLogger logs each HTTP request with structured logging
+// requestInfo collects details about a request from inner handlers so that
+// requestLogger can include them in the request log.
+type requestInfo struct {
+	apiKey *auth.APIKey
+}
+
+type requestInfoKey struct{}
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+type loggerKey struct{}
+
+// log returns the request-scoped logger, which tags every line with the
+// request ID. Outside of a request it returns the server logger.
+func (s *Server) log(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return s.logger
+}
+
+// requestLogger assigns each request an ID, accepting a valid X-Request-ID from
+// the client, and logs each HTTP request with structured logging
 func (s *Server) requestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
+		id := r.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+		w.Header().Set(requestid.Header, id)
+		logger := s.logger.With(slog.String("request_id", id))
+
 		// Wrap the ResponseWriter to capture status code
 		ww := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 
+		info := &requestInfo{}
+		ctx := requestid.With(r.Context(), id)
+		ctx = context.WithValue(ctx, loggerKey{}, logger)
+		ctx = context.WithValue(ctx, requestInfoKey{}, info)
+		r = r.WithContext(ctx)
+
 		// Process request
 		next.ServeHTTP(ww, r)
 
 		// Log request details
 		duration := time.Since(start)
-		s.logger.Info("http request",
+		attrs := []any{
 			slog.String("method", r.Method),
 			slog.String("path", r.URL.Path),
 			slog.String("remote_addr", r.RemoteAddr),
 			slog.Int("status", ww.statusCode),
 			slog.Int("bytes", ww.bytesWritten),
 			slog.Duration("duration", duration),
-		)
+		}
+		if info.apiKey != nil {
+			attrs = append(attrs,
+				slog.Int("api_key_id", info.apiKey.ID),
+				slog.String("api_key_name", info.apiKey.Name),
+			)
+		}
+		logger.Info("http request", attrs...)
 	})
 }
 
@@ -84,15 +202,58 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// Unwrap allows http.ResponseController to reach the underlying writer.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func (s *Server) registerRoutes() {
 	// Add request logging middleware
 	s.router.Use(s.requestLogger)
+	s.router.Use(s.compress)
 
 	// API routes
 	s.router.Get("/health", s.handleHealth)
 	s.router.Route("/api", func(r chi.Router) {
-		r.Get("/employees", s.handleEmployees)
-		r.Get("/invoices", s.handleInvoices)
+		r.Use(s.recoverer)
+		r.Use(s.holdPools)
+		r.Use(s.authenticate)
+		r.Get("/openapi.json", s.handleOpenAPI)
+		r.With(s.requireScope(auth.ScopeEmployees), s.rateLimit("employees")).Get("/employees", s.handleEmployees)
+		r.With(s.requireScope(auth.ScopeInvoices), s.rateLimit("invoices")).Get("/invoices", s.handleInvoices)
+		r.With(s.requireScope(auth.ScopeInvoices), s.rateLimit("invoices")).Get("/invoices/compare", s.handleCompareInvoices)
+		r.With(s.requireScope(auth.ScopeInvoices), s.rateLimit("invoices")).Get("/invoices/{number}/review", s.handleGetInvoiceReview)
+		r.With(s.requirePrincipal, s.requireScope(auth.ScopeReviews), s.rateLimit("invoices")).Put("/invoices/{number}/review", s.handleSetInvoiceReview)
+		r.With(s.requireScope(auth.ScopeInvoices), s.rateLimit("leaderboard")).Get("/leaderboard", s.handleLeaderboard)
+		r.With(s.requireScope(auth.ScopeInvoices), s.rateLimit("reports")).Get("/reports/sales.pdf", s.handleSalesReportPDF)
+		r.With(s.requireScope(auth.ScopeInvoices), s.rateLimit("reports")).Get("/write-offs", s.handleWriteOffs)
+		r.With(s.requirePrincipal, s.requireScope(auth.ScopeInvoices)).Get("/events", s.handleEvents)
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(s.requireAdmin)
+			r.Delete("/cache", s.handlePurgeCache)
+			r.Get("/log-level", s.handleGetLogLevel)
+			r.Put("/log-level", s.handleSetLogLevel)
+			r.Get("/api-keys", s.handleListAPIKeys)
+			r.Post("/api-keys", s.handleCreateAPIKey)
+			r.Delete("/api-keys/{id}", s.handleRevokeAPIKey)
+			r.Get("/report-subscriptions", s.handleListSubscriptions)
+			r.Post("/report-subscriptions", s.handleCreateSubscription)
+			r.Delete("/report-subscriptions/{id}", s.handleDeleteSubscription)
+			r.Get("/report-subscriptions/{id}/runs", s.handleListSubscriptionRuns)
+			r.Post("/report-subscriptions/{id}/run", s.handleRunSubscription)
+			r.Get("/webhooks", s.handleListWebhooks)
+			r.Post("/webhooks", s.handleCreateWebhook)
+			r.Delete("/webhooks/{id}", s.handleDeleteWebhook)
+			r.Get("/webhooks/{id}/deliveries", s.handleListWebhookDeliveries)
+			r.Post("/webhooks/{id}/test", s.handleTestWebhook)
+			r.Get("/slow-queries", s.handleListSlowQueries)
+			r.Get("/slow-queries/{id}/plan", s.handleGetSlowQueryPlan)
+			r.Get("/sales-goals", s.handleListSalesGoals)
+			r.Put("/sales-goals", s.handleSetSalesGoal)
+			r.Get("/write-off-item-codes", s.handleListWriteOffItemCodes)
+			r.Post("/write-off-item-codes", s.handleCreateWriteOffItemCode)
+			r.Delete("/write-off-item-codes/{id}", s.handleDeleteWriteOffItemCode)
+		})
 		// Catch-all for unmatched API routes - return 404
 		r.NotFound(s.handleAPINotFound)
 	})
@@ -106,35 +267,23 @@ func (s *Server) registerRoutes() {
 }
 
 func (s *Server) handleAPINotFound(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNotFound)
-	resp := map[string]string{"error": "API endpoint not found"}
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		s.logger.Error("failed to encode error response", slog.Any("error", err))
-	}
+	s.writeError(w, r, http.StatusNotFound, api.CodeNotFound, "API endpoint not found")
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
 	healthy, errMsg := s.db.IsHealthy()
 	if !healthy {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		resp := map[string]string{
-			"status": "unhealthy",
-			"error":  errMsg,
-		}
-		if err := json.NewEncoder(w).Encode(resp); err != nil {
-			s.logger.Error("failed to encode health response", slog.Any("error", err))
+		resp := api.HealthResponse{
+			Status: "unhealthy",
+			Error:  errMsg,
+			Code:   api.CodeDBUnavailable,
 		}
+		s.writeJSON(w, http.StatusServiceUnavailable, resp)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	resp := map[string]string{"status": "healthy"}
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		s.logger.Error("failed to encode health response", slog.Any("error", err))
-	}
+	resp := api.HealthResponse{Status: "healthy"}
+	s.writeJSON(w, http.StatusOK, resp)
 }
 
 func (s *Server) serveAssets(w http.ResponseWriter, r *http.Request) {
@@ -160,6 +309,10 @@ func (s *Server) serveAssets(w http.ResponseWriter, r *http.Request) {
 
 		// If it's a file (not a directory), serve it
 		if err == nil && !stat.IsDir() {
+			w.Header().Set("Cache-Control", assetCacheControl(requestPath))
+			if servePrecompressed(w, r, sub, requestPath) {
+				return
+			}
 			fileServer := http.FileServer(http.FS(sub))
 			fileServer.ServeHTTP(w, r)
 			return
@@ -174,6 +327,8 @@ func (s *Server) serveAssets(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// index.html references the hashed assets, so it must always be revalidated
+	w.Header().Set("Cache-Control", "no-cache")
 	if _, err := w.Write(data); err != nil {
 		s.logger.Error("failed to write index.html response", slog.Any("error", err))
 	}
@@ -188,9 +343,12 @@ func (s *Server) proxyToVite(w http.ResponseWriter, r *http.Request) {
 	proxy.ServeHTTP(w, r)
 }
 
-// Run starts the HTTP server and blocks until the provided context is cancelled
-// or the server exits with an error. Graceful shutdown is handled when
-// the context is cancelled.
+// Run connects to the databases, starts the background workers and the HTTP
+// server, and blocks until the provided context is cancelled or the server
+// exits with an error. Either way everything is then shut down in order:
+// the HTTP server stops accepting requests and drains, the workers are
+// cancelled and waited for, and the database pools are closed, all within
+// ShutdownTimeout.
 func (s *Server) Run(ctx context.Context, addr string) error {
 	if s.httpServer != nil {
 		return errors.New("server already running")
@@ -201,6 +359,24 @@ func (s *Server) Run(ctx context.Context, addr string) error {
 		Handler:           s.router,
 		ReadHeaderTimeout: 5 * time.Second,
 	}
+	// Shutdown waits for requests to finish, so end event streams first
+	s.httpServer.RegisterOnShutdown(func() { close(s.closing) })
+
+	if s.cfg.SlowQueryThreshold > 0 {
+		s.db.SetQueryObserver(s.observeQuery)
+	}
+	s.db.Start(ctx)
+
+	webhookEvents, unsubscribe := s.events.Subscribe("webhooks", 1000)
+	defer unsubscribe()
+
+	workers := lifecycle.NewGroup(ctx, s.logger)
+	workers.Go("scheduler", s.scheduler.Run)
+	workers.Go("webhooks", s.webhooks.Run)
+	workers.Go("webhook_events", func(ctx context.Context) { s.webhooks.Forward(ctx, webhookEvents) })
+	workers.Go("change_detector", s.changes.Run)
+	workers.Go("health_watcher", s.watchHealth)
+	workers.Go("slow_query_log", s.slowQueries.Run)
 
 	errCh := make(chan error, 1)
 	go func() {
@@ -212,15 +388,37 @@ func (s *Server) Run(ctx context.Context, addr string) error {
 		errCh <- nil
 	}()
 
+	var runErr error
 	select {
 	case <-ctx.Done():
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		if err := s.httpServer.Shutdown(shutdownCtx); err != nil {
-			return err
-		}
-		return nil
-	case err := <-errCh:
-		return err
+	case runErr = <-errCh:
+	}
+
+	return errors.Join(runErr, s.shutdown(workers))
+}
+
+// shutdown stops the HTTP server, the workers and the database manager, in
+// that order, within ShutdownTimeout.
+func (s *Server) shutdown(workers *lifecycle.Group) error {
+	timeout := s.cfg.ShutdownTimeout
+	s.logger.Info("shutting down", slog.Duration("timeout", timeout))
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to stop http server: %w", err))
+	}
+	if err := workers.Stop(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := s.db.Stop(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) == 0 {
+		s.logger.Info("shutdown complete")
 	}
+	return errors.Join(errs...)
 }
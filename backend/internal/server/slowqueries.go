@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/database"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/requestid"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/slowlog"
+)
+
+// observeQuery is the Aptora query observer. It queues queries over the slow
+// query threshold for the slow query log, attributed to the request that
+// ran them.
+func (s *Server) observeQuery(ctx context.Context, stats database.QueryStats) {
+	if !s.slowQueries.IsSlow(stats.Duration) {
+		return
+	}
+
+	entry := slowlog.Entry{
+		Query:     stats.Query,
+		Args:      stats.Args,
+		Duration:  stats.Duration,
+		Rows:      stats.Rows,
+		Err:       stats.Err,
+		RequestID: requestid.From(ctx),
+		At:        time.Now(),
+	}
+	if rctx := chi.RouteContext(ctx); rctx != nil {
+		entry.Endpoint = rctx.RoutePattern()
+	}
+	entry.User = principalFrom(ctx).name()
+	s.slowQueries.Record(entry)
+}
+
+// queryParam parses an optional integer query parameter within [min, max].
+func queryParam(r *http.Request, name string, def, min, max int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("%s must be a whole number from %d to %d", name, min, max)
+	}
+	return n, nil
+}
+
+func (s *Server) handleListSlowQueries(w http.ResponseWriter, r *http.Request) {
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	days, err := queryParam(r, "days", 7, 1, 30)
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, err.Error())
+		return
+	}
+	limit, err := queryParam(r, "limit", 20, 1, 100)
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	queries, err := slowlog.Worst(ctx, db, time.Now().AddDate(0, 0, -days), limit)
+	if err != nil {
+		s.log(r.Context()).Error("failed to list slow queries", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to list slow queries")
+		return
+	}
+
+	resp := api.SlowQueriesResponse{Queries: queries}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// handleGetSlowQueryPlan returns a run's captured plan as a .sqlplan file,
+// which SQL Server Management Studio opens as a graphical plan.
+func (s *Server) handleGetSlowQueryPlan(w http.ResponseWriter, r *http.Request) {
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, "invalid slow query id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	plan, err := slowlog.Plan(ctx, db, id)
+	if err != nil {
+		if errors.Is(err, slowlog.ErrNotFound) || errors.Is(err, slowlog.ErrNoPlan) {
+			s.writeError(w, r, http.StatusNotFound, api.CodeNotFound, err.Error())
+			return
+		}
+		s.log(r.Context()).Error("failed to get slow query plan", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to get slow query plan")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="slow-query-%d.sqlplan"`, id))
+	if _, err := w.Write([]byte(plan)); err != nil {
+		s.log(r.Context()).Debug("failed to write slow query plan", slog.Any("error", err))
+	}
+}
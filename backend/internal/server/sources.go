@@ -0,0 +1,37 @@
+package server
+
+import "strings"
+
+// AptoraSources names the Aptora views and columns read beyond the invoice
+// view. Aptora's schema is undocumented and differs between versions, so
+// they are configured rather than assumed, and the features that need an
+// unset source are disabled.
+type AptoraSources struct {
+	// InvoiceLinesView has one row per invoice line, with the invoice's
+	// "Tran No" in LineInvoiceColumn, the item code in LineItemColumn and
+	// the line's price in LinePriceColumn
+	InvoiceLinesView  string
+	LineInvoiceColumn string
+	LineItemColumn    string
+	LinePriceColumn   string
+
+	// Credit memos are rows of the invoice view with the "Tran Type"
+	// CreditMemoType, holding the "Tran No" of the invoice they credit in
+	// CreditMemoInvoiceColumn
+	CreditMemoType          string
+	CreditMemoInvoiceColumn string
+
+	// InvoiceCostColumn is the column of the invoice view holding the
+	// invoice's total cost, for gross profit and margin
+	InvoiceCostColumn string
+}
+
+// quoteName quotes a configured name, which may be qualified with a schema,
+// for use in SQL.
+func quoteName(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = `"` + strings.ReplaceAll(p, `"`, `""`) + `"`
+	}
+	return strings.Join(parts, ".")
+}
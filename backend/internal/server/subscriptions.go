@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/scheduler"
+)
+
+// maxRunHistory is how many recent runs the run history endpoint returns.
+const maxRunHistory = 50
+
+func (s *Server) handleListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	subs, err := scheduler.ListSubscriptions(ctx, db)
+	if err != nil {
+		s.log(r.Context()).Error("failed to list report subscriptions", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to list report subscriptions")
+		return
+	}
+
+	resp := api.ReportSubscriptionsResponse{Subscriptions: subs}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleCreateSubscription(w http.ResponseWriter, r *http.Request) {
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	var req api.CreateReportSubscriptionRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err == nil {
+		req.Name = strings.TrimSpace(req.Name)
+		req.Employee = strings.TrimSpace(req.Employee)
+		req.Schedule = strings.TrimSpace(req.Schedule)
+		for i, rcpt := range req.Recipients {
+			req.Recipients[i] = strings.TrimSpace(rcpt)
+		}
+		err = scheduler.ValidateSubscription(req)
+	}
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, "invalid report subscription: "+err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	sub, err := scheduler.CreateSubscription(ctx, db, req)
+	if err != nil {
+		s.log(r.Context()).Error("failed to create report subscription", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to create report subscription")
+		return
+	}
+
+	s.log(r.Context()).Info("created report subscription",
+		slog.Int("subscription_id", sub.ID),
+		slog.String("subscription", sub.Name),
+		slog.String("schedule", sub.Schedule),
+	)
+	s.writeJSON(w, http.StatusCreated, sub)
+}
+
+func (s *Server) handleDeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, "invalid report subscription id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := scheduler.DeleteSubscription(ctx, db, id); err != nil {
+		if errors.Is(err, scheduler.ErrNotFound) {
+			s.writeError(w, r, http.StatusNotFound, api.CodeNotFound, "report subscription not found")
+			return
+		}
+		s.log(r.Context()).Error("failed to delete report subscription", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to delete report subscription")
+		return
+	}
+
+	s.log(r.Context()).Info("deleted report subscription", slog.Int("subscription_id", id))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListSubscriptionRuns(w http.ResponseWriter, r *http.Request) {
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, "invalid report subscription id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if _, err := scheduler.GetSubscription(ctx, db, id); err != nil {
+		if errors.Is(err, scheduler.ErrNotFound) {
+			s.writeError(w, r, http.StatusNotFound, api.CodeNotFound, "report subscription not found")
+			return
+		}
+		s.log(r.Context()).Error("failed to look up report subscription", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to list report runs")
+		return
+	}
+
+	runs, err := scheduler.ListRuns(ctx, db, id, maxRunHistory)
+	if err != nil {
+		s.log(r.Context()).Error("failed to list report runs", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to list report runs")
+		return
+	}
+
+	resp := api.ReportRunsResponse{Runs: runs}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// handleRunSubscription sends a subscription's report immediately and returns
+// the recorded run, which is useful for checking the SMTP settings.
+func (s *Server) handleRunSubscription(w http.ResponseWriter, r *http.Request) {
+	if s.db.ExtensionsDB() == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+	if !s.scheduler.Enabled() {
+		s.writeError(w, r, http.StatusConflict, api.CodeNotConfigured, "SMTP is not configured; set SMTP_HOST to send reports")
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, "invalid report subscription id")
+		return
+	}
+
+	run, err := s.scheduler.RunNow(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, scheduler.ErrNotFound) {
+			s.writeError(w, r, http.StatusNotFound, api.CodeNotFound, "report subscription not found")
+			return
+		}
+		s.log(r.Context()).Error("failed to run report subscription", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to run report subscription")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, run)
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/database"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/webhooks"
+)
+
+// maxDeliveryHistory is how many recent deliveries the delivery log returns.
+const maxDeliveryHistory = 100
+
+func (s *Server) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	hooks, err := webhooks.ListWebhooks(ctx, db)
+	if err != nil {
+		s.log(r.Context()).Error("failed to list webhooks", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to list webhooks")
+		return
+	}
+
+	resp := api.WebhooksResponse{Webhooks: hooks}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	var req api.CreateWebhookRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err == nil {
+		req.Name = strings.TrimSpace(req.Name)
+		req.URL = strings.TrimSpace(req.URL)
+		err = webhooks.ValidateWebhook(req)
+	}
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, "invalid webhook: "+err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	hook, err := webhooks.CreateWebhook(ctx, db, req)
+	if err != nil {
+		s.log(r.Context()).Error("failed to create webhook", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to create webhook")
+		return
+	}
+
+	s.log(r.Context()).Info("created webhook", slog.Int("webhook_id", hook.ID), slog.String("webhook", hook.Name))
+
+	// The secret is only ever returned here
+	s.writeJSON(w, http.StatusCreated, hook)
+}
+
+func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, "invalid webhook id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := webhooks.DeleteWebhook(ctx, db, id); err != nil {
+		if errors.Is(err, webhooks.ErrNotFound) {
+			s.writeError(w, r, http.StatusNotFound, api.CodeNotFound, "webhook not found")
+			return
+		}
+		s.log(r.Context()).Error("failed to delete webhook", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to delete webhook")
+		return
+	}
+
+	s.log(r.Context()).Info("deleted webhook", slog.Int("webhook_id", id))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, "invalid webhook id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	deliveries, err := webhooks.ListDeliveries(ctx, db, id, maxDeliveryHistory)
+	if err != nil {
+		if errors.Is(err, webhooks.ErrNotFound) {
+			s.writeError(w, r, http.StatusNotFound, api.CodeNotFound, "webhook not found")
+			return
+		}
+		s.log(r.Context()).Error("failed to list webhook deliveries", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to list webhook deliveries")
+		return
+	}
+
+	resp := api.WebhookDeliveriesResponse{Deliveries: deliveries}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// handleTestWebhook sends a webhook.test event and returns the delivery, so
+// the receiver's URL and signature check can be verified.
+func (s *Server) handleTestWebhook(w http.ResponseWriter, r *http.Request) {
+	if s.db.ExtensionsDB() == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, "invalid webhook id")
+		return
+	}
+
+	delivery, err := s.webhooks.TestFire(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, webhooks.ErrNotFound) {
+			s.writeError(w, r, http.StatusNotFound, api.CodeNotFound, "webhook not found")
+			return
+		}
+		s.log(r.Context()).Error("failed to test webhook", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to test webhook")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, delivery)
+}
+
+// withAptoraConn runs fn on a tagged Aptora connection for background work,
+// holding one of the shared Aptora query slots.
+func (s *Server) withAptoraConn(ctx context.Context, fn func(conn database.Querier) error) error {
+	defer s.db.Hold()()
+	db := s.db.AptoraDB()
+	if db == nil {
+		return errors.New("aptora database not available")
+	}
+
+	release, err := s.aptoraSlots.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	conn, err := database.TaggedConn(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return fn(conn)
+}
@@ -0,0 +1,359 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/database"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/writeoffs"
+)
+
+// Aptora has no write-off flag, so write-offs are detected by rules over
+// Aptora data, in the order of api.WriteOffReasons:
+//   - zero_subtotal: invoiced at no charge (a missing subtotal counts as zero)
+//   - negative_subtotal: credited back more than it charged
+//   - credit_memo: credit memos linked to the invoice credit its full subtotal
+//   - write_off_item: a line has one of the item codes configured in the
+//     Extensions database
+//   - zero_price_line: a line is priced at zero
+//
+// The invoice view only has totals, so the credit memo and line rules read
+// the sources named in AptoraSources and are skipped while those are unset.
+// Queries get both the filter and the reason from one writeOffRules, so the
+// two always agree.
+
+// writeOffRule detects one write-off reason with a SQL predicate over the
+// invoice view aliased i. Predicates are never NULL, so they can be negated.
+type writeOffRule struct {
+	reason    api.WriteOffReason
+	predicate string
+}
+
+// writeOffRules are the rules in effect for one query.
+type writeOffRules []writeOffRule
+
+// writeOffRules returns the rules in effect, appending the parameters they
+// use to args. The write-off item codes are read from the Extensions
+// database when invoice lines are configured.
+func (s *Server) writeOffRules(ctx context.Context, args *[]any) (writeOffRules, error) {
+	var codes []string
+	if s.cfg.AptoraSources.InvoiceLinesView != "" {
+		var err error
+		if codes, err = s.writeOffItemCodes(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return newWriteOffRules(s.cfg.AptoraSources, codes, args), nil
+}
+
+// newWriteOffRules returns the rules that src supports, appending the
+// parameters they use to args.
+func newWriteOffRules(src AptoraSources, itemCodes []string, args *[]any) writeOffRules {
+	param := func(v any) string {
+		*args = append(*args, v)
+		return "@p" + strconv.Itoa(len(*args))
+	}
+
+	rules := writeOffRules{
+		{api.WriteOffZeroSubtotal, `COALESCE(i."Tran Subtotal", 0) = 0`},
+		{api.WriteOffNegativeSubtotal, `COALESCE(i."Tran Subtotal", 0) < 0`},
+	}
+
+	if src.CreditMemoType != "" {
+		rules = append(rules, writeOffRule{api.WriteOffCreditMemo, `COALESCE((
+			SELECT ABS(SUM(c."Tran Subtotal")) FROM aptCDV_VW_APT_InvSalCredEstList c
+			WHERE c."Tran Type" = ` + param(src.CreditMemoType) + ` AND c.` + quoteName(src.CreditMemoInvoiceColumn) + ` = i."Tran No"
+		), 0) >= COALESCE(i."Tran Subtotal", 0)`})
+	}
+
+	if src.InvoiceLinesView != "" {
+		lines := `SELECT 1 FROM ` + quoteName(src.InvoiceLinesView) + ` l WHERE l.` + quoteName(src.LineInvoiceColumn) + ` = i."Tran No"`
+		if len(itemCodes) > 0 {
+			params := make([]string, len(itemCodes))
+			for i, code := range itemCodes {
+				params[i] = param(code)
+			}
+			rules = append(rules, writeOffRule{api.WriteOffItem,
+				`EXISTS (` + lines + ` AND l.` + quoteName(src.LineItemColumn) + ` IN (` + strings.Join(params, ", ") + `))`})
+		}
+		rules = append(rules, writeOffRule{api.WriteOffZeroPriceLine,
+			`EXISTS (` + lines + ` AND l.` + quoteName(src.LinePriceColumn) + ` = 0)`})
+	}
+
+	return rules
+}
+
+// writeOffItemCodes returns the configured write-off item codes.
+func (s *Server) writeOffItemCodes(ctx context.Context) ([]string, error) {
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		return nil, errors.New("extensions database not available for write-off item codes")
+	}
+	list, err := writeoffs.ListItemCodes(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	codes := make([]string, len(list))
+	for i, c := range list {
+		codes[i] = c.ItemCode
+	}
+	return codes, nil
+}
+
+// condition returns a predicate that is true for write-offs.
+func (r writeOffRules) condition() string {
+	preds := make([]string, len(r))
+	for i, rule := range r {
+		preds[i] = rule.predicate
+	}
+	return "(" + strings.Join(preds, " OR ") + ")"
+}
+
+// reasonSQL returns an expression giving the reason of the first matching
+// rule, or NULL for invoices that aren't write-offs.
+func (r writeOffRules) reasonSQL() string {
+	var b strings.Builder
+	b.WriteString("CASE")
+	for _, rule := range r {
+		b.WriteString(" WHEN " + rule.predicate + " THEN '" + string(rule.reason) + "'")
+	}
+	b.WriteString(" END")
+	return b.String()
+}
+
+// reasons lists the reasons the rules detect.
+func (r writeOffRules) reasons() []api.WriteOffReason {
+	reasons := make([]api.WriteOffReason, len(r))
+	for i, rule := range r {
+		reasons[i] = rule.reason
+	}
+	return reasons
+}
+
+// markWriteOff sets the invoice's write-off fields from the value of
+// writeOffRules.reasonSQL.
+func markWriteOff(inv *api.Invoice, reason sql.NullString) {
+	inv.WriteOffReason = api.WriteOffReason(strings.TrimSpace(reason.String))
+	inv.IsWriteOff = inv.WriteOffReason != ""
+}
+
+// handleWriteOffs summarizes the write-offs matching the same filters as
+// handleInvoices by sales rep and reason.
+func (s *Server) handleWriteOffs(w http.ResponseWriter, r *http.Request) {
+	db := s.db.AptoraDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	filter, err := parseInvoiceFilter(r.URL.Query())
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, err.Error())
+		return
+	}
+
+	var totals []repWriteOffs
+	var rules writeOffRules
+	err = s.withQueryBudget(r.Context(), "reports", filter.logAttrs(), func(ctx context.Context) error {
+		return s.withAptoraConn(ctx, func(conn database.Querier) error {
+			var err error
+			totals, rules, err = s.queryWriteOffs(ctx, conn, filter)
+			return err
+		})
+	})
+	if err != nil {
+		s.writeQueryError(w, r, err, "failed to query write-offs")
+		return
+	}
+
+	resp := api.WriteOffsResponse{
+		StartDate: filter.StartDate.Format("2006-01-02"),
+		EndDate:   filter.EndDate.Format("2006-01-02"),
+		Reasons:   []api.WriteOffTotal{},
+		Reps:      []api.WriteOffRep{},
+		Rules:     rules.reasons(),
+	}
+	reasons := map[api.WriteOffReason]*api.WriteOffTotal{}
+	for _, t := range totals {
+		// Rows are ordered by rep, so each rep's reasons are adjacent
+		if n := len(resp.Reps); n == 0 || resp.Reps[n-1].EmployeeName != t.rep {
+			resp.Reps = append(resp.Reps, api.WriteOffRep{EmployeeName: t.rep, Reasons: []api.WriteOffTotal{}})
+		}
+		rep := &resp.Reps[len(resp.Reps)-1]
+		rep.Count += t.Count
+		rep.Subtotal = roundCents(rep.Subtotal + t.Subtotal)
+		rep.Reasons = append(rep.Reasons, t.WriteOffTotal)
+
+		resp.Count += t.Count
+		resp.Subtotal = roundCents(resp.Subtotal + t.Subtotal)
+		if reasons[t.Reason] == nil {
+			reasons[t.Reason] = &api.WriteOffTotal{Reason: t.Reason}
+		}
+		reasons[t.Reason].Count += t.Count
+		reasons[t.Reason].Subtotal = roundCents(reasons[t.Reason].Subtotal + t.Subtotal)
+	}
+	for _, reason := range api.WriteOffReasons {
+		if t := reasons[reason]; t != nil {
+			resp.Reasons = append(resp.Reasons, *t)
+		}
+	}
+
+	s.writeJSONWithETag(w, r, resp)
+}
+
+// repWriteOffs is a sales rep's write-offs with one reason.
+type repWriteOffs struct {
+	rep string
+	api.WriteOffTotal
+}
+
+// queryWriteOffs totals the write-offs matching the filter by sales rep and
+// reason, ordered by rep, and returns the rules it applied.
+func (s *Server) queryWriteOffs(ctx context.Context, db database.Querier, filter invoiceFilter) ([]repWriteOffs, writeOffRules, error) {
+	where := `
+		FROM aptCDV_VW_APT_InvSalCredEstList i
+		WHERE i."Tran Date" >= @p1 AND i."Tran Date" <= @p2 AND i."Tran Type" = 'Invoice'`
+	args := []any{filter.StartDate.Format("2006-01-02"), filter.EndDate.Format("2006-01-02")}
+	if filter.Employee != "" {
+		where += ` AND i."Sales Rep" = @p3`
+		args = append(args, filter.Employee)
+	}
+	rules, err := s.writeOffRules(ctx, &args)
+	if err != nil {
+		return nil, nil, err
+	}
+	// SQL Server can't group by an expression with subqueries, which the
+	// line and credit memo rules use, so reasons are grouped outside
+	query := `
+		SELECT w.rep, w.reason, COUNT(*), SUM(w.subtotal)
+		FROM (
+			SELECT i."Sales Rep" AS rep, ` + rules.reasonSQL() + ` AS reason, COALESCE(i."Tran Subtotal", 0) AS subtotal` + where + `
+		) w
+		WHERE w.reason IS NOT NULL
+		GROUP BY w.rep, w.reason
+		ORDER BY w.rep ASC`
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query write-offs: %w", err)
+	}
+	defer rows.Close()
+
+	totals := []repWriteOffs{}
+	for rows.Next() {
+		var t repWriteOffs
+		var reason string
+		if err := rows.Scan(&t.rep, &reason, &t.Count, &t.Subtotal); err != nil {
+			s.log(ctx).Error("failed to scan write-off row", slog.Any("error", err))
+			continue
+		}
+		t.Reason = api.WriteOffReason(strings.TrimSpace(reason))
+		t.Subtotal = roundCents(t.Subtotal)
+		totals = append(totals, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read write-offs: %w", err)
+	}
+
+	return totals, rules, nil
+}
+
+func (s *Server) handleListWriteOffItemCodes(w http.ResponseWriter, r *http.Request) {
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	codes, err := writeoffs.ListItemCodes(ctx, db)
+	if err != nil {
+		s.log(r.Context()).Error("failed to list write-off item codes", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to list write-off item codes")
+		return
+	}
+
+	resp := api.WriteOffItemCodesResponse{ItemCodes: codes, Active: s.cfg.AptoraSources.InvoiceLinesView != ""}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleCreateWriteOffItemCode(w http.ResponseWriter, r *http.Request) {
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	var req api.CreateWriteOffItemCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err == nil {
+		err = writeoffs.ValidateItemCode(&req)
+	}
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, "invalid write-off item code: "+err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	code, err := writeoffs.CreateItemCode(ctx, db, req)
+	if errors.Is(err, writeoffs.ErrDuplicate) {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, "write-off item code already exists")
+		return
+	}
+	if err != nil {
+		s.log(r.Context()).Error("failed to create write-off item code", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to create write-off item code")
+		return
+	}
+
+	// Cached invoices carry write-off flags computed with the old codes
+	s.invoiceCache.Purge()
+	s.log(r.Context()).Info("created write-off item code", slog.Int("item_code_id", code.ID), slog.String("item_code", code.ItemCode))
+	s.writeJSON(w, http.StatusCreated, code)
+}
+
+func (s *Server) handleDeleteWriteOffItemCode(w http.ResponseWriter, r *http.Request) {
+	db := s.db.ExtensionsDB()
+	if db == nil {
+		s.writeDBUnavailable(w, r)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		s.writeError(w, r, http.StatusBadRequest, api.CodeInvalidParam, "invalid write-off item code id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := writeoffs.DeleteItemCode(ctx, db, id); err != nil {
+		if errors.Is(err, writeoffs.ErrNotFound) {
+			s.writeError(w, r, http.StatusNotFound, api.CodeNotFound, "write-off item code not found")
+			return
+		}
+		s.log(r.Context()).Error("failed to delete write-off item code", slog.Any("error", err))
+		s.writeError(w, r, http.StatusInternalServerError, api.CodeInternal, "failed to delete write-off item code")
+		return
+	}
+
+	s.invoiceCache.Purge()
+	s.log(r.Context()).Info("deleted write-off item code", slog.Int("item_code_id", id))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/database"
+)
+
+var testSources = AptoraSources{
+	InvoiceLinesView:        "dbo.Invoice Lines",
+	LineInvoiceColumn:       "Tran No",
+	LineItemColumn:          "Item Code",
+	LinePriceColumn:         "Price",
+	CreditMemoType:          "Credit Memo",
+	CreditMemoInvoiceColumn: "Applied To",
+}
+
+func TestWriteOffRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       AptoraSources
+		itemCodes []string
+		reasons   []api.WriteOffReason
+		params    []any
+	}{
+		{"invoice view only", AptoraSources{}, nil,
+			[]api.WriteOffReason{api.WriteOffZeroSubtotal, api.WriteOffNegativeSubtotal}, nil},
+		{"every source", testSources, []string{"WO", "COMP"},
+			api.WriteOffReasons, []any{"Credit Memo", "WO", "COMP"}},
+		{"no item codes", testSources, nil,
+			[]api.WriteOffReason{api.WriteOffZeroSubtotal, api.WriteOffNegativeSubtotal, api.WriteOffCreditMemo, api.WriteOffZeroPriceLine},
+			[]any{"Credit Memo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []any{"2026-01-01", "2026-01-31", "Jane Doe"}
+			rules := newWriteOffRules(tt.src, tt.itemCodes, &args)
+
+			if got := rules.reasons(); !slices.Equal(got, tt.reasons) {
+				t.Errorf("reasons = %v, want %v", got, tt.reasons)
+			}
+			if !slices.Equal(args[3:], tt.params) {
+				t.Errorf("appended params = %v, want %v", args[3:], tt.params)
+			}
+			if !strings.Contains(rules.condition(), `COALESCE(i."Tran Subtotal", 0)`) {
+				t.Errorf("condition doesn't treat a missing subtotal as zero: %s", rules.condition())
+			}
+
+			// The rules must pass the Aptora query guard in every form the
+			// server uses them
+			where := ` FROM aptCDV_VW_APT_InvSalCredEstList i WHERE i."Tran Date" >= @p1 AND i."Sales Rep" = @p3`
+			queries := []string{
+				`SELECT COUNT(*)` + where + ` AND ` + rules.condition(),
+				`SELECT i."Tran No", ` + rules.reasonSQL() + where + ` AND NOT ` + rules.condition(),
+				`SELECT w.rep, w.reason, COUNT(*) FROM (SELECT i."Sales Rep" AS rep, ` + rules.reasonSQL() + ` AS reason` + where +
+					`) w WHERE w.reason IS NOT NULL GROUP BY w.rep, w.reason`,
+			}
+			for _, q := range queries {
+				if err := database.CheckReadOnlyQuery(q); err != nil {
+					t.Errorf("CheckReadOnlyQuery(%q) = %v", q, err)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteOffRulesQuoteNames(t *testing.T) {
+	var args []any
+	rules := newWriteOffRules(testSources, []string{"WO"}, &args)
+	sql := rules.reasonSQL()
+	for _, want := range []string{`"dbo"."Invoice Lines" l`, `l."Item Code" IN (@p2)`, `l."Price" = 0`, `c."Applied To" = i."Tran No"`, `c."Tran Type" = @p1`} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("reason SQL has no %s:\n%s", want, sql)
+		}
+	}
+	for _, reason := range api.WriteOffReasons {
+		if !strings.Contains(sql, "THEN '"+string(reason)+"'") {
+			t.Errorf("reason SQL never yields %s", reason)
+		}
+	}
+}
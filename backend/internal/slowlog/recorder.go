@@ -0,0 +1,170 @@
+// Package slowlog records slow Aptora queries in the Extensions database, so
+// the queries worth optimizing (or indexing for) can be found after the fact.
+package slowlog
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/database"
+)
+
+const (
+	// retention is how long recorded runs are kept.
+	retention = 30 * 24 * time.Hour
+
+	// queueSize bounds the runs waiting to be stored. When the Extensions
+	// database can't keep up, further runs are dropped rather than slowing
+	// down the queries being measured.
+	queueSize = 100
+
+	// planTimeout bounds the plan cache lookup of a slow query.
+	planTimeout = 5 * time.Second
+)
+
+// Entry is one run of a slow query along with who it ran for.
+type Entry struct {
+	Query    string
+	Args     []any
+	Duration time.Duration
+	Rows     int
+	Err      error
+
+	Endpoint  string // route pattern; empty for background work
+	User      string // API key name, or "admin"; empty for browser requests
+	RequestID string
+	At        time.Time
+}
+
+// Recorder stores Aptora queries that take at least a threshold in the
+// Extensions database, optionally with their cached query plan. Storing
+// happens in Run, off the path of the query being recorded.
+type Recorder struct {
+	logger      *slog.Logger
+	db          *database.Manager
+	threshold   time.Duration
+	capturePlan bool
+	queue       chan Entry
+	dropped     atomic.Int64
+}
+
+// New returns a Recorder for queries taking at least threshold. A threshold
+// of zero disables it. With capturePlan, each run is stored with the plan
+// SQL Server cached for the query.
+func New(logger *slog.Logger, db *database.Manager, threshold time.Duration, capturePlan bool) *Recorder {
+	return &Recorder{
+		logger:      logger.With(slog.String("component", "slow_query_log")),
+		db:          db,
+		threshold:   threshold,
+		capturePlan: capturePlan,
+		queue:       make(chan Entry, queueSize),
+	}
+}
+
+// IsSlow reports whether a query that took d should be recorded.
+func (r *Recorder) IsSlow(d time.Duration) bool {
+	return r.threshold > 0 && d >= r.threshold
+}
+
+// Record queues a run to be stored. It never blocks; if the queue is full
+// the run is dropped and counted.
+func (r *Recorder) Record(e Entry) {
+	select {
+	case r.queue <- e:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// Run stores queued runs, and hourly prunes those older than the retention
+// period, until ctx is cancelled.
+func (r *Recorder) Run(ctx context.Context) {
+	if r.threshold <= 0 {
+		r.logger.Info("slow query log disabled")
+		return
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-r.queue:
+			r.store(ctx, e)
+		case <-ticker.C:
+			r.prune(ctx)
+			if n := r.dropped.Swap(0); n > 0 {
+				r.logger.Warn("dropped slow queries because the log couldn't keep up", slog.Int64("dropped", n))
+			}
+		}
+	}
+}
+
+func (r *Recorder) store(ctx context.Context, e Entry) {
+	defer r.db.Hold()()
+	db := r.db.ExtensionsDB()
+	if db == nil {
+		r.dropped.Add(1)
+		return
+	}
+
+	var plan sql.NullString
+	if r.capturePlan && e.Err == nil {
+		plan = r.cachedPlan(ctx, e.Query)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := insert(ctx, db, e, plan); err != nil {
+		r.logger.Error("failed to record slow query", slog.Any("error", err))
+	}
+}
+
+// cachedPlan looks up the query's plan, returning NULL if it can't be found.
+func (r *Recorder) cachedPlan(ctx context.Context, query string) sql.NullString {
+	aptora := r.db.AptoraDB()
+	if aptora == nil {
+		return sql.NullString{}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, planTimeout)
+	defer cancel()
+
+	plan, err := aptora.CachedPlan(ctx, query)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		r.logger.Debug("slow query plan is no longer cached")
+		return sql.NullString{}
+	case err != nil:
+		// Most likely the Aptora login lacks VIEW SERVER STATE
+		r.logger.Warn("failed to capture slow query plan", slog.Any("error", err))
+		return sql.NullString{}
+	}
+	return sql.NullString{String: plan, Valid: true}
+}
+
+func (r *Recorder) prune(ctx context.Context) {
+	defer r.db.Hold()()
+	db := r.db.ExtensionsDB()
+	if db == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	n, err := prune(ctx, db, time.Now().Add(-retention))
+	if err != nil {
+		r.logger.Error("failed to prune slow query log", slog.Any("error", err))
+		return
+	}
+	if n > 0 {
+		r.logger.Info("pruned slow query log", slog.Int64("deleted", n))
+	}
+}
@@ -0,0 +1,156 @@
+package slowlog
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+)
+
+var (
+	// ErrNotFound is returned when a recorded run ID does not exist.
+	ErrNotFound = errors.New("slow query not found")
+
+	// ErrNoPlan is returned when a run was recorded without a query plan.
+	ErrNoPlan = errors.New("no query plan was captured")
+)
+
+func insert(ctx context.Context, db *sql.DB, e Entry, plan sql.NullString) error {
+	params := make([]string, len(e.Args))
+	for i, arg := range e.Args {
+		params[i] = formatArg(arg)
+	}
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to encode slow query params: %w", err)
+	}
+
+	var queryErr sql.NullString
+	if e.Err != nil {
+		queryErr = sql.NullString{String: truncate(e.Err.Error(), 1000), Valid: true}
+	}
+
+	sum := sha256.Sum256([]byte(e.Query))
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO slow_queries (query_hash, query_text, params, duration_ms, row_count, error, endpoint, user_name, request_id, query_plan, recorded_at)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9, @p10, @p11)`,
+		hex.EncodeToString(sum[:]), e.Query, string(paramsJSON), e.Duration.Milliseconds(), e.Rows, queryErr,
+		nullString(truncate(e.Endpoint, 200)), nullString(truncate(e.User, 100)), nullString(e.RequestID), plan, e.At.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to insert slow query: %w", err)
+	}
+	return nil
+}
+
+// Worst returns the limit queries that spent the most time in total over
+// the threshold since the given time, each with its slowest run.
+func Worst(ctx context.Context, db *sql.DB, since time.Time, limit int) ([]api.SlowQuery, error) {
+	rows, err := db.QueryContext(ctx, `
+		WITH recent AS (
+			SELECT id, query_hash, query_text, params, duration_ms, row_count, error, endpoint, user_name, request_id,
+				CASE WHEN query_plan IS NULL THEN 0 ELSE 1 END AS has_plan, recorded_at,
+				ROW_NUMBER() OVER (PARTITION BY query_hash ORDER BY duration_ms DESC, id DESC) AS slowest
+			FROM slow_queries
+			WHERE recorded_at >= @p1
+		), totals AS (
+			SELECT query_hash, COUNT(*) AS runs, SUM(CAST(duration_ms AS BIGINT)) AS total_ms,
+				MAX(duration_ms) AS max_ms, AVG(duration_ms) AS avg_ms, MAX(recorded_at) AS last_seen_at
+			FROM recent
+			GROUP BY query_hash
+		)
+		SELECT TOP (@p2) r.query_hash, r.query_text, t.runs, t.total_ms, t.max_ms, t.avg_ms, t.last_seen_at,
+			r.id, r.params, r.duration_ms, r.row_count, r.error, r.endpoint, r.user_name, r.request_id, r.has_plan, r.recorded_at
+		FROM recent r
+		JOIN totals t ON t.query_hash = r.query_hash
+		WHERE r.slowest = 1
+		ORDER BY t.total_ms DESC`, since.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query slow queries: %w", err)
+	}
+	defer rows.Close()
+
+	queries := []api.SlowQuery{}
+	for rows.Next() {
+		var q api.SlowQuery
+		var params string
+		var queryErr, endpoint, user, requestID sql.NullString
+		err := rows.Scan(&q.QueryHash, &q.Query, &q.Runs, &q.TotalMS, &q.MaxMS, &q.AvgMS, &q.LastSeenAt,
+			&q.Slowest.ID, &params, &q.Slowest.DurationMS, &q.Slowest.Rows, &queryErr, &endpoint, &user, &requestID,
+			&q.Slowest.HasPlan, &q.Slowest.RecordedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan slow query: %w", err)
+		}
+		if err := json.Unmarshal([]byte(params), &q.Slowest.Params); err != nil {
+			return nil, fmt.Errorf("failed to decode slow query params: %w", err)
+		}
+		q.Slowest.Error = queryErr.String
+		q.Slowest.Endpoint = endpoint.String
+		q.Slowest.User = user.String
+		q.Slowest.RequestID = requestID.String
+		queries = append(queries, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read slow queries: %w", err)
+	}
+
+	return queries, nil
+}
+
+// Plan returns the showplan XML captured with a recorded run.
+func Plan(ctx context.Context, db *sql.DB, id int) (string, error) {
+	var plan sql.NullString
+	err := db.QueryRowContext(ctx, `SELECT query_plan FROM slow_queries WHERE id = @p1`, id).Scan(&plan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query slow query plan: %w", err)
+	}
+	if !plan.Valid {
+		return "", ErrNoPlan
+	}
+	return plan.String, nil
+}
+
+// prune deletes runs recorded before the given time.
+func prune(ctx context.Context, db *sql.DB, before time.Time) (int64, error) {
+	res, err := db.ExecContext(ctx, `DELETE FROM slow_queries WHERE recorded_at < @p1`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// formatArg renders a query parameter for display.
+func formatArg(arg any) string {
+	switch v := arg.(type) {
+	case nil:
+		return "NULL"
+	case sql.NamedArg:
+		return "@" + v.Name + " = " + formatArg(v.Value)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []byte:
+		return fmt.Sprintf("0x%X", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// truncate shortens s to at most n characters.
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
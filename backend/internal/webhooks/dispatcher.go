@@ -0,0 +1,356 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/database"
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/events"
+)
+
+// retryBackoff is the wait before each retry of a failed delivery. A delivery
+// is attempted once more than its length before being marked failed.
+var retryBackoff = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+	2 * time.Hour,
+	6 * time.Hour,
+}
+
+// Header names sent with every delivery. The signature is computed as
+//
+//	hex(HMAC-SHA256(secret, timestamp + "." + body))
+//
+// and sent as "t=<timestamp>,v1=<signature>", so receivers can reject
+// replayed requests by checking the timestamp.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Dispatcher queues events for matching webhooks and delivers them. Queued
+// deliveries are stored in the Extensions database, so retries survive
+// restarts and double as the delivery log.
+type Dispatcher struct {
+	logger *slog.Logger
+	db     *database.Manager
+	client *http.Client
+	wake   chan struct{}
+}
+
+// NewDispatcher returns a Dispatcher. Call Run to start delivering.
+func NewDispatcher(logger *slog.Logger, db *database.Manager) *Dispatcher {
+	return &Dispatcher{
+		logger: logger.With(slog.String("component", "webhooks")),
+		db:     db,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			// A redirect usually means a misconfigured URL, so report it
+			// rather than following it
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// PublishInvoice queues an invoice event for every enabled webhook that
+// subscribes to it and whose subtotal threshold the invoice meets.
+func (d *Dispatcher) PublishInvoice(ctx context.Context, event api.WebhookEvent, inv api.Invoice) error {
+	return d.publish(ctx, api.WebhookPayload{Event: event, Invoice: &inv})
+}
+
+// PublishDispute queues an invoice.disputed event for every enabled webhook
+// that subscribes to it. Subtotal thresholds don't apply: a dispute is worth
+// hearing about whatever the invoice's size.
+func (d *Dispatcher) PublishDispute(ctx context.Context, inv api.Invoice, review api.InvoiceReview) error {
+	return d.publish(ctx, api.WebhookPayload{Event: api.EventInvoiceDisputed, Invoice: &inv, Review: &review})
+}
+
+// publish queues p for every enabled webhook that subscribes to its event,
+// applying subtotal thresholds to invoice.created events.
+func (d *Dispatcher) publish(ctx context.Context, p api.WebhookPayload) error {
+	defer d.db.Hold()()
+	db := d.db.ExtensionsDB()
+	if db == nil {
+		return errors.New("extensions database not available")
+	}
+
+	hooks, err := enabledHooks(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	p.CreatedAt = now.UTC()
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	queued := 0
+	for _, h := range hooks {
+		if !slices.Contains(h.Events, p.Event) {
+			continue
+		}
+		if p.Event == api.EventInvoiceCreated && h.MinSubtotal != nil && p.Invoice.Subtotal < *h.MinSubtotal {
+			continue
+		}
+		if _, err := insertDelivery(ctx, db, h.ID, p.Event, payload, now); err != nil {
+			return err
+		}
+		queued++
+	}
+
+	if queued > 0 {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Forward queues an invoice.created event for every invoice inserted in
+// Aptora, as reported by the change detector, and an invoice.disputed event
+// for every invoice whose review status changes to disputed, until events is
+// closed or ctx is cancelled.
+func (d *Dispatcher) Forward(ctx context.Context, ch <-chan events.Event) {
+	for {
+		var e events.Event
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			e = ev
+		}
+
+		switch e.Type {
+		case events.InvoiceInserted:
+			change := e.Data.(events.InvoiceChange)
+			if err := d.PublishInvoice(ctx, api.EventInvoiceCreated, change.Invoice); err != nil && ctx.Err() == nil {
+				d.logger.Error("failed to publish invoice event", slog.Int("invoice_number", change.Invoice.Number), slog.Any("error", err))
+			}
+		case events.ReviewChanged:
+			change := e.Data.(events.ReviewChange)
+			if change.Review.Status != api.ReviewDisputed {
+				continue
+			}
+			if err := d.PublishDispute(ctx, change.Invoice, change.Review); err != nil && ctx.Err() == nil {
+				d.logger.Error("failed to publish dispute event", slog.Int("invoice_number", change.Invoice.Number), slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// TestFire sends a webhook.test event to a webhook immediately. Test
+// deliveries are logged but not retried.
+func (d *Dispatcher) TestFire(ctx context.Context, id int) (api.WebhookDelivery, error) {
+	defer d.db.Hold()()
+	db := d.db.ExtensionsDB()
+	if db == nil {
+		return api.WebhookDelivery{}, errors.New("extensions database not available")
+	}
+
+	h, err := getHook(ctx, db, id)
+	if err != nil {
+		return api.WebhookDelivery{}, err
+	}
+
+	now := time.Now()
+	payload, err := json.Marshal(api.WebhookPayload{Event: api.EventWebhookTest, CreatedAt: now.UTC()})
+	if err != nil {
+		return api.WebhookDelivery{}, fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+	deliveryID, err := insertDelivery(ctx, db, h.ID, api.EventWebhookTest, payload, now)
+	if err != nil {
+		return api.WebhookDelivery{}, err
+	}
+
+	pd := pendingDelivery{
+		WebhookDelivery: api.WebhookDelivery{
+			ID:        deliveryID,
+			WebhookID: h.ID,
+			Event:     api.EventWebhookTest,
+			Status:    api.DeliveryPending,
+			CreatedAt: now.UTC(),
+		},
+		url:     h.URL,
+		secret:  h.secret,
+		payload: payload,
+	}
+	return d.attempt(ctx, db, pd, false), nil
+}
+
+// Run delivers due deliveries until ctx is cancelled. It wakes every 10
+// seconds to pick up retries, and immediately when an event is published.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if db := d.db.ExtensionsDB(); db != nil {
+			d.deliverDue(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *Dispatcher) deliverDue(ctx context.Context) {
+	defer d.db.Hold()()
+	db := d.db.ExtensionsDB()
+	for ctx.Err() == nil {
+		due, err := dueDeliveries(ctx, db, time.Now(), 20)
+		if err != nil {
+			d.logger.Error("failed to load webhook deliveries", slog.Any("error", err))
+			return
+		}
+		for _, pd := range due {
+			d.attempt(ctx, db, pd, true)
+		}
+		if len(due) < 20 {
+			return
+		}
+	}
+}
+
+// attempt posts a delivery once and records the outcome, scheduling a retry
+// if retry is set and attempts remain.
+func (d *Dispatcher) attempt(ctx context.Context, db *sql.DB, pd pendingDelivery, retry bool) api.WebhookDelivery {
+	logger := d.logger.With(slog.Int("webhook_id", pd.WebhookID), slog.Int("delivery_id", pd.ID), slog.String("event", string(pd.Event)))
+
+	status, err := d.post(ctx, pd)
+	if err != nil && ctx.Err() != nil {
+		// Shutting down; leave the delivery pending for the next start
+		return pd.WebhookDelivery
+	}
+	del := pd.WebhookDelivery
+	del.Attempts++
+	del.ResponseStatus = nil
+	if status != 0 {
+		del.ResponseStatus = &status
+	}
+	del.NextAttemptAt = nil
+
+	now := time.Now().UTC()
+	switch {
+	case err == nil:
+		del.Status = api.DeliverySucceeded
+		del.Error = ""
+		del.DeliveredAt = &now
+		logger.Info("webhook delivered", slog.Int("attempts", del.Attempts))
+	case retry && del.Attempts <= len(retryBackoff):
+		del.Error = err.Error()
+		next := now.Add(retryBackoff[del.Attempts-1])
+		del.NextAttemptAt = &next
+		logger.Warn("webhook delivery failed, will retry", slog.Int("attempts", del.Attempts),
+			slog.Time("next_attempt_at", next), slog.Any("error", err))
+	default:
+		del.Status = api.DeliveryFailed
+		del.Error = err.Error()
+		logger.Error("webhook delivery failed", slog.Int("attempts", del.Attempts), slog.Any("error", err))
+	}
+
+	// Record the outcome even if ctx was cancelled mid-request
+	if err := updateDelivery(context.WithoutCancel(ctx), db, del); err != nil {
+		logger.Error("failed to record webhook delivery", slog.Any("error", err))
+	}
+	return del
+}
+
+// post sends the signed payload, returning the response status if one was
+// received. Any non-2xx status is an error.
+func (d *Dispatcher) post(ctx context.Context, pd pendingDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pd.url, bytes.NewReader(pd.payload))
+	if err != nil {
+		return 0, fmt.Errorf("invalid webhook request: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "aptora-extensions-webhooks")
+	req.Header.Set(HeaderEvent, string(pd.Event))
+	req.Header.Set(HeaderDelivery, strconv.Itoa(pd.ID))
+	req.Header.Set(HeaderSignature, "t="+timestamp+",v1="+Sign(pd.secret, timestamp, pd.payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		// Drop the URL from the error; it may contain credentials
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return 0, fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		msg := strings.TrimSpace(string(body))
+		if msg != "" {
+			return resp.StatusCode, fmt.Errorf("webhook returned %d: %s", resp.StatusCode, msg)
+		}
+		return resp.StatusCode, fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	return resp.StatusCode, nil
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 signature of a payload.
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateWebhook checks a webhook request before it is stored.
+func ValidateWebhook(req api.CreateWebhookRequest) error {
+	switch {
+	case req.Name == "":
+		return errors.New("name is required")
+	case len(req.Events) == 0:
+		return errors.New("at least one event is required")
+	case req.MinSubtotal != nil && *req.MinSubtotal < 0:
+		return errors.New("min_subtotal can't be negative")
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+
+	for _, e := range req.Events {
+		if e == api.EventWebhookTest || !slices.Contains(api.WebhookEvents, e) {
+			return fmt.Errorf("unknown event %q", e)
+		}
+	}
+	return nil
+}
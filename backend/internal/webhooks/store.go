@@ -0,0 +1,281 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+)
+
+// secretPrefix marks webhook signing secrets, like the apx_ prefix on API keys.
+const secretPrefix = "whsec_"
+
+// ErrNotFound is returned when a webhook ID does not exist.
+var ErrNotFound = errors.New("webhook not found")
+
+// hook is a webhook along with its signing secret.
+type hook struct {
+	api.Webhook
+	secret string
+}
+
+const webhookColumns = `id, name, url, secret, events, min_subtotal, enabled, created_at`
+
+// CreateWebhook stores a new, enabled webhook with a generated signing
+// secret. The secret is returned in the result and can't be retrieved later.
+func CreateWebhook(ctx context.Context, db *sql.DB, req api.CreateWebhookRequest) (api.CreatedWebhook, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return api.CreatedWebhook{}, fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	secret := secretPrefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	wh := api.Webhook{
+		Name:        req.Name,
+		URL:         req.URL,
+		Events:      req.Events,
+		MinSubtotal: req.MinSubtotal,
+		Enabled:     true,
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	minSubtotal := sql.NullFloat64{}
+	if req.MinSubtotal != nil {
+		minSubtotal = sql.NullFloat64{Float64: *req.MinSubtotal, Valid: true}
+	}
+
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO webhooks (name, url, secret, events, min_subtotal, enabled, created_at)
+		OUTPUT INSERTED.id
+		VALUES (@p1, @p2, @p3, @p4, @p5, 1, @p6)`,
+		wh.Name, wh.URL, secret, joinEvents(wh.Events), minSubtotal, wh.CreatedAt,
+	).Scan(&wh.ID)
+	if err != nil {
+		return api.CreatedWebhook{}, fmt.Errorf("failed to insert webhook: %w", err)
+	}
+
+	return api.CreatedWebhook{Webhook: wh, Secret: secret}, nil
+}
+
+// ListWebhooks returns every webhook, without secrets.
+func ListWebhooks(ctx context.Context, db *sql.DB) ([]api.Webhook, error) {
+	hooks, err := queryHooks(ctx, db, `SELECT `+webhookColumns+` FROM webhooks ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	webhooks := make([]api.Webhook, len(hooks))
+	for i, h := range hooks {
+		webhooks[i] = h.Webhook
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook removes a webhook along with its delivery log.
+func DeleteWebhook(ctx context.Context, db *sql.DB, id int) error {
+	res, err := db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = @p1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func getHook(ctx context.Context, db *sql.DB, id int) (hook, error) {
+	hooks, err := queryHooks(ctx, db, `SELECT `+webhookColumns+` FROM webhooks WHERE id = @p1`, id)
+	if err != nil {
+		return hook{}, err
+	}
+	if len(hooks) == 0 {
+		return hook{}, ErrNotFound
+	}
+	return hooks[0], nil
+}
+
+func enabledHooks(ctx context.Context, db *sql.DB) ([]hook, error) {
+	return queryHooks(ctx, db, `SELECT `+webhookColumns+` FROM webhooks WHERE enabled = 1 ORDER BY id`)
+}
+
+func queryHooks(ctx context.Context, db *sql.DB, query string, args ...any) ([]hook, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	hooks := []hook{}
+	for rows.Next() {
+		var h hook
+		var events string
+		var minSubtotal sql.NullFloat64
+		err := rows.Scan(&h.ID, &h.Name, &h.URL, &h.secret, &events, &minSubtotal, &h.Enabled, &h.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		for _, e := range strings.Split(events, ",") {
+			h.Events = append(h.Events, api.WebhookEvent(e))
+		}
+		if minSubtotal.Valid {
+			h.MinSubtotal = &minSubtotal.Float64
+		}
+		hooks = append(hooks, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read webhooks: %w", err)
+	}
+
+	return hooks, nil
+}
+
+// insertDelivery queues a payload for delivery to a webhook.
+func insertDelivery(ctx context.Context, db *sql.DB, webhookID int, event api.WebhookEvent, payload []byte, now time.Time) (int, error) {
+	var id int
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload, status, attempts, created_at, next_attempt_at)
+		OUTPUT INSERTED.id
+		VALUES (@p1, @p2, @p3, @p4, 0, @p5, @p5)`,
+		webhookID, string(event), string(payload), string(api.DeliveryPending), now.UTC(),
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to queue webhook delivery: %w", err)
+	}
+	return id, nil
+}
+
+// pendingDelivery is a queued delivery along with what's needed to send it.
+type pendingDelivery struct {
+	api.WebhookDelivery
+	url     string
+	secret  string
+	payload []byte
+}
+
+// dueDeliveries returns pending deliveries whose next attempt is due.
+func dueDeliveries(ctx context.Context, db *sql.DB, now time.Time, limit int) ([]pendingDelivery, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT TOP (@p3) d.id, d.webhook_id, d.event, d.attempts, d.created_at, d.payload, w.url, w.secret
+		FROM webhook_deliveries d
+		JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = @p1 AND d.next_attempt_at <= @p2
+		ORDER BY d.next_attempt_at, d.id`,
+		string(api.DeliveryPending), now.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []pendingDelivery{}
+	for rows.Next() {
+		var d pendingDelivery
+		var event, payload string
+		if err := rows.Scan(&d.ID, &d.WebhookID, &event, &d.Attempts, &d.CreatedAt, &payload, &d.url, &d.secret); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		d.Event = api.WebhookEvent(event)
+		d.Status = api.DeliveryPending
+		d.payload = []byte(payload)
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// updateDelivery records the outcome of a delivery attempt.
+func updateDelivery(ctx context.Context, db *sql.DB, d api.WebhookDelivery) error {
+	responseStatus := sql.NullInt32{}
+	if d.ResponseStatus != nil {
+		responseStatus = sql.NullInt32{Int32: int32(*d.ResponseStatus), Valid: true}
+	}
+	_, err := db.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = @p1, attempts = @p2, response_status = @p3, error = @p4, next_attempt_at = @p5, delivered_at = @p6
+		WHERE id = @p7`,
+		string(d.Status), d.Attempts, responseStatus, nullString(d.Error), nullTime(d.NextAttemptAt), nullTime(d.DeliveredAt), d.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// ListDeliveries returns a webhook's most recent deliveries, newest first.
+func ListDeliveries(ctx context.Context, db *sql.DB, webhookID, limit int) ([]api.WebhookDelivery, error) {
+	if _, err := getHook(ctx, db, webhookID); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT TOP (@p2) id, webhook_id, event, status, attempts, response_status, error, created_at, next_attempt_at, delivered_at
+		FROM webhook_deliveries
+		WHERE webhook_id = @p1
+		ORDER BY id DESC`, webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []api.WebhookDelivery{}
+	for rows.Next() {
+		var d api.WebhookDelivery
+		var event, status string
+		var responseStatus sql.NullInt32
+		var deliveryErr sql.NullString
+		var next, delivered sql.NullTime
+		err := rows.Scan(&d.ID, &d.WebhookID, &event, &status, &d.Attempts, &responseStatus,
+			&deliveryErr, &d.CreatedAt, &next, &delivered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		d.Event = api.WebhookEvent(event)
+		d.Status = api.WebhookDeliveryStatus(status)
+		d.Error = deliveryErr.String
+		if responseStatus.Valid {
+			code := int(responseStatus.Int32)
+			d.ResponseStatus = &code
+		}
+		if next.Valid {
+			d.NextAttemptAt = &next.Time
+		}
+		if delivered.Valid {
+			d.DeliveredAt = &delivered.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+func joinEvents(events []api.WebhookEvent) string {
+	parts := make([]string, len(events))
+	for i, e := range events {
+		parts[i] = string(e)
+	}
+	return strings.Join(parts, ",")
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
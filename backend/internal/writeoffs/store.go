@@ -0,0 +1,105 @@
+// Package writeoffs stores the Aptora item codes that mark invoices as
+// write-offs in the Extensions database.
+package writeoffs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kwila-cloud/aptora-extensions/backend/internal/api"
+)
+
+// Lengths of the write_off_item_codes columns.
+const (
+	maxItemCode    = 50
+	maxDescription = 200
+)
+
+var (
+	// ErrNotFound is returned when an item code ID does not exist.
+	ErrNotFound = errors.New("write-off item code not found")
+
+	// ErrDuplicate is returned when an item code is already configured.
+	ErrDuplicate = errors.New("write-off item code already exists")
+)
+
+// ValidateItemCode checks a request to add an item code, after trimming it.
+func ValidateItemCode(req *api.CreateWriteOffItemCodeRequest) error {
+	req.ItemCode = strings.TrimSpace(req.ItemCode)
+	req.Description = strings.TrimSpace(req.Description)
+	switch {
+	case req.ItemCode == "":
+		return errors.New("item_code is required")
+	case utf8.RuneCountInString(req.ItemCode) > maxItemCode:
+		return fmt.Errorf("item_code can't be longer than %d characters", maxItemCode)
+	case utf8.RuneCountInString(req.Description) > maxDescription:
+		return fmt.Errorf("description can't be longer than %d characters", maxDescription)
+	}
+	return nil
+}
+
+// CreateItemCode adds a write-off item code. Item codes are compared with
+// the database collation, so they are usually case-insensitive.
+func CreateItemCode(ctx context.Context, db *sql.DB, req api.CreateWriteOffItemCodeRequest) (api.WriteOffItemCode, error) {
+	c := api.WriteOffItemCode{ItemCode: req.ItemCode, Description: req.Description, CreatedAt: time.Now().UTC()}
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO write_off_item_codes (item_code, description, created_at)
+		OUTPUT INSERTED.id
+		SELECT @p1, @p2, @p3
+		WHERE NOT EXISTS (SELECT 1 FROM write_off_item_codes WITH (UPDLOCK, HOLDLOCK) WHERE item_code = @p1)`,
+		c.ItemCode, c.Description, c.CreatedAt,
+	).Scan(&c.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return api.WriteOffItemCode{}, ErrDuplicate
+	}
+	if err != nil {
+		return api.WriteOffItemCode{}, fmt.Errorf("failed to insert write-off item code: %w", err)
+	}
+	return c, nil
+}
+
+// ListItemCodes returns every write-off item code, ordered by code.
+func ListItemCodes(ctx context.Context, db *sql.DB) ([]api.WriteOffItemCode, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, item_code, description, created_at
+		FROM write_off_item_codes
+		ORDER BY item_code`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query write-off item codes: %w", err)
+	}
+	defer rows.Close()
+
+	codes := []api.WriteOffItemCode{}
+	for rows.Next() {
+		var c api.WriteOffItemCode
+		if err := rows.Scan(&c.ID, &c.ItemCode, &c.Description, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan write-off item code: %w", err)
+		}
+		codes = append(codes, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read write-off item codes: %w", err)
+	}
+	return codes, nil
+}
+
+// DeleteItemCode removes a write-off item code.
+func DeleteItemCode(ctx context.Context, db *sql.DB, id int) error {
+	res, err := db.ExecContext(ctx, `DELETE FROM write_off_item_codes WHERE id = @p1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete write-off item code: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete write-off item code: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -16,10 +16,17 @@ ssh "$HOST" "sudo bash -c '[ -d /opt/aptora-extensions ] && rm -rf /opt/aptora-e
 
 # Copy files to server (while service is still running)
 echo "Copying files to server..."
-ssh "$HOST" "sudo mkdir -p /opt/aptora-extensions"
-scp ./aptora-extensions "$HOST":/tmp/aptora-extensions
-scp ./.env.production "$HOST":/tmp/aptora-extensions.env
-scp ./deploy/aptora-extensions.service "$HOST":/tmp/aptora-extensions.service
+ssh "$HOST" "sudo mkdir -p /opt/aptora-extensions && rm -rf /tmp/aptora-extensions-staging && mkdir -m 700 /tmp/aptora-extensions-staging"
+scp ./aptora-extensions "$HOST":/tmp/aptora-extensions-staging/aptora-extensions
+scp ./.env.production "$HOST":/tmp/aptora-extensions-staging/.env
+scp ./deploy/aptora-extensions.service "$HOST":/tmp/aptora-extensions-staging/aptora-extensions.service
+
+# Check the new binary and .env against the databases before any downtime
+echo "Checking configuration..."
+if ! ssh "$HOST" "cd /tmp/aptora-extensions-staging && sudo ./aptora-extensions config check"; then
+    echo "✗ Configuration check failed - the running service was not touched"
+    exit 1
+fi
 
 # Stop service (downtime starts here)
 echo "Stopping service..."
@@ -27,9 +34,10 @@ ssh "$HOST" "sudo systemctl stop aptora-extensions || true"
 
 # Move files to final location and set permissions (atomic swap)
 echo "Installing files and setting permissions..."
-ssh "$HOST" "sudo mv /tmp/aptora-extensions /opt/aptora-extensions/aptora-extensions && \
-            sudo mv /tmp/aptora-extensions.env /opt/aptora-extensions/.env && \
-            sudo mv /tmp/aptora-extensions.service /etc/systemd/system/aptora-extensions.service && \
+ssh "$HOST" "sudo mv /tmp/aptora-extensions-staging/aptora-extensions /opt/aptora-extensions/aptora-extensions && \
+            sudo mv /tmp/aptora-extensions-staging/.env /opt/aptora-extensions/.env && \
+            sudo mv /tmp/aptora-extensions-staging/aptora-extensions.service /etc/systemd/system/aptora-extensions.service && \
+            rm -rf /tmp/aptora-extensions-staging && \
             sudo chown root:root /opt/aptora-extensions/aptora-extensions /opt/aptora-extensions/.env && \
             sudo chmod 755 /opt/aptora-extensions/aptora-extensions && \
             sudo chmod 600 /opt/aptora-extensions/.env"
@@ -0,0 +1,426 @@
+// Code generated by cmd/apigen from backend/internal/api. DO NOT EDIT.
+// Run `just generate-api-types` after changing the API types.
+
+export interface APIKey {
+  id: number;
+  name: string;
+  prefix: string;
+  scopes: string[];
+  created_at: string;
+  expires_at: string | null;
+  last_used_at: string | null;
+  revoked_at: string | null;
+}
+
+export interface APIKeysResponse {
+  api_keys: APIKey[];
+}
+
+export interface CreateAPIKeyRequest {
+  name: string;
+  scopes: string[];
+  expires_at?: string | null;
+}
+
+export interface CreateReportSubscriptionRequest {
+  name: string;
+  report: ReportKind;
+  format: ReportFormat;
+  period: ReportPeriod;
+  employee?: string;
+  schedule: string;
+  recipients: string[];
+}
+
+export interface CreateWebhookRequest {
+  name: string;
+  url: string;
+  events: WebhookEvent[];
+  min_subtotal?: number | null;
+}
+
+export interface CreateWriteOffItemCodeRequest {
+  item_code: string;
+  description?: string;
+}
+
+export interface CreatedAPIKey {
+  id: number;
+  name: string;
+  prefix: string;
+  scopes: string[];
+  created_at: string;
+  expires_at: string | null;
+  last_used_at: string | null;
+  revoked_at: string | null;
+  key: string;
+}
+
+export interface CreatedWebhook {
+  id: number;
+  name: string;
+  url: string;
+  events: WebhookEvent[];
+  min_subtotal: number | null;
+  enabled: boolean;
+  created_at: string;
+  secret: string;
+}
+
+export interface DateRange {
+  start_date: string;
+  end_date: string;
+}
+
+export interface Employee {
+  id: number;
+  name: string;
+}
+
+export interface EmployeesResponse {
+  employees: Employee[];
+}
+
+export type ErrorCode =
+  | "invalid_param"
+  | "too_many_rows"
+  | "db_unavailable"
+  | "not_found"
+  | "unauthorized"
+  | "forbidden"
+  | "rate_limited"
+  | "overloaded"
+  | "query_timeout"
+  | "not_configured"
+  | "internal_error";
+
+export interface ErrorResponse {
+  error: string;
+  code: ErrorCode;
+  request_id?: string;
+}
+
+export interface HealthResponse {
+  status: string;
+  error?: string;
+  code?: ErrorCode;
+}
+
+export interface Invoice {
+  number: number;
+  date: string;
+  employee_name: string;
+  subtotal: number;
+  is_write_off: boolean;
+  write_off_reason?: WriteOffReason;
+}
+
+export interface InvoiceComparisonResponse {
+  current: DateRange;
+  previous: DateRange;
+  reps: RepComparison[];
+  total: InvoiceMetrics;
+}
+
+export interface InvoiceMetrics {
+  count: MetricChange;
+  subtotal: MetricChange;
+  cost: MetricChange | null;
+  gross_profit: MetricChange | null;
+  gross_margin_percent: MetricChange | null;
+}
+
+export interface InvoiceReview {
+  invoice_number: number;
+  status: ReviewStatus;
+  note?: string;
+  reviewed_by: string;
+  updated_at: string;
+}
+
+export interface InvoicesResponse {
+  invoices: Invoice[];
+}
+
+export interface LeaderboardEntry {
+  rank: number;
+  employee_id: number;
+  employee_name: string;
+  invoice_count: number;
+  revenue: number;
+  revenue_goal: number | null;
+  revenue_goal_missing_months: number;
+  goal_progress: number | null;
+  projected_revenue: number;
+  projected_goal_progress: number | null;
+  gross_profit: number | null;
+  gross_profit_goal: number | null;
+  gross_profit_goal_missing_months: number;
+  gross_profit_goal_progress: number | null;
+  projected_gross_profit: number | null;
+  projected_gross_profit_goal_progress: number | null;
+  prior_revenue: number;
+  change: number;
+  change_percent: number | null;
+}
+
+export type LeaderboardPeriod =
+  | "month"
+  | "quarter"
+  | "year";
+
+export interface LeaderboardResponse {
+  period: LeaderboardPeriod;
+  start_date: string;
+  end_date: string;
+  as_of: string;
+  prior_start_date: string;
+  prior_end_date: string;
+  entries: LeaderboardEntry[];
+}
+
+export interface LogLevel {
+  level: string;
+}
+
+export interface MetricChange {
+  current: number;
+  previous: number;
+  change: number;
+  change_percent: number | null;
+}
+
+export interface ProblemResponse {
+  type: string;
+  title: string;
+  status: number;
+  detail: string;
+  instance?: string;
+  code: ErrorCode;
+  request_id?: string;
+}
+
+export interface PurgeCacheResponse {
+  purged: number;
+}
+
+export interface RepComparison {
+  employee_name: string;
+  count: MetricChange;
+  subtotal: MetricChange;
+  cost: MetricChange | null;
+  gross_profit: MetricChange | null;
+  gross_margin_percent: MetricChange | null;
+}
+
+export type ReportFormat =
+  | "csv"
+  | "pdf";
+
+export type ReportKind =
+  | "invoice_summary"
+  | "commissions";
+
+export type ReportPeriod =
+  | "previous_day"
+  | "previous_week"
+  | "previous_month"
+  | "month_to_date";
+
+export interface ReportRun {
+  id: number;
+  subscription_id: number;
+  manual: boolean;
+  started_at: string;
+  finished_at: string | null;
+  status: ReportRunStatus;
+  error?: string;
+  invoices: number;
+  start_date: string;
+  end_date: string;
+}
+
+export type ReportRunStatus =
+  | "running"
+  | "succeeded"
+  | "failed";
+
+export interface ReportRunsResponse {
+  runs: ReportRun[];
+}
+
+export interface ReportSubscription {
+  id: number;
+  name: string;
+  report: ReportKind;
+  format: ReportFormat;
+  period: ReportPeriod;
+  employee?: string;
+  schedule: string;
+  recipients: string[];
+  enabled: boolean;
+  next_run_at: string | null;
+  created_at: string;
+}
+
+export interface ReportSubscriptionsResponse {
+  subscriptions: ReportSubscription[];
+}
+
+export type ReviewStatus =
+  | "approved"
+  | "disputed"
+  | "resolved";
+
+export interface SalesGoal {
+  employee_id: number;
+  month: string;
+  revenue_goal: number | null;
+  gross_profit_goal: number | null;
+  updated_at: string;
+}
+
+export interface SalesGoalsResponse {
+  goals: SalesGoal[];
+}
+
+export interface SetInvoiceReviewRequest {
+  status: ReviewStatus;
+  note?: string;
+}
+
+export interface SetSalesGoalRequest {
+  employee_id: number;
+  month: string;
+  revenue_goal?: number | null;
+  gross_profit_goal?: number | null;
+}
+
+export interface SlowQueriesResponse {
+  queries: SlowQuery[];
+}
+
+export interface SlowQuery {
+  query_hash: string;
+  query: string;
+  runs: number;
+  total_ms: number;
+  max_ms: number;
+  avg_ms: number;
+  last_seen_at: string;
+  slowest: SlowQueryRun;
+}
+
+export interface SlowQueryRun {
+  id: number;
+  params: string[];
+  duration_ms: number;
+  rows: number;
+  error?: string;
+  endpoint?: string;
+  user?: string;
+  request_id?: string;
+  has_plan: boolean;
+  recorded_at: string;
+}
+
+export interface StreamEvent {
+  type: StreamEventType;
+  time: string;
+  invoice?: Invoice | null;
+  previous?: Invoice | null;
+  health?: HealthResponse | null;
+  review?: InvoiceReview | null;
+  previous_status?: ReviewStatus | null;
+}
+
+export type StreamEventType =
+  | "invoice.inserted"
+  | "invoice.updated"
+  | "invoice.removed"
+  | "health.changed"
+  | "review.changed"
+  | "stream.reset";
+
+export interface Webhook {
+  id: number;
+  name: string;
+  url: string;
+  events: WebhookEvent[];
+  min_subtotal: number | null;
+  enabled: boolean;
+  created_at: string;
+}
+
+export interface WebhookDeliveriesResponse {
+  deliveries: WebhookDelivery[];
+}
+
+export interface WebhookDelivery {
+  id: number;
+  webhook_id: number;
+  event: WebhookEvent;
+  status: WebhookDeliveryStatus;
+  attempts: number;
+  response_status: number | null;
+  error?: string;
+  created_at: string;
+  next_attempt_at: string | null;
+  delivered_at: string | null;
+}
+
+export type WebhookDeliveryStatus =
+  | "pending"
+  | "succeeded"
+  | "failed";
+
+export type WebhookEvent =
+  | "invoice.created"
+  | "invoice.disputed"
+  | "webhook.test";
+
+export interface WebhooksResponse {
+  webhooks: Webhook[];
+}
+
+export interface WriteOffItemCode {
+  id: number;
+  item_code: string;
+  description?: string;
+  created_at: string;
+}
+
+export interface WriteOffItemCodesResponse {
+  item_codes: WriteOffItemCode[];
+  active: boolean;
+}
+
+export type WriteOffReason =
+  | "zero_subtotal"
+  | "negative_subtotal"
+  | "credit_memo"
+  | "write_off_item"
+  | "zero_price_line";
+
+export interface WriteOffRep {
+  employee_name: string;
+  count: number;
+  subtotal: number;
+  reasons: WriteOffTotal[];
+}
+
+export interface WriteOffTotal {
+  reason: WriteOffReason;
+  count: number;
+  subtotal: number;
+}
+
+export interface WriteOffsResponse {
+  start_date: string;
+  end_date: string;
+  count: number;
+  subtotal: number;
+  reasons: WriteOffTotal[];
+  reps: WriteOffRep[];
+  rules: WriteOffReason[];
+}
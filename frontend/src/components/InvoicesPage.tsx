@@ -8,22 +8,13 @@ import {
   createColumnHelper,
   type SortingState,
 } from "@tanstack/react-table";
-
-interface Employee {
-  id: number;
-  name: string;
-}
-
-interface Invoice {
-  number: number;
-  date: string;
-  employee_name: string;
-  subtotal: number;
-}
-
-interface ApiResponse<T> {
-  [key: string]: T[];
-}
+import type {
+  Employee,
+  EmployeesResponse,
+  ErrorResponse,
+  Invoice,
+  InvoicesResponse,
+} from "../api/types";
 
 const columnHelper = createColumnHelper<Invoice>();
 
@@ -118,7 +109,7 @@ function InvoicesPage() {
           return;
         }
 
-        const data: ApiResponse<Employee> = await res.json();
+        const data: EmployeesResponse = await res.json();
 
         if (data.employees && Array.isArray(data.employees)) {
           const sorted = [...data.employees].sort((a, b) =>
@@ -156,12 +147,13 @@ function InvoicesPage() {
 
     try {
       const res = await fetch(`/api/invoices?${params}`);
-      const data = await res.json();
 
       if (!res.ok) {
+        const data: ErrorResponse = await res.json();
         setError(data.error || "Failed to fetch invoices");
         setInvoices([]);
       } else {
+        const data: InvoicesResponse = await res.json();
         setInvoices(data.invoices);
       }
     } catch {
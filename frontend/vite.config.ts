@@ -1,8 +1,43 @@
-import { defineConfig } from "vite";
+import { defineConfig, type Plugin } from "vite";
 import react from "@vitejs/plugin-react";
 import tailwindcss from "@tailwindcss/vite";
+import { readFileSync, writeFileSync } from "node:fs";
+import { join } from "node:path";
+import { brotliCompressSync, constants, gzipSync } from "node:zlib";
+
+// Files smaller than this are not worth compressing (matches the Go server)
+const PRECOMPRESS_MIN_SIZE = 1024;
+
+// Writes .br and .gz variants next to each compressible build output file so
+// the Go server can serve them directly from the embedded filesystem.
+function precompress(): Plugin {
+  return {
+    name: "precompress",
+    apply: "build",
+    writeBundle(options, bundle) {
+      const outDir = options.dir ?? "dist";
+      for (const fileName of Object.keys(bundle)) {
+        if (!/\.(js|css|html|svg|json)$/.test(fileName)) {
+          continue;
+        }
+        const filePath = join(outDir, fileName);
+        const data = readFileSync(filePath);
+        if (data.length < PRECOMPRESS_MIN_SIZE) {
+          continue;
+        }
+        writeFileSync(
+          `${filePath}.br`,
+          brotliCompressSync(data, {
+            params: { [constants.BROTLI_PARAM_QUALITY]: 11 },
+          }),
+        );
+        writeFileSync(`${filePath}.gz`, gzipSync(data, { level: 9 }));
+      }
+    },
+  };
+}
 
 // https://vite.dev/config/
 export default defineConfig({
-  plugins: [react(), tailwindcss()],
+  plugins: [react(), tailwindcss(), precompress()],
 });